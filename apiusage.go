@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/invertedv/chutils"
+)
+
+// quotaWarning is the share of the daily budget of an API key past which each load warns
+const quotaWarning = 0.8
+
+// apiUsageSpec is the spec of the API usage table, which counts the Fred II requests made with each API key each
+// day across all runs that record to it.  SummingMergeTree adds up the rows of a key and day as it merges.
+var apiUsageSpec = &tableSpec{
+	columns: []column{
+		{name: "key", chType: "String", comment: "start of the SHA-256 of the API key, so the key isn't stored"},
+		{name: "day", chType: "Date", comment: "day of the requests, in the server's time zone"},
+		{name: "requests", chType: "UInt64", comment: "Fred II requests made"},
+	},
+	engine:  "SummingMergeTree(requests)",
+	orderBy: "key, day",
+}
+
+// apiUsageDDL returns the statement that creates the API usage table, if it doesn't already exist.
+func apiUsageDDL(table string) []string {
+	return []string{apiUsageSpec.createSQL(table, true)}
+}
+
+// keyID returns the identifier of apiKey in the API usage table.
+func keyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// recordAPIUsage adds requests made with apiKey today to table.  If perDay is positive, it warns once the day's
+// requests with the key, by any run, pass quotaWarning of it.
+func recordAPIUsage(table string, apiKey string, requests int64, perDay int, con *chutils.Connect) error {
+	if requests <= 0 {
+		return nil
+	}
+	id := keyID(apiKey)
+	if _, e := con.Exec(fmt.Sprintf("INSERT INTO %s VALUES (?, today(), ?)", table), id, uint64(requests)); e != nil {
+		return e
+	}
+	if perDay <= 0 {
+		return nil
+	}
+	var total uint64
+	qry := fmt.Sprintf("SELECT sum(requests) FROM %s WHERE key = ? AND day = today()", table)
+	if e := con.QueryRow(qry, id).Scan(&total); e != nil {
+		return e
+	}
+	if float64(total) >= quotaWarning*float64(perDay) {
+		fmt.Printf("warning: %d of the %d Fred II requests allowed today with API key %s have been made\n", total,
+			perDay, id)
+	}
+	return nil
+}
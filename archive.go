@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"net/url"
+	"time"
+)
+
+// archiveSpec is the spec of the table holding raw Fred II responses
+var archiveSpec = &tableSpec{
+	columns: []column{
+		{name: "seriesId", chType: "String", comment: "Fred II series ID"},
+		{name: "url", chType: "String", comment: "request url, without the API key"},
+		{name: "fetched", chType: "DateTime", comment: "time of the request"},
+		{name: "payload", chType: "String", comment: "raw response body", codec: "ZSTD"},
+	},
+	engine:  "MergeTree()",
+	orderBy: "seriesId, fetched",
+}
+
+// archiveDDL returns the statement that creates the archive table, if it doesn't already exist.
+// Unlike the series table, the archive accumulates across runs.
+func archiveDDL(table string) []string {
+	return []string{archiveSpec.createSQL(table, true)}
+}
+
+// archiver returns a function that saves a raw Fred II response to table.
+func archiver(table string, con *chutils.Connect) func(string, time.Time, []byte) error {
+	return func(requestURL string, fetched time.Time, body []byte) error {
+		u, e := url.Parse(requestURL)
+		if e != nil {
+			return e
+		}
+		seriesId := u.Query().Get("series_id")
+		qry := fmt.Sprintf("INSERT INTO %s VALUES (?, ?, ?, ?)", table)
+		_, e = con.Exec(qry, seriesId, requestURL, fetched, string(body))
+		return e
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/chsink"
+	"github.com/invertedv/fred2ch/fred"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// writePath is a way of inserting a batch of observations into the job's table
+type writePath struct {
+	name   string
+	insert func(batch []fred.Observation, j *job, con *chutils.Connect) error
+}
+
+// writePaths are the insert paths bench compares
+var writePaths = []writePath{
+	{"rows", func(batch []fred.Observation, j *job, con *chutils.Connect) error {
+		return insertBatch(batch, nil, j, con)
+	}},
+	{"native", nativeInsert},
+}
+
+// benchCmd times loading a series into a scratch table by each insert path at each batch size, reporting the rows
+// per second and memory allocated.
+func benchCmd(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	tablePtr := fs.String("table", "fred2ch_bench", "string")
+	seriesPtr := fs.String("series", "", "string")
+	rowsPtr := fs.Int("rows", 1000000, "int")
+	batchPtr := fs.String("batch", "10000,100000", "string")
+	fileDirPtr := fs.String("file-dir", "", "string")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	var sizes []int
+	for _, b := range strings.Split(*batchPtr, ",") {
+		size, e := strconv.Atoi(strings.TrimSpace(b))
+		if e != nil || size <= 0 {
+			return fmt.Errorf("-batch must be a comma-separated list of positive sizes, not %s", *batchPtr)
+		}
+		sizes = append(sizes, size)
+	}
+
+	// a real series if one is given, otherwise a synthetic one
+	seriesId := "BENCH"
+	var obs []fred.Observation
+	if *seriesPtr != "" {
+		if cf.API == "" {
+			return fmt.Errorf("bench -series requires -api")
+		}
+		seriesId = seriesID(*seriesPtr)
+		all, e := fred.GetObservations(seriesId, cf.API, nil)
+		if e != nil {
+			return diagnose(e, cf.Host)
+		}
+		for _, o := range all {
+			if !o.Missing && o.Date.Year() >= 1970 {
+				obs = append(obs, o)
+			}
+		}
+	} else {
+		if *rowsPtr <= 0 {
+			return fmt.Errorf("-rows must be positive")
+		}
+		obs = synthetic(*rowsPtr)
+	}
+
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+	defer func() {
+		if e := execDDL([]string{fmt.Sprintf("DROP TABLE IF EXISTS %s", *tablePtr)}, con); e != nil {
+			fmt.Println(e)
+		}
+	}()
+
+	paths := writePaths
+	if *fileDirPtr != "" {
+		for _, format := range []string{"values", "csv"} {
+			format := format
+			paths = append(paths, writePath{"file " + format,
+				func(batch []fred.Observation, j *job, con *chutils.Connect) error {
+					viaFile := *j
+					viaFile.fileDir, viaFile.fileFmt = *fileDirPtr, format
+					return fileInsert(batch, nil, &viaFile, con)
+				}})
+		}
+	}
+	fmt.Printf("loading %d rows of %s into %s\n", len(obs), seriesId, *tablePtr)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "PATH\tBATCH\tSECONDS\tROWS/SEC\tMB ALLOCATED\t")
+	for _, size := range sizes {
+		for _, path := range paths {
+			j := &job{seriesId: seriesId, table: *tablePtr, batchSize: size, tc: newTableConfig()}
+			if e := makeTable(j, con); e != nil {
+				return diagnose(e, cf.Host)
+			}
+			elapsed, allocated, e := timeLoad(obs, path, j, con)
+			if e != nil {
+				return diagnose(e, cf.Host)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%.2f\t%.0f\t%.1f\t\n", path.name, size, elapsed.Seconds(),
+				float64(len(obs))/elapsed.Seconds(), float64(allocated)/(1<<20))
+		}
+	}
+	return w.Flush()
+}
+
+// timeLoad inserts obs into the job's table by path, returning the time taken and the bytes allocated.
+func timeLoad(obs []fred.Observation, path writePath, j *job, con *chutils.Connect) (time.Duration, uint64, error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for ind := 0; ind < len(obs); ind += j.batchSize {
+		end := ind + j.batchSize
+		if end > len(obs) {
+			end = len(obs)
+		}
+		if e := path.insert(obs[ind:end], j, con); e != nil {
+			return 0, 0, e
+		}
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return elapsed, after.TotalAlloc - before.TotalAlloc, nil
+}
+
+// nativeInsert inserts a batch as the driver's native batch: a prepared INSERT in a transaction, which sends the
+// values in ClickHouse's column format rather than as VALUES text.
+func nativeInsert(batch []fred.Observation, j *job, con *chutils.Connect) error {
+	tx, e := con.Begin()
+	if e != nil {
+		return e
+	}
+	stmt, e := tx.Prepare(seriesSpec(j.seriesId, j.tc).insertSQL(j.table))
+	if e != nil {
+		_ = tx.Rollback()
+		return e
+	}
+	for _, o := range batch {
+		if _, e := stmt.Exec(j.seriesId, o.Date, float32(o.Value)); e != nil {
+			_ = tx.Rollback()
+			return e
+		}
+	}
+	if e := stmt.Close(); e != nil {
+		_ = tx.Rollback()
+		return e
+	}
+	return chsink.Classify(tx.Commit())
+}
+
+// synthetic returns n observations of a daily random walk.  The dates start again at 1970 every 50,000 days, so
+// they stay within the range of a Date column.
+func synthetic(n int) []fred.Observation {
+	obs := make([]fred.Observation, n)
+	start := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewSource(1))
+	value := 100.0
+	for ind := range obs {
+		value += rng.NormFloat64()
+		obs[ind] = fred.Observation{Date: start.AddDate(0, 0, ind%50000), Value: value}
+	}
+	return obs
+}
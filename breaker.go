@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/fred2ch/fred"
+	"time"
+)
+
+// newBreaker returns the circuit breaker of -breaker and -breaker-cooldown: after threshold loads in a row fail, the
+// rest wait out the cooldown before trying again or, if it's blank, fail without being tried.  A threshold of 0
+// never trips.
+func newBreaker(threshold int, cooldown string) (*fred.Breaker, error) {
+	if threshold < 0 {
+		return nil, fmt.Errorf("-breaker can't be negative")
+	}
+	var d time.Duration
+	if cooldown != "" {
+		var e error
+		if d, e = time.ParseDuration(cooldown); e != nil || d <= 0 {
+			return nil, fmt.Errorf("-breaker-cooldown must be a duration, e.g. 5m, not %s", cooldown)
+		}
+	}
+	return fred.NewBreaker(threshold, d), nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// bufferParams are the parameters of the Buffer engine after the destination: 16 buffers, each flushed after 10 to
+// 100 seconds, 10,000 to 1,000,000 rows or 10MB to 100MB, whichever limits are reached first
+const bufferParams = "16, 10, 100, 10000, 1000000, 10000000, 100000000"
+
+// bufferTable returns the name of the Buffer table in front of table.
+func bufferTable(table string) string {
+	return table + "_buffer"
+}
+
+// bufferDDL returns the statements that create the Buffer table in front of table, which must already exist.
+// If ifNotExists, an existing Buffer table is left in place.
+func bufferDDL(table string, ifNotExists bool) []string {
+	create := "CREATE TABLE"
+	if ifNotExists {
+		create += " IF NOT EXISTS"
+	}
+	return []string{fmt.Sprintf("%s %s AS %s ENGINE = Buffer(currentDatabase(), %s, %s)", create,
+		bufferTable(table), table, table, bufferParams)}
+}
+
+// bufferDrop returns the statement that drops the Buffer table in front of table, flushing it into table.  It must
+// run before table is dropped.
+func bufferDrop(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", bufferTable(table))
+}
+
+// insertTarget returns the table inserts meant for table go to: its Buffer table if the config has one.
+func (tc *tableConfig) insertTarget(table string) string {
+	if tc.buffer {
+		return bufferTable(table)
+	}
+	return table
+}
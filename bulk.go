@@ -0,0 +1,235 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// zipMagic starts every zip file
+var zipMagic = []byte("PK\x03\x04")
+
+// bulkCmd loads the series of a Fred II bulk download, a zip of CSV files or a single CSV file, into a table shared
+// by the series.
+func bulkCmd(args []string) error {
+	fs := flag.NewFlagSet("bulk", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	tf := addTableFlags(fs)
+	archivePtr := fs.String("archive", "", "string")
+	tablePtr := fs.String("table", "", "string")
+	seriesPtr := fs.String("series", "", "string")
+	batchPtr := fs.Int("batch", defaultBatch, "int")
+	date32Ptr := fs.Bool("date32", false, "bool")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	if *archivePtr == "" || *tablePtr == "" || *batchPtr <= 0 {
+		return fmt.Errorf("bulk requires -archive, -table and a positive -batch")
+	}
+	tc, e := tf.config()
+	if e != nil {
+		return e
+	}
+	// the series share the table
+	tc.bySeries = true
+	if *date32Ptr {
+		tc.dateType = "Date32"
+	}
+	wanted := make(map[string]bool)
+	for _, s := range strings.Split(*seriesPtr, ",") {
+		if s = seriesID(s); s != "" {
+			wanted[s] = true
+		}
+	}
+
+	file, e := openArchive(*archivePtr)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		if e := file.Close(); e != nil {
+			fmt.Println(e)
+		}
+	}()
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+	if e := execDDL(tableDDL("in "+path.Base(*archivePtr), *tablePtr, tc), con); e != nil {
+		return diagnose(e, cf.Host)
+	}
+
+	b := &bulkLoad{table: *tablePtr, batchSize: *batchPtr, tc: tc, wanted: wanted, con: con}
+	if e := b.load(file, *archivePtr); e != nil {
+		return diagnose(e, cf.Host)
+	}
+	fmt.Printf("%d series, %d rows loaded into %s\n", b.series, b.rows, *tablePtr)
+	return nil
+}
+
+// openArchive opens the bulk download at source, a path or an http(s) URL.  A download is saved to a temporary
+// file, which is removed when it is closed.
+func openArchive(source string) (*os.File, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+	resp, e := http.Get(source)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", source, resp.Status)
+	}
+	tmp, e := os.CreateTemp("", "fred2ch-bulk-*")
+	if e != nil {
+		return nil, e
+	}
+	// the name goes now, the file when it's closed
+	if e := os.Remove(tmp.Name()); e != nil {
+		return nil, e
+	}
+	fmt.Printf("downloading %s\n", source)
+	if _, e := io.Copy(tmp, resp.Body); e != nil {
+		_ = tmp.Close()
+		return nil, e
+	}
+	if _, e := tmp.Seek(0, io.SeekStart); e != nil {
+		_ = tmp.Close()
+		return nil, e
+	}
+	return tmp, nil
+}
+
+// bulkLoad loads the series of a bulk download into a table
+type bulkLoad struct {
+	table     string
+	batchSize int
+	tc        *tableConfig
+	wanted    map[string]bool // series to load, all if empty
+	con       *chutils.Connect
+
+	series int // series loaded
+	rows   int // rows loaded
+}
+
+// load loads the series in file, a zip of CSV files or a CSV file named name.
+func (b *bulkLoad) load(file *os.File, name string) error {
+	magic := make([]byte, len(zipMagic))
+	if _, e := io.ReadFull(file, magic); e != nil {
+		return fmt.Errorf("%s: %w", name, e)
+	}
+	if _, e := file.Seek(0, io.SeekStart); e != nil {
+		return e
+	}
+	if !bytes.Equal(magic, zipMagic) {
+		return b.loadCSV(file, name)
+	}
+	info, e := file.Stat()
+	if e != nil {
+		return e
+	}
+	zr, e := zip.NewReader(file, info.Size())
+	if e != nil {
+		return fmt.Errorf("%s: %w", name, e)
+	}
+	for _, f := range zr.File {
+		if !strings.EqualFold(path.Ext(f.Name), ".csv") {
+			continue
+		}
+		r, e := f.Open()
+		if e != nil {
+			return fmt.Errorf("%s: %w", f.Name, e)
+		}
+		e = b.loadCSV(r, f.Name)
+		_ = r.Close()
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// loadCSV loads the series of a CSV file named name.  The first column holds the dates and each other column a
+// series named by its header.  A column headed VALUE, as in the files of Fred II's zip archives, is the series
+// the file is named for.
+func (b *bulkLoad) loadCSV(r io.Reader, name string) error {
+	cr := csv.NewReader(r)
+	header, e := cr.Read()
+	if e != nil {
+		return fmt.Errorf("%s: %w", name, e)
+	}
+	if len(header) < 2 {
+		return fmt.Errorf("%s has no series columns", name)
+	}
+	ids := make([]string, len(header))
+	obs := make([][]fred.Observation, len(header))
+	for col, h := range header[1:] {
+		ids[col+1] = seriesID(h)
+		if ids[col+1] == "VALUE" {
+			ids[col+1] = seriesID(strings.TrimSuffix(path.Base(name), path.Ext(name)))
+		}
+	}
+	for {
+		rec, e := cr.Read()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return fmt.Errorf("%s: %w", name, e)
+		}
+		for col := 1; col < len(rec) && col < len(ids); col++ {
+			if len(b.wanted) > 0 && !b.wanted[ids[col]] {
+				continue
+			}
+			o, e := fred.Datum{Date: strings.TrimSpace(rec[0]), Value: strings.TrimSpace(rec[col])}.Parse()
+			if e != nil {
+				return fmt.Errorf("%s, series %s: %w", name, ids[col], e)
+			}
+			// the date column can't hold dates before its first year
+			if o.Missing || fred.IsMissingDate(o.Date) || o.Date.Year() < b.tc.minYear() {
+				continue
+			}
+			obs[col] = append(obs[col], o)
+		}
+	}
+	for col := 1; col < len(ids); col++ {
+		if len(obs[col]) == 0 {
+			continue
+		}
+		if e := b.insert(ids[col], obs[col]); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// insert inserts the observations of seriesId in batches.
+func (b *bulkLoad) insert(seriesId string, obs []fred.Observation) error {
+	j := &job{seriesId: seriesId, table: b.table, batchSize: b.batchSize, tc: b.tc, retries: defaultInsertRetries}
+	for start := 0; start < len(obs); start += j.batchSize {
+		end := start + j.batchSize
+		if end > len(obs) {
+			end = len(obs)
+		}
+		if e := retryInsert(obs[start:end], nil, j, b.con); e != nil {
+			return e
+		}
+	}
+	b.series++
+	b.rows += len(obs)
+	return nil
+}
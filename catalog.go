@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// maxSearchResults is the most matches of -search loaded, the most relevant first
+const maxSearchResults = 1000
+
+// fromCatalog returns true if the load's series are picked from Fred II's catalog, by release, category or search,
+// rather than listed.
+func (ls *loadSpec) fromCatalog() bool {
+	return ls.Release > 0 || ls.Category > 0 || ls.Search != ""
+}
+
+// catalogSeries returns the series the load picks from Fred II's catalog: those of the release, of the category,
+// and its descendants if ls.Recursive is set, or matching the search, that pass the filters.  Each series appears
+// once.
+func (ls *loadSpec) catalogSeries(apiKey string) ([]fred.SeriesInfo, error) {
+	var infos []fred.SeriesInfo
+	switch {
+	case ls.Search != "":
+		var e error
+		if infos, e = fred.SearchSeries(ls.Search, maxSearchResults, apiKey); e != nil {
+			return nil, e
+		}
+	case ls.Release > 0:
+		var e error
+		if infos, e = fred.GetReleaseSeries(ls.Release, apiKey); e != nil {
+			return nil, e
+		}
+	case ls.Category > 0:
+		var e error
+		if infos, e = categorySeries(ls.Category, ls.Recursive, apiKey); e != nil {
+			return nil, e
+		}
+	}
+	var picked []fred.SeriesInfo
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		if !seen[info.ID] && ls.passes(info) {
+			seen[info.ID] = true
+			picked = append(picked, info)
+		}
+	}
+	if len(picked) == 0 {
+		return nil, fmt.Errorf("Fred II has no series for %s that pass the filters", ls.catalogLabel())
+	}
+	return picked, nil
+}
+
+// passes returns true if the series passes the filters of the load: its frequency, units and popularity.
+func (ls *loadSpec) passes(info fred.SeriesInfo) bool {
+	if ls.FilterFrequency != "" && !strings.EqualFold(info.FrequencyShort, ls.FilterFrequency) &&
+		!strings.EqualFold(info.Frequency, ls.FilterFrequency) {
+		return false
+	}
+	if ls.FilterUnits != "" && !strings.Contains(strings.ToLower(info.Units), strings.ToLower(ls.FilterUnits)) {
+		return false
+	}
+	return info.Popularity >= ls.MinPopularity
+}
+
+// printCatalog prints the series picked from the catalog as an aligned table.
+func printCatalog(infos []fred.SeriesInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIES\tFREQUENCY\tUNITS\tPOPULARITY\tTITLE")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", info.ID, info.FrequencyShort, info.UnitsShort, info.Popularity,
+			info.Title)
+	}
+	if e := w.Flush(); e != nil {
+		fmt.Println(e)
+	}
+}
+
+// catalogSources returns the number of the ways of picking series from the catalog the load uses.
+func (ls *loadSpec) catalogSources() int {
+	n := 0
+	for _, set := range []bool{ls.Release > 0, ls.Category > 0, ls.Search != ""} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// catalogLabel describes where in the catalog the load's series are picked from.
+func (ls *loadSpec) catalogLabel() string {
+	if ls.Search != "" {
+		return fmt.Sprintf("search %q", ls.Search)
+	}
+	if ls.Release > 0 {
+		return fmt.Sprintf("release %d", ls.Release)
+	}
+	if ls.Recursive {
+		return fmt.Sprintf("category %d and its descendants", ls.Category)
+	}
+	return fmt.Sprintf("category %d", ls.Category)
+}
+
+// categorySeries returns the series of the category categoryId and, if recursive, of every category below it.
+// The categories are walked breadth first.
+func categorySeries(categoryId int, recursive bool, apiKey string) ([]fred.SeriesInfo, error) {
+	var infos []fred.SeriesInfo
+	visited := map[int]bool{categoryId: true}
+	for queue := []int{categoryId}; len(queue) > 0; queue = queue[1:] {
+		series, e := fred.GetCategorySeries(queue[0], apiKey)
+		if e != nil {
+			return nil, e
+		}
+		infos = append(infos, series...)
+		if !recursive {
+			break
+		}
+		children, e := fred.GetCategoryChildren(queue[0], apiKey)
+		if e != nil {
+			return nil, e
+		}
+		for _, c := range children {
+			if !visited[c.ID] {
+				visited[c.ID] = true
+				queue = append(queue, c.ID)
+			}
+		}
+	}
+	return infos, nil
+}
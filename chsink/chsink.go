@@ -0,0 +1,79 @@
+// Package chsink loads Fred II series into ClickHouse tables, for programs that embed the load in their own
+// pipeline rather than run fred2ch.  The tables have fred2ch's default columns: seriesId (String), date (Date) and
+// value (Float32).
+package chsink
+
+import (
+	"context"
+	"fmt"
+	"github.com/invertedv/chutils"
+	s "github.com/invertedv/chutils/sql"
+	"github.com/invertedv/fred2ch/fred"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Table is a fred.Sink that writes series to a ClickHouse table.  Observations before 1970, which the Date type
+// can't hold, aren't written.
+type Table struct {
+	Name    string           // table, which may be qualified by its database
+	Con     *chutils.Connect // connection to ClickHouse
+	Replace bool             // if true, an existing table is dropped.  Otherwise the series are added to it.
+}
+
+// Load loads the series seriesId into table, replacing any existing table.  Canceling ctx abandons the requests
+// to Fred II, and the load fails.  The returned Series has every field except Results.
+func Load(ctx context.Context, seriesId string, apiKey string, table string, con *chutils.Connect,
+	opts *fred.Options) (*fred.Series, error) {
+	return fred.Load(ctx, seriesId, apiKey, opts, &Table{Name: table, Con: con, Replace: true})
+}
+
+// CreateSchema creates the table, dropping any existing one if t.Replace is set.
+func (t *Table) CreateSchema(seriesId string) error {
+	create := "CREATE TABLE IF NOT EXISTS"
+	if t.Replace {
+		if _, e := t.Con.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", t.Name)); e != nil {
+			return e
+		}
+		create = "CREATE TABLE"
+	}
+	qry := fmt.Sprintf(`%s %s (
+    seriesId String COMMENT 'Fred II series ID',
+    date Date COMMENT 'date of metric value',
+    value Float32 COMMENT 'metric value'
+) ENGINE = MergeTree()
+ORDER BY (seriesId, date)`, create, t.Name)
+	_, e := t.Con.Exec(qry)
+	return Classify(e)
+}
+
+// WriteBatch inserts the batch of observations of seriesId.
+func (t *Table) WriteBatch(seriesId string, batch []fred.Observation) error {
+	wtr := s.NewWriter(t.Name, t.Con)
+	written := 0
+	for _, o := range batch {
+		if o.Missing || fred.IsMissingDate(o.Date) || o.Date.Year() < 1970 {
+			continue
+		}
+		if math.IsNaN(o.Value) || math.IsInf(o.Value, 0) {
+			return fmt.Errorf("series %s has value %v for %s, which isn't a finite number", seriesId, o.Value,
+				o.Date.Format(fred.DateFormat))
+		}
+		line := fmt.Sprintf("'%s','%s',%s", strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(seriesId),
+			o.Date.Format(fred.DateFormat), strconv.FormatFloat(o.Value, 'f', -1, 64))
+		if _, e := wtr.Write([]byte(line)); e != nil {
+			return e
+		}
+		written++
+	}
+	if written == 0 {
+		return nil
+	}
+	return Classify(wtr.Insert())
+}
+
+// Finalize does nothing: each batch is inserted as it's written.
+func (t *Table) Finalize(seriesId string, err error) error {
+	return nil
+}
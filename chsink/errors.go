@@ -0,0 +1,56 @@
+package chsink
+
+import (
+	"errors"
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+var (
+	// ErrTableExists is matched, using errors.Is, by errors creating a table that already exists
+	ErrTableExists = errors.New("table already exists")
+
+	// ErrSchemaMismatch is matched, using errors.Is, by errors from a table lacking the columns or types expected
+	ErrSchemaMismatch = errors.New("table doesn't match the expected schema")
+)
+
+// ClickHouse exception codes
+var (
+	// TABLE_ALREADY_EXISTS
+	tableExistsCodes = map[int32]bool{57: true}
+	// missing column, type mismatch
+	schemaMismatchCodes = map[int32]bool{8: true, 16: true, 20: true, 47: true, 53: true}
+)
+
+// kindError is an error that also matches the sentinel error kind
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Classify returns err so that it matches ErrTableExists or ErrSchemaMismatch if it is a ClickHouse exception of
+// that kind.  The exception can still be had with errors.As.
+func Classify(err error) error {
+	var ex *clickhouse.Exception
+	if !errors.As(err, &ex) {
+		return err
+	}
+	switch {
+	case tableExistsCodes[ex.Code]:
+		return &kindError{kind: ErrTableExists, err: err}
+	case schemaMismatchCodes[ex.Code]:
+		return &kindError{kind: ErrSchemaMismatch, err: err}
+	}
+	return err
+}
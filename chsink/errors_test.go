@@ -0,0 +1,37 @@
+package chsink
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		err      error
+		exists   bool
+		mismatch bool
+	}{
+		{name: "table exists", err: &clickhouse.Exception{Code: 57}, exists: true},
+		{name: "no such column", err: &clickhouse.Exception{Code: 16}, mismatch: true},
+		{name: "wrapped", err: fmt.Errorf("insert: %w", &clickhouse.Exception{Code: 53}), mismatch: true},
+		{name: "other exception", err: &clickhouse.Exception{Code: 252}},
+		{name: "not an exception", err: errors.New("broken pipe")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Classify(tt.err)
+			if errors.Is(e, ErrTableExists) != tt.exists || errors.Is(e, ErrSchemaMismatch) != tt.mismatch {
+				t.Errorf("Classify(%v) matches ErrTableExists: %v, ErrSchemaMismatch: %v", tt.err,
+					errors.Is(e, ErrTableExists), errors.Is(e, ErrSchemaMismatch))
+			}
+			if !errors.Is(e, tt.err) {
+				t.Errorf("Classify(%v) doesn't wrap it", tt.err)
+			}
+		})
+	}
+	if Classify(nil) != nil {
+		t.Error("Classify(nil) isn't nil")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+)
+
+// localTable returns the name of the local table on each shard behind the Distributed table.
+func localTable(table string) string {
+	return table + "_local"
+}
+
+// onCluster returns the ON CLUSTER clause of DDL run across the cluster of tc, blank if it has none.
+func (tc *tableConfig) onCluster() string {
+	if tc.cluster == "" {
+		return ""
+	}
+	return fmt.Sprintf(" ON CLUSTER %s", tc.cluster)
+}
+
+// clusterDDL returns the statements that replace table, for seriesId, on every host of the cluster of tc.  If
+// tc is distributed, table is a Distributed table over a local table on each shard, with the rows of a series
+// kept on one shard.
+func clusterDDL(seriesId string, table string, tc *tableConfig) []string {
+	spec := seriesSpec(seriesId, tc)
+	spec.cluster = tc.cluster
+	if !tc.distributed {
+		return []string{fmt.Sprintf("DROP TABLE IF EXISTS %s%s SYNC", table, tc.onCluster()),
+			spec.createSQL(table, false)}
+	}
+	local := localTable(table)
+	db, name := splitTable(local)
+	if db == "" {
+		db = "currentDatabase()"
+	}
+	return []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s%s SYNC", table, tc.onCluster()),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s%s SYNC", local, tc.onCluster()),
+		spec.createSQL(local, false),
+		fmt.Sprintf("CREATE TABLE %s%s AS %s ENGINE = Distributed(%s, %s, %s, cityHash64(%s))", table, tc.onCluster(),
+			local, tc.cluster, db, name, tc.seriesCol),
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/invertedv/chutils"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commands are the subcommands, keyed by name.  Each parses its own flags from args.  Without a subcommand,
+// fred2ch loads a series.
+var commands = map[string]func(args []string) error{
+	"recessions": recessionsCmd,
+	"verify":     verifyCmd,
+	"delete":     deleteCmd,
+	"list":       listCmd,
+	"info":       infoCmd,
+	"refresh":    refreshCmd,
+	"run":        runCmd,
+	"bench":      benchCmd,
+	"bulk":       bulkCmd,
+	"copy":       copyCmd,
+	"diff":       diffCmd,
+	"doctor":     doctorCmd,
+}
+
+// runCommand runs the subcommand named by the first argument, if there is one.  It returns false if there isn't.
+func runCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	if e := cmd(os.Args[2:]); e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+	return true
+}
+
+// connFlags are the ClickHouse connection and Fred II flags shared by the subcommands, held in an account
+type connFlags struct {
+	account
+	fs       *flag.FlagSet
+	profile  string // profile of the account to use, none if blank
+	profiles string // file of the profiles, ~/.fred2ch.yaml if blank
+}
+
+// addConnFlags defines the shared flags in fs.
+func addConnFlags(fs *flag.FlagSet) *connFlags {
+	cf := &connFlags{fs: fs}
+	cf.account.addFlags(fs)
+	fs.StringVar(&cf.profile, "profile", "", "string")
+	fs.StringVar(&cf.profiles, "profiles", "", "string")
+	return cf
+}
+
+// tableFlags are the flags that give the columns of an existing series table, as set when it was loaded
+type tableFlags struct {
+	preset    *string
+	seriesCol *string
+	dateCol   *string
+	valueCol  *string
+}
+
+// addTableFlags defines the table flags in fs.
+func addTableFlags(fs *flag.FlagSet) *tableFlags {
+	return &tableFlags{
+		preset:    fs.String("preset", "", "string"),
+		seriesCol: fs.String("col-series", "", "string"),
+		dateCol:   fs.String("col-date", "", "string"),
+		valueCol:  fs.String("col-value", "", "string"),
+	}
+}
+
+// config returns the table config described by the flags.
+func (tf *tableFlags) config() (*tableConfig, error) {
+	tc := newTableConfig()
+	if *tf.preset != "" {
+		if e := tc.applyPreset(*tf.preset); e != nil {
+			return nil, e
+		}
+	}
+	for _, c := range []struct{ flag, col *string }{
+		{tf.seriesCol, &tc.seriesCol}, {tf.dateCol, &tc.dateCol}, {tf.valueCol, &tc.valueCol}} {
+		if *c.flag != "" {
+			*c.col = *c.flag
+		}
+	}
+	return tc, tc.check()
+}
+
+// setup fills in the settings not given as flags from the environment and the -profile and -secrets, if there
+// are any, reads the password and API key from stdin if they are given as -, and sets the TLS of Fred II requests.
+func (cf *connFlags) setup() error {
+	cf.applyEnv(flagsSet(cf.fs))
+	if cf.profile != "" {
+		p, e := readProfile(cf.profiles, cf.profile)
+		if e != nil {
+			return e
+		}
+		cf.applyProfile(p, flagsSet(cf.fs))
+	}
+	if e := cf.applySecrets(flagsSet(cf.fs)); e != nil {
+		return e
+	}
+	if e := readSecrets(secretFlag{"ClickHouse password", &cf.Password},
+		secretFlag{"Fred II API key", &cf.API}); e != nil {
+		return e
+	}
+	return cf.fredTLS()
+}
+
+// connect opens the ClickHouse connection described by the flags.
+func (cf *connFlags) connect() (*chutils.Connect, error) {
+	con, e := connect(&cf.account)
+	return con, diagnose(e, cf.Host)
+}
+
+// connect opens the ClickHouse connection of acct.  Its host may be a comma-separated list of the hosts of a
+// replicated cluster, which are tried in order until one answers.  If acct has an SSH bastion, each host is
+// reached through a tunnel from it.  If acct is secure, the connection uses TLS.  If acct has a wait, failures
+// that may be momentary are retried with backoff until it has passed, for ClickHouse servers still starting.
+func connect(acct *account) (*chutils.Connect, error) {
+	var wait time.Duration
+	if acct.WaitForDB != "" {
+		var e error
+		if wait, e = time.ParseDuration(acct.WaitForDB); e != nil || wait < 0 {
+			return nil, fmt.Errorf("-wait-for-db must be a duration, e.g. 60s, not %s", acct.WaitForDB)
+		}
+	}
+	opts := &clickhouse.Options{
+		Auth:        clickhouse.Auth{Database: "default", Username: acct.User, Password: acct.Password},
+		DialTimeout: 5 * time.Second,
+	}
+	var e error
+	if opts.Settings, e = parseSettings(acct.InsertSettings); e != nil {
+		return nil, e
+	}
+	if opts.Compression, e = parseCompression(acct.Compression); e != nil {
+		return nil, e
+	}
+	if opts.TLS, e = acct.chTLS(); e != nil {
+		return nil, e
+	}
+	deadline := time.Now().Add(wait)
+	backoff := time.Second
+	for {
+		con, e := dial(acct, opts)
+		if e == nil || !retryable(e) || time.Now().Add(backoff).After(deadline) {
+			return con, e
+		}
+		fmt.Printf("ClickHouse isn't answering, retrying in %s: %v\n", backoff, e)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxRetryWait {
+			backoff = maxRetryWait
+		}
+	}
+}
+
+// dial opens a connection with opts to the first of the hosts of acct that answers.
+func dial(acct *account, opts *clickhouse.Options) (*chutils.Connect, error) {
+	hosts := strings.Split(acct.Host, ",")
+	var err error
+	for ind, h := range hosts {
+		h = strings.TrimSpace(h)
+		addr := chAddr(h, opts.TLS != nil)
+		if acct.SSH != "" {
+			tunneled, e := openTunnel(acct.SSH, addr)
+			if e != nil {
+				return nil, e
+			}
+			addr = tunneled
+		}
+		hostOpts := *opts
+		hostOpts.Addr = []string{addr}
+		hostOpts.TLS = serverTLS(opts.TLS, h)
+		con := &chutils.Connect{Host: h, User: acct.User, Password: acct.Password}
+		con.DB = clickhouse.OpenDB(&hostOpts)
+		e := con.Ping()
+		if e == nil {
+			return con, nil
+		}
+		closeConnect(con)
+		if ind < len(hosts)-1 {
+			fmt.Printf("ClickHouse host %s failed, trying the next: %v\n", h, e)
+		}
+		err = e
+	}
+	return nil, err
+}
+
+// parseCompression returns the compression of the connection for the -compression method: lz4 or none.
+func parseCompression(method string) (*clickhouse.Compression, error) {
+	switch strings.ToLower(method) {
+	case "", "lz4":
+		return &clickhouse.Compression{Method: clickhouse.CompressionLZ4}, nil
+	case "none":
+		return nil, nil
+	case "zstd":
+		// clickhouse-go v2.0.14 compresses only with lz4
+		return nil, fmt.Errorf("-compression zstd needs a newer ClickHouse driver than fred2ch is built with " +
+			"(clickhouse-go v2.0.14); use lz4")
+	}
+	return nil, fmt.Errorf("-compression must be lz4 or none, not %s", method)
+}
+
+// parseSettings parses ClickHouse settings given as name=value,...  Values that are integers are passed as
+// integers.  The settings are added to the defaults.
+func parseSettings(settings string) (clickhouse.Settings, error) {
+	chSettings := clickhouse.Settings{"max_memory_usage": 40000000000}
+	if settings == "" {
+		return chSettings, nil
+	}
+	for _, setting := range strings.Split(settings, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(setting), "=")
+		if !ok || !identifier.MatchString(name) {
+			return nil, fmt.Errorf("ClickHouse settings must be name=value,..., not %s", settings)
+		}
+		if n, e := strconv.ParseInt(value, 10, 64); e == nil {
+			chSettings[name] = n
+			continue
+		}
+		chSettings[name] = value
+	}
+	return chSettings, nil
+}
+
+// closeConnect closes con, printing any error.
+func closeConnect(con *chutils.Connect) {
+	if e := con.Close(); e != nil {
+		fmt.Println(e)
+	}
+	closeTunnels()
+}
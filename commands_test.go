@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"reflect"
+	"testing"
+)
+
+func TestParseSettings(t *testing.T) {
+	const maxMemory = 40000000000
+	for _, tt := range []struct {
+		settings string
+		want     clickhouse.Settings
+		err      bool
+	}{
+		{settings: "", want: clickhouse.Settings{"max_memory_usage": maxMemory}},
+		{settings: "insert_quorum=2", want: clickhouse.Settings{"max_memory_usage": maxMemory,
+			"insert_quorum": int64(2)}},
+		{settings: "insert_quorum=2, insert_quorum_timeout=60000,load_balancing=in_order",
+			want: clickhouse.Settings{"max_memory_usage": maxMemory, "insert_quorum": int64(2),
+				"insert_quorum_timeout": int64(60000), "load_balancing": "in_order"}},
+		{settings: "max_memory_usage=1000", want: clickhouse.Settings{"max_memory_usage": int64(1000)}},
+		{settings: "insert_quorum", err: true},
+		{settings: "insert_quorum=2,", err: true},
+		{settings: "bad-name=1", err: true},
+		{settings: "=1", err: true},
+	} {
+		got, e := parseSettings(tt.settings)
+		if (e != nil) != tt.err {
+			t.Errorf("parseSettings(%q) error %v, want an error: %v", tt.settings, e, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSettings(%q) = %v, want %v", tt.settings, got, tt.want)
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, tt := range []struct {
+		method string
+		want   *clickhouse.Compression
+		err    bool
+	}{
+		{method: "", want: &clickhouse.Compression{Method: clickhouse.CompressionLZ4}},
+		{method: "LZ4", want: &clickhouse.Compression{Method: clickhouse.CompressionLZ4}},
+		{method: "none"},
+		{method: "zstd", err: true},
+		{method: "gzip", err: true},
+	} {
+		got, e := parseCompression(tt.method)
+		if (e != nil) != tt.err {
+			t.Errorf("%q: error %v, want an error: %v", tt.method, e, tt.err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: compression %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
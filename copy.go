@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"strings"
+	"time"
+)
+
+// copyCmd copies a series table to another table with the same schema, within ClickHouse.
+func copyCmd(args []string) error {
+	fs := flag.NewFlagSet("copy", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	tf := addTableFlags(fs)
+	fromPtr := fs.String("from", "", "string")
+	toPtr := fs.String("to", "", "string")
+	seriesPtr := fs.String("series", "", "string")
+	startPtr := fs.String("start", "", "string")
+	endPtr := fs.String("end", "", "string")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	if *fromPtr == "" || *toPtr == "" {
+		return fmt.Errorf("copy requires -from and -to")
+	}
+	if *fromPtr == *toPtr {
+		return fmt.Errorf("copy -from and -to must be different tables")
+	}
+	tc, e := tf.config()
+	if e != nil {
+		return e
+	}
+	where, e := copyFilter(*seriesPtr, *startPtr, *endPtr, tc)
+	if e != nil {
+		return e
+	}
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+	rows, e := copyTable(*fromPtr, *toPtr, where, con)
+	if e != nil {
+		return diagnose(e, cf.Host)
+	}
+	fmt.Printf("%d rows copied from %s to %s\n", rows, *fromPtr, *toPtr)
+	return nil
+}
+
+// copyFilter returns the WHERE clause that selects the rows of the series in the comma-separated list, from start
+// to end (YYYY-MM-DD), of a table configured by tc.  Blank arguments don't restrict the rows.
+func copyFilter(series string, start string, end string, tc *tableConfig) (string, error) {
+	var conds []string
+	if series != "" {
+		var ids []string
+		for _, id := range strings.Split(series, ",") {
+			if id = seriesID(id); id != "" {
+				ids = append(ids, quote(id))
+			}
+		}
+		conds = append(conds, fmt.Sprintf("%s IN (%s)", tc.seriesCol, strings.Join(ids, ", ")))
+	}
+	for _, bound := range []struct{ flag, date, op string }{{"start", start, ">="}, {"end", end, "<="}} {
+		if bound.date == "" {
+			continue
+		}
+		if _, e := time.Parse(fred.DateFormat, bound.date); e != nil {
+			return "", fmt.Errorf("-%s must be a date (YYYY-MM-DD), not %s", bound.flag, bound.date)
+		}
+		conds = append(conds, fmt.Sprintf("%s %s '%s'", tc.dateCol, bound.op, bound.date))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), nil
+}
+
+// copyTable replaces table to with a table of the same columns and engine as from holding the rows of from
+// selected by where.  It returns the number of rows copied.  Views fed by from, such as rollups, aren't copied.
+func copyTable(from string, to string, where string, con *chutils.Connect) (int, error) {
+	ddl := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", to),
+		fmt.Sprintf("CREATE TABLE %s AS %s", to, from),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s%s", to, from, where),
+	}
+	if e := execDDL(ddl, con); e != nil {
+		return 0, e
+	}
+	var rows uint64
+	if e := con.QueryRow(fmt.Sprintf("SELECT count() FROM %s", to)).Scan(&rows); e != nil {
+		return 0, e
+	}
+	return int(rows), nil
+}
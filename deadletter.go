@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	s "github.com/invertedv/chutils/sql"
+	"github.com/invertedv/fred2ch/chsink"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deadLetterSpec is the spec of the dead-letter table, which has a row for each observation a load rejected
+var deadLetterSpec = &tableSpec{
+	columns: []column{
+		{name: "table", chType: "String", comment: "destination table"},
+		{name: "seriesId", chType: "String", comment: "Fred II series ID"},
+		{name: "date", chType: "String", comment: "date as given by Fred II"},
+		{name: "value", chType: "String", comment: "value as given by Fred II"},
+		{name: "reason", chType: "String", comment: "why the observation was rejected"},
+		{name: "rejected", chType: "DateTime", comment: "time of the load"},
+	},
+	engine:  "MergeTree()",
+	orderBy: "table, seriesId, rejected",
+}
+
+// deadLetterDDL returns the statement that creates the dead-letter table, if it doesn't already exist.
+func deadLetterDDL(table string) []string {
+	return []string{deadLetterSpec.createSQL(table, true)}
+}
+
+// rejection is an observation a load rejected
+type rejection struct {
+	seriesId, date, value, reason string
+}
+
+// deadLetter collects the observations a load rejects.  A nil *deadLetter discards them.
+// A deadLetter is safe for concurrent use.
+type deadLetter struct {
+	mu   sync.Mutex
+	rows []rejection
+}
+
+// add records a rejected observation, with the date and value as given by Fred II.
+func (dl *deadLetter) add(seriesId, date, value, reason string) {
+	if dl == nil {
+		return
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.rows = append(dl.rows, rejection{seriesId, date, value, reason})
+}
+
+// flush writes the rejections of the load into table to the dead-letter table dest.
+func (dl *deadLetter) flush(dest string, table string, con *chutils.Connect) error {
+	if dl == nil {
+		return nil
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if len(dl.rows) == 0 {
+		return nil
+	}
+	wtr := s.NewWriter(dest, con)
+	defer func() {
+		if e := wtr.Close(); e != nil {
+			fmt.Println(e)
+		}
+	}()
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, r := range dl.rows {
+		line := fmt.Sprintf("%s,%s,%s,%s,%s,'%s'", quote(table), quote(r.seriesId), quote(r.date), quote(r.value),
+			quote(r.reason), now)
+		if _, e := wtr.Write([]byte(line)); e != nil {
+			return e
+		}
+	}
+	if e := wtr.Insert(); e != nil {
+		return chsink.Classify(e)
+	}
+	fmt.Printf("%d rejected observations of %s recorded in %s\n", len(dl.rows), table, dest)
+	dl.rows = nil
+	return nil
+}
+
+// quote returns str as a ClickHouse string literal.
+func quote(str string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(str) + "'"
+}
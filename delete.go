@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+)
+
+// deleteCmd removes the rows of one series from a table shared by several series.
+func deleteCmd(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	tf := addTableFlags(fs)
+	seriesPtr := fs.String("series", "", "string")
+	tablePtr := fs.String("table", "", "string")
+	registryPtr := fs.String("registry", "", "string")
+	namespacePtr := fs.String("namespace", "", "string")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := inNamespace(*namespacePtr, tablePtr, registryPtr); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	if *seriesPtr == "" || *tablePtr == "" {
+		return fmt.Errorf("delete requires -series and -table")
+	}
+	seriesId := seriesID(*seriesPtr)
+	tc, e := tf.config()
+	if e != nil {
+		return e
+	}
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+	if e := deleteSeries(seriesId, *tablePtr, *registryPtr, tc, con); e != nil {
+		return diagnose(e, cf.Host)
+	}
+	fmt.Printf("series %s deleted from %s\n", seriesId, *tablePtr)
+	return nil
+}
+
+// deleteSeries deletes the rows of seriesId from table and, if registry isn't blank, its loads into table from
+// the registry.  The deletes are mutations, which ClickHouse applies in the background.  It's an error if table
+// has no rows of seriesId, so a mistyped series isn't reported as deleted.
+func deleteSeries(seriesId string, table string, registry string, tc *tableConfig, con *chutils.Connect) error {
+	var rows uint64
+	if e := con.QueryRow(fmt.Sprintf("SELECT count() FROM %s WHERE %s = ?", table, tc.seriesCol), seriesId).
+		Scan(&rows); e != nil {
+		return e
+	}
+	if rows == 0 {
+		return fmt.Errorf("series %s isn't in %s", seriesId, table)
+	}
+	if e := deleteRows(seriesId, table, tc, con); e != nil {
+		return e
+	}
+	if registry == "" {
+		return nil
+	}
+	_, e := con.Exec(fmt.Sprintf("ALTER TABLE %s DELETE WHERE table = ? AND seriesId = ?", registry), table, seriesId)
+	return e
+}
+
+// deleteRows deletes the rows of seriesId from table.  The delete is a mutation, which ClickHouse applies in the
+// background to the rows table has when it's issued, so rows inserted after it are kept.
+func deleteRows(seriesId string, table string, tc *tableConfig, con *chutils.Connect) error {
+	_, e := con.Exec(fmt.Sprintf("ALTER TABLE %s DELETE WHERE %s = ?", table, tc.seriesCol), seriesId)
+	return e
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/invertedv/fred2ch/fred"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// diagnose maps common failures to an error that says what went wrong and how to fix it.  host is the
+// ClickHouse host the run connects to.  Errors that aren't recognized are returned unchanged.
+func diagnose(err error, host string) error {
+	if err == nil {
+		return nil
+	}
+	var (
+		apiErr *fred.APIError
+		urlErr *url.Error
+		opErr  *net.OpError
+	)
+	msg := err.Error()
+	advice := ""
+	switch {
+	case errors.As(err, &apiErr) && strings.Contains(strings.ToLower(apiErr.Message), "api_key"):
+		advice = "Fred II rejected the API key. Check -api: keys are 32 character lower-case alphanumeric strings, " +
+			"available at https://fred.stlouisfed.org/docs/api/api_key.html"
+	case errors.Is(err, fred.ErrSeriesNotFound):
+		advice = "Fred II has no such series. Check the -series id at https://fred.stlouisfed.org"
+	case errors.Is(err, fred.ErrRateLimited):
+		advice = "Fred II is rate limiting this API key. Wait a minute and try again"
+	case errors.As(err, &urlErr):
+		// http errors only come from Fred II, ClickHouse is reached over its native protocol
+		advice = "cannot reach Fred II at api.stlouisfed.org. Check network access and any proxy settings (HTTPS_PROXY)"
+	case strings.Contains(msg, "Authentication failed") || strings.Contains(msg, "code: 516"):
+		advice = "ClickHouse rejected the credentials. Check -user and -password"
+	case errors.As(err, &opErr) || strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "no such host") || strings.Contains(msg, "i/o timeout"):
+		advice = fmt.Sprintf("cannot reach ClickHouse at %s (port 9000). Check -host and that the server is running",
+			host)
+	default:
+		return err
+	}
+	return fmt.Errorf("%w\nhint: %s", err, advice)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// revision is a date on which two loads of a series differ
+type revision struct {
+	seriesId string
+	date     time.Time
+	a, b     float64
+	inA, inB bool
+}
+
+// diffCmd compares two loads of the same series, printing the row counts and the dates whose values differ.
+func diffCmd(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	tf := addTableFlags(fs)
+	tableAPtr := fs.String("table-a", "", "string")
+	tableBPtr := fs.String("table-b", "", "string")
+	seriesPtr := fs.String("series", "", "string")
+	maxPtr := fs.Int("max", 20, "int")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	if *tableAPtr == "" || *tableBPtr == "" {
+		return fmt.Errorf("diff requires -table-a and -table-b")
+	}
+	tc, e := tf.config()
+	if e != nil {
+		return e
+	}
+	where, e := copyFilter(*seriesPtr, "", "", tc)
+	if e != nil {
+		return e
+	}
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+
+	var rowsA, rowsB uint64
+	for _, t := range []struct {
+		table string
+		rows  *uint64
+	}{{*tableAPtr, &rowsA}, {*tableBPtr, &rowsB}} {
+		if e := con.QueryRow(fmt.Sprintf("SELECT count() FROM %s%s", t.table, where)).Scan(t.rows); e != nil {
+			return diagnose(e, cf.Host)
+		}
+	}
+	revs, e := diffTables(*tableAPtr, *tableBPtr, where, tc, con)
+	if e != nil {
+		return diagnose(e, cf.Host)
+	}
+	onlyA, onlyB, changed := 0, 0, 0
+	for _, r := range revs {
+		switch {
+		case !r.inB:
+			onlyA++
+		case !r.inA:
+			onlyB++
+		default:
+			changed++
+		}
+	}
+	fmt.Printf("A %s: %d rows\nB %s: %d rows\n", *tableAPtr, rowsA, *tableBPtr, rowsB)
+	fmt.Printf("%d dates only in A, %d only in B, %d with different values\n", onlyA, onlyB, changed)
+	if len(revs) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIES\tDATE\tA\tB\tCHANGE")
+	for ind, r := range revs {
+		if ind == *maxPtr {
+			break
+		}
+		a, b, change := "-", "-", "-"
+		if r.inA {
+			a = strconv.FormatFloat(r.a, 'g', -1, 64)
+		}
+		if r.inB {
+			b = strconv.FormatFloat(r.b, 'g', -1, 64)
+		}
+		if r.inA && r.inB {
+			change = strconv.FormatFloat(r.b-r.a, 'g', 6, 64)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.seriesId, r.date.Format(fred.DateFormat), a, b, change)
+	}
+	if e := w.Flush(); e != nil {
+		return e
+	}
+	if len(revs) > *maxPtr {
+		fmt.Printf("... and %d more (see -max)\n", len(revs)-*maxPtr)
+	}
+	return nil
+}
+
+// diffTables returns the dates, by series, on which the rows of tables a and b selected by where differ: dates
+// one of them lacks and dates whose values differ.
+func diffTables(a string, b string, where string, tc *tableConfig, con *chutils.Connect) ([]revision, error) {
+	side := func(table, value, in string) string {
+		return fmt.Sprintf("SELECT %s AS s, %s AS d, toFloat64(%s) AS %s, 1 AS %s FROM %s%s", tc.seriesCol, tc.dateCol,
+			tc.valueCol, value, in, table, where)
+	}
+	qry := fmt.Sprintf(`SELECT s, d, va, vb, inA, inB
+FROM (%s) AS a
+FULL OUTER JOIN (%s) AS b USING (s, d)
+WHERE inA = 0 OR inB = 0 OR va != vb
+ORDER BY s, d`, side(a, "va", "inA"), side(b, "vb", "inB"))
+	rows, e := con.Query(qry)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = rows.Close() }()
+	var revs []revision
+	for rows.Next() {
+		var r revision
+		var inA, inB uint8
+		if e := rows.Scan(&r.seriesId, &r.date, &r.a, &r.b, &inA, &inB); e != nil {
+			return nil, e
+		}
+		r.inA, r.inB = inA == 1, inB == 1
+		revs = append(revs, r)
+	}
+	return revs, rows.Err()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// maxSkew is the most the clocks of fred2ch and ClickHouse may differ by before doctor fails the check
+const maxSkew = 5 * time.Second
+
+// diagnosis is the result of one of doctor's checks
+type diagnosis struct {
+	check  string
+	status string // pass, fail or skip
+	detail string
+}
+
+// doctorCmd checks what a load needs -- Fred II, the API key, ClickHouse, the rights to create and drop tables and
+// the clocks -- printing pass or fail for each.
+func doctorCmd(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	dbPtr := fs.String("db", "", "string")
+	colorPtr := fs.Bool("color", false, "bool")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	var results []diagnosis
+	note := func(check string, detail string, err error) {
+		switch {
+		case err != nil:
+			results = append(results, diagnosis{check, "fail", strings.ReplaceAll(err.Error(), "\n", " ")})
+		default:
+			results = append(results, diagnosis{check, "pass", detail})
+		}
+	}
+
+	if cf.API == "" {
+		note("Fred II API key", "", fmt.Errorf("no -api given"))
+	} else {
+		start := time.Now()
+		info, e := fred.GetInfo("GDP", cf.API)
+		if e == nil {
+			note("Fred II API key", fmt.Sprintf("series %s fetched in %s", info.ID,
+				time.Since(start).Round(time.Millisecond)), nil)
+		} else {
+			note("Fred II API key", "", diagnose(e, cf.Host))
+		}
+	}
+
+	con, e := connect(&cf.account)
+	if e != nil {
+		note("ClickHouse connection", "", diagnose(e, cf.Host))
+		for _, check := range []string{"create and drop", "clock"} {
+			results = append(results, diagnosis{check, "skip", "no ClickHouse connection"})
+		}
+		return printDiagnoses(results, *colorPtr)
+	}
+	defer closeConnect(con)
+	var version string
+	if e := con.QueryRow("SELECT version()").Scan(&version); e != nil {
+		note("ClickHouse connection", "", diagnose(e, cf.Host))
+	} else {
+		note("ClickHouse connection", fmt.Sprintf("%s, version %s", cf.Host, version), nil)
+	}
+	note("create and drop", fmt.Sprintf("in database %s", dbName(*dbPtr)), checkCreateDrop(*dbPtr, con))
+	skew, e := clockSkew(con)
+	if e == nil && (skew > maxSkew || skew < -maxSkew) {
+		e = fmt.Errorf("the local clock is %s off ClickHouse's, more than %s", skew, maxSkew)
+	}
+	note("clock", fmt.Sprintf("%s off ClickHouse's", skew), e)
+	return printDiagnoses(results, *colorPtr)
+}
+
+// dbName returns the name of database db for messages.
+func dbName(db string) string {
+	if db == "" {
+		return "default for the user"
+	}
+	return db
+}
+
+// checkCreateDrop creates, writes and drops a scratch table in database db, the user's default if blank.
+func checkCreateDrop(db string, con *chutils.Connect) error {
+	table := fmt.Sprintf("fred2ch_doctor_%d", os.Getpid())
+	if db != "" {
+		table = db + "." + table
+	}
+	return execDDL([]string{
+		fmt.Sprintf("CREATE TABLE %s (x UInt8) ENGINE = MergeTree() ORDER BY x", table),
+		fmt.Sprintf("INSERT INTO %s VALUES (1)", table),
+		fmt.Sprintf("DROP TABLE %s", table),
+	}, con)
+}
+
+// clockSkew returns how far the local clock is ahead of the ClickHouse server's.  The round trip is split evenly,
+// and the server's time is only to the second.
+func clockSkew(con *chutils.Connect) (time.Duration, error) {
+	before := time.Now()
+	var server time.Time
+	if e := con.QueryRow("SELECT now()").Scan(&server); e != nil {
+		return 0, e
+	}
+	local := before.Add(time.Since(before) / 2)
+	return local.Sub(server).Round(time.Second), nil
+}
+
+// printDiagnoses prints the results of the checks, with the statuses in color if color is true.  It returns an
+// error if a check failed.
+func printDiagnoses(results []diagnosis, color bool) error {
+	colors := map[string]string{"pass": statusColors["ok"], "skip": statusColors["skipped"],
+		"fail": statusColors["failed"]}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	failed := 0
+	for _, r := range results {
+		status := strings.ToUpper(r.status)
+		if color {
+			status = colors[r.status] + status + "\x1b[0m"
+		}
+		if r.status == "fail" {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.check, status, r.detail)
+	}
+	if e := w.Flush(); e != nil {
+		return e
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/fred2ch/fred"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// enrichment is an extra column of the series table computed from the whole series.  The series is held in memory
+// and sorted by date before the columns are computed.
+type enrichment struct {
+	col     column
+	compute func(values []float64) []float64 // column values for the series values, which are in date order
+}
+
+// enrich computes the enrichment columns for obs, which are in date order.  The result has the column values for
+// each observation.
+func (tc *tableConfig) enrich(obs []fred.Observation) [][]float64 {
+	if len(tc.enrichments) == 0 {
+		return nil
+	}
+	values := make([]float64, len(obs))
+	for ind, o := range obs {
+		values[ind] = o.Value
+	}
+	extra := make([][]float64, len(obs))
+	for ind := range extra {
+		extra[ind] = make([]float64, len(tc.enrichments))
+	}
+	for col, en := range tc.enrichments {
+		for ind, v := range en.compute(values) {
+			extra[ind][col] = v
+		}
+	}
+	return extra
+}
+
+// formatExtra formats an enrichment value for insertion.
+func formatExtra(v float64) string {
+	if math.IsNaN(v) {
+		return "nan"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// parseZScore parses -zscore, which is "full" or the length of a trailing window.  It returns the window, which is
+// 0 for full-sample.
+func parseZScore(zscore string) (int, error) {
+	if strings.ToLower(zscore) == "full" {
+		return 0, nil
+	}
+	window, e := strconv.Atoi(zscore)
+	if e != nil || window < 2 {
+		return 0, fmt.Errorf("-zscore must be full or a window of at least 2 observations, not %s", zscore)
+	}
+	return window, nil
+}
+
+// zscoreEnrichment returns the z-score column.  If window is 0, the mean and standard deviation are those of the
+// whole series, otherwise they are those of the trailing window observations, ending with the current one.
+// Observations without a full window, or with no variation, get NaN.
+func zscoreEnrichment(window int) enrichment {
+	comment := "z-score of value over the full sample"
+	if window > 0 {
+		comment = fmt.Sprintf("z-score of value over the trailing %d observations", window)
+	}
+	return enrichment{
+		col: column{name: "zscore", chType: "Float64", comment: comment},
+		compute: func(values []float64) []float64 {
+			out := make([]float64, len(values))
+			if window == 0 {
+				mean, sd := meanSD(values)
+				for ind, v := range values {
+					out[ind] = zscore(v, mean, sd)
+				}
+				return out
+			}
+			for ind, v := range values {
+				if ind+1 < window {
+					out[ind] = math.NaN()
+					continue
+				}
+				mean, sd := meanSD(values[ind+1-window : ind+1])
+				out[ind] = zscore(v, mean, sd)
+			}
+			return out
+		},
+	}
+}
+
+// meanSD returns the mean and sample standard deviation of values.
+func meanSD(values []float64) (mean float64, sd float64) {
+	if len(values) < 2 {
+		return math.NaN(), math.NaN()
+	}
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		sd += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(values)-1))
+}
+
+// zscore returns the z-score of v, NaN if sd is zero.
+func zscore(v float64, mean float64, sd float64) float64 {
+	if sd == 0 {
+		return math.NaN()
+	}
+	return (v - mean) / sd
+}
+
+// pctRankEnrichment returns the percentile rank column: the fraction of the observations up to and including the
+// current one whose value is no greater than the current value.  Only history is used, so the rank of a past
+// observation doesn't change as the series grows.
+func pctRankEnrichment() enrichment {
+	return enrichment{
+		col: column{name: "pctRank", chType: "Float64",
+			comment: "fraction of observations to date with a value no greater than value"},
+		compute: func(values []float64) []float64 {
+			out := make([]float64, len(values))
+			// sorted holds the values to date in ascending order
+			sorted := make([]float64, 0, len(values))
+			for ind, v := range values {
+				at := sort.SearchFloat64s(sorted, v)
+				sorted = append(sorted, 0)
+				copy(sorted[at+1:], sorted[at:])
+				sorted[at] = v
+				// the number of values <= v
+				le := sort.Search(len(sorted), func(k int) bool { return sorted[k] > v })
+				out[ind] = float64(le) / float64(ind+1)
+			}
+			return out
+		},
+	}
+}
+
+// defaultOutlierWindow is the trailing window of -outlier if it gives none
+const defaultOutlierWindow = 60
+
+// parseOutlier parses -outlier, which is k or k:window.  It returns k and the window.
+func parseOutlier(outlier string) (float64, int, error) {
+	bad := fmt.Errorf("-outlier must be k or k:window, with k positive and a window of at least 3, not %s", outlier)
+	kStr, windowStr, hasWindow := strings.Cut(outlier, ":")
+	k, e := strconv.ParseFloat(kStr, 64)
+	if e != nil || k <= 0 {
+		return 0, 0, bad
+	}
+	window := defaultOutlierWindow
+	if hasWindow {
+		if window, e = strconv.Atoi(windowStr); e != nil || window < 3 {
+			return 0, 0, bad
+		}
+	}
+	return k, window, nil
+}
+
+// outlierEnrichment returns the outlier flag column: 1 if the value is more than k median absolute deviations from
+// the median of the trailing window observations before it, 0 otherwise.  Observations without a full window, or
+// whose window has no variation, get 0.
+func outlierEnrichment(k float64, window int) enrichment {
+	return enrichment{
+		col: column{name: "outlier", chType: "UInt8",
+			comment: fmt.Sprintf("1 if value is more than %g MADs from the median of the previous %d observations",
+				k, window)},
+		compute: func(values []float64) []float64 {
+			out := make([]float64, len(values))
+			for ind := window; ind < len(values); ind++ {
+				med, mad := medianMAD(values[ind-window : ind])
+				if mad > 0 && math.Abs(values[ind]-med) > k*mad {
+					out[ind] = 1
+				}
+			}
+			return out
+		},
+	}
+}
+
+// medianMAD returns the median of values and their median absolute deviation from it.
+func medianMAD(values []float64) (med float64, mad float64) {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	med = median(sorted)
+	for ind, v := range values {
+		sorted[ind] = math.Abs(v - med)
+	}
+	sort.Float64s(sorted)
+	return med, median(sorted)
+}
+
+// median returns the median of sorted, which is in ascending order and not empty.
+func median(sorted []float64) float64 {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
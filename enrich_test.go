@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/invertedv/fred2ch/fred"
+	"math"
+	"testing"
+	"time"
+)
+
+// sameFloats returns true if got and want are the same, to within rounding, with NaN equal to NaN.
+func sameFloats(got, want []float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for ind := range got {
+		if math.IsNaN(got[ind]) != math.IsNaN(want[ind]) {
+			return false
+		}
+		if !math.IsNaN(want[ind]) && math.Abs(got[ind]-want[ind]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEnrichments(t *testing.T) {
+	nan := math.NaN()
+	for _, tt := range []struct {
+		name   string
+		en     enrichment
+		values []float64
+		want   []float64
+	}{
+		{name: "zscore full", en: zscoreEnrichment(0), values: []float64{1, 2, 3}, want: []float64{-1, 0, 1}},
+		{name: "zscore full, one value", en: zscoreEnrichment(0), values: []float64{1}, want: []float64{nan}},
+		{name: "zscore full, no variation", en: zscoreEnrichment(0), values: []float64{2, 2},
+			want: []float64{nan, nan}},
+		{name: "zscore window", en: zscoreEnrichment(2), values: []float64{1, 3, 3, 1},
+			want: []float64{nan, 1 / math.Sqrt2, nan, -1 / math.Sqrt2}},
+		{name: "pctRank", en: pctRankEnrichment(), values: []float64{3, 1, 2, 2, 5},
+			want: []float64{1, 0.5, 2.0 / 3, 0.75, 1}},
+		{name: "outlier", en: outlierEnrichment(2, 3), values: []float64{1, 3, 5, 4, 20},
+			want: []float64{0, 0, 0, 0, 1}},
+		{name: "outlier, no variation", en: outlierEnrichment(2, 3), values: []float64{2, 2, 2, 20},
+			want: []float64{0, 0, 0, 0}},
+		{name: "outlier, short series", en: outlierEnrichment(2, 3), values: []float64{1, 100},
+			want: []float64{0, 0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.en.compute(tt.values); !sameFloats(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	var obs []fred.Observation
+	for ind, v := range []float64{1, 2, 3} {
+		obs = append(obs, fred.Observation{Date: time.Date(2020, 1, ind+1, 0, 0, 0, 0, time.UTC), Value: v})
+	}
+	if extra := (&tableConfig{}).enrich(obs); extra != nil {
+		t.Errorf("no enrichments gave %v", extra)
+	}
+	tc := &tableConfig{enrichments: []enrichment{zscoreEnrichment(0), pctRankEnrichment()}}
+	extra := tc.enrich(obs)
+	want := [][]float64{{-1, 1}, {0, 1}, {1, 1}}
+	if len(extra) != len(want) {
+		t.Fatalf("got %v, want %v", extra, want)
+	}
+	for ind := range want {
+		if !sameFloats(extra[ind], want[ind]) {
+			t.Errorf("row %d is %v, want %v", ind, extra[ind], want[ind])
+		}
+	}
+}
+
+func TestParseEnrichments(t *testing.T) {
+	for _, tt := range []struct {
+		zscore string
+		window int
+		err    bool
+	}{{"full", 0, false}, {"FULL", 0, false}, {"12", 12, false}, {"1", 0, true}, {"x", 0, true}} {
+		window, e := parseZScore(tt.zscore)
+		if (e != nil) != tt.err || window != tt.window {
+			t.Errorf("parseZScore(%q) = %d, %v", tt.zscore, window, e)
+		}
+	}
+	for _, tt := range []struct {
+		outlier string
+		k       float64
+		window  int
+		err     bool
+	}{{"3", 3, defaultOutlierWindow, false}, {"2.5:20", 2.5, 20, false}, {"0", 0, 0, true}, {"3:2", 0, 0, true},
+		{"x:10", 0, 0, true}} {
+		k, window, e := parseOutlier(tt.outlier)
+		if (e != nil) != tt.err || k != tt.k || window != tt.window {
+			t.Errorf("parseOutlier(%q) = %g, %d, %v", tt.outlier, k, window, e)
+		}
+	}
+}
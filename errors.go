@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"io"
+	"net"
+	"syscall"
+)
+
+var (
+	// ErrLocked is matched, using errors.Is, by errors from a table locked by another run
+	ErrLocked = errors.New("table is locked by another run")
+
+	// ErrSpooled is matched, using errors.Is, by errors from a load whose rows were spooled since ClickHouse was
+	// unavailable
+	ErrSpooled = errors.New("ClickHouse is unavailable, rows spooled")
+)
+
+// retryableCodes are the codes of ClickHouse exceptions that may not recur, such as those from merges falling
+// behind or a replica being briefly unavailable
+var retryableCodes = map[int32]bool{
+	159: true, // TIMEOUT_EXCEEDED
+	202: true, // TOO_MANY_SIMULTANEOUS_QUERIES
+	209: true, // SOCKET_TIMEOUT
+	210: true, // NETWORK_ERROR
+	242: true, // TABLE_IS_READ_ONLY
+	252: true, // TOO_MANY_PARTS
+	319: true, // UNKNOWN_STATUS_OF_INSERT
+	999: true, // KEEPER_EXCEPTION
+}
+
+// insertRejectedCodes are the codes of ClickHouse exceptions raised before an insert writes anything, so it can be
+// tried again without duplicating rows
+var insertRejectedCodes = map[int32]bool{
+	202: true, // TOO_MANY_SIMULTANEOUS_QUERIES
+	242: true, // TABLE_IS_READ_ONLY
+	252: true, // TOO_MANY_PARTS
+}
+
+// retryableInsert returns true if the insert that failed with err wrote nothing and may succeed if it's tried again.
+// An insert that timed out, lost its connection or has an unknown status may have been committed, and the table
+// doesn't deduplicate inserts, so trying it again could duplicate its rows.
+func retryableInsert(err error) bool {
+	var ex *clickhouse.Exception
+	if errors.As(err, &ex) {
+		return insertRejectedCodes[ex.Code]
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retryable returns true if the operation that failed with err may succeed if it's tried again.
+func retryable(err error) bool {
+	var ex *clickhouse.Exception
+	if errors.As(err, &ex) {
+		return retryableCodes[ex.Code]
+	}
+	return unavailable(err)
+}
+
+// unavailable returns true if err is a failure to reach ClickHouse, rather than an exception it raised.
+func unavailable(err error) bool {
+	var ex *clickhouse.Exception
+	if errors.As(err, &ex) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// kindError is an error that also matches the sentinel error kind
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
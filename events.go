@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// event is a lifecycle event of a load: started, skipped, fetched, inserted, finished or failed
+type event struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Series  string    `json:"series"`
+	Table   string    `json:"table"`
+	Rows    int       `json:"rows,omitempty"`    // observations fetched, rows in the batch inserted or rows loaded
+	Total   int       `json:"total,omitempty"`   // rows inserted so far, for inserted events
+	Seconds float64   `json:"seconds,omitempty"` // duration of the load, for finished and failed events
+	Error   string    `json:"error,omitempty"`   // for failed events
+}
+
+// eventSink writes events as JSON, one per line.  A nil *eventSink discards them.
+type eventSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // nil for stdout
+	failed bool      // true once a write has failed, so the failure is reported once
+}
+
+// stdout is the standard output fred2ch started with, which events sent to stdout are written to
+var stdout = os.Stdout
+
+// openEvents opens the destination of the events: stdout, tcp://host:port or unix:///path.  With stdout, the
+// human-readable messages go to stderr instead, so stdout carries nothing but events.  A blank dest returns a nil
+// sink.
+func openEvents(dest string) (*eventSink, error) {
+	switch {
+	case dest == "":
+		return nil, nil
+	case dest == "stdout":
+		os.Stdout = os.Stderr
+		return &eventSink{w: stdout}, nil
+	case strings.HasPrefix(dest, "tcp://"), strings.HasPrefix(dest, "unix://"):
+		network, addr, _ := strings.Cut(dest, "://")
+		conn, e := net.Dial(network, addr)
+		if e != nil {
+			return nil, fmt.Errorf("events: %w", e)
+		}
+		return &eventSink{w: conn, closer: conn}, nil
+	}
+	return nil, fmt.Errorf("events must go to stdout, tcp://host:port or unix:///path, not %s", dest)
+}
+
+// emit writes the event, stamped with the current time.
+func (es *eventSink) emit(ev event) {
+	if es == nil {
+		return
+	}
+	ev.Time = time.Now()
+	line, e := json.Marshal(ev)
+	if e != nil {
+		return
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if _, e := es.w.Write(append(line, '\n')); e != nil && !es.failed {
+		es.failed = true
+		fmt.Println("events:", e)
+	}
+}
+
+// close closes the destination of the events.
+func (es *eventSink) close() {
+	if es == nil || es.closer == nil {
+		return
+	}
+	if e := es.closer.Close(); e != nil {
+		fmt.Println(e)
+	}
+}
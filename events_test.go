@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEventsStdout(t *testing.T) {
+	out, e := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func(saved, savedStdout *os.File) { stdout, os.Stdout = saved, savedStdout }(stdout, os.Stdout)
+	stdout = out
+	es, e := openEvents("stdout")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if os.Stdout != os.Stderr {
+		t.Error("messages still go to stdout")
+	}
+	es.emit(event{Event: "started", Series: "GDP", Table: "t"})
+	es.close()
+	raw, e := os.ReadFile(out.Name())
+	if e != nil {
+		t.Fatal(e)
+	}
+	var ev event
+	if e := json.Unmarshal(raw, &ev); e != nil || ev.Event != "started" || ev.Series != "GDP" {
+		t.Errorf("stdout has %q, not the event", raw)
+	}
+	if _, e := openEvents("stderr"); e == nil {
+		t.Error("events to stderr weren't an error")
+	}
+}
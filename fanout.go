@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseFanout splits the comma-separated -fanout list of target tables.
+func parseFanout(list string) []string {
+	if list == "" {
+		return nil
+	}
+	var targets []string
+	for _, target := range strings.Split(list, ",") {
+		targets = append(targets, strings.TrimSpace(target))
+	}
+	return targets
+}
+
+// fanoutView returns the name of the materialized view that feeds target from the landing table.
+func fanoutView(target string) string {
+	return target + "_mv"
+}
+
+// landing returns the spec of the Null-engine landing table with the columns of ts.  It stores nothing, so it has
+// no order, indexes or projections.
+func (ts *tableSpec) landing() *tableSpec {
+	return &tableSpec{columns: ts.columns, engine: "Null()"}
+}
+
+// fanoutDrops returns the statements that drop the views feeding the fan-out targets.  They must run before the
+// landing table is dropped.  The targets themselves are kept.
+func fanoutDrops(tc *tableConfig) []string {
+	var ddl []string
+	for _, target := range tc.fanout {
+		ddl = append(ddl, fmt.Sprintf("DROP TABLE IF EXISTS %s", fanoutView(target)))
+	}
+	return ddl
+}
+
+// fanoutCreates returns the statements that create the fan-out targets of table that don't exist, as the series
+// table would be, delete the rows of seriesId already in them and create the views that feed them.  They must run
+// after the landing table is created.  The views select every column of the landing table, and a target keeps
+// those it has, so a target can be shaped as it needs.
+func fanoutCreates(seriesId string, table string, tc *tableConfig) []string {
+	var ddl []string
+	for _, target := range tc.fanout {
+		ddl = append(ddl, seriesSpec(seriesId, tc).createSQL(target, true),
+			fmt.Sprintf("ALTER TABLE %s DELETE WHERE %s = %s SETTINGS mutations_sync = 1", target, tc.seriesCol,
+				quote(seriesId)),
+			fmt.Sprintf("CREATE MATERIALIZED VIEW %s TO %s AS\nSELECT * FROM %s", fanoutView(target), target, table))
+	}
+	return ddl
+}
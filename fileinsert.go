@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/chsink"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileFormats are the values of -file-format, the formats of the files -file-dir inserts through, with the name
+// ClickHouse gives each
+var fileFormats = map[string]string{"values": "Values", "csv": "CSV"}
+
+// parseFileFormat returns the -file-format, values if it's blank.
+func parseFileFormat(format string) (string, error) {
+	switch format = strings.ToLower(format); {
+	case format == "":
+		return "values", nil
+	case format == "parquet":
+		return "", fmt.Errorf("-file-format parquet needs a Parquet writer, which fred2ch isn't built with; " +
+			"use values or csv")
+	case fileFormats[format] == "":
+		return "", fmt.Errorf("-file-format must be values or csv, not %s", format)
+	}
+	return format, nil
+}
+
+// fileInsert writes a batch to a file in j.fileDir, which must be the directory the ClickHouse server reads with
+// the file() table function, and has the server insert it from there.  The server parses the file itself rather
+// than receiving the rows over the connection, which is far faster for big backfills.  The file is in the
+// j.fileFmt format, Values if it's blank, and readable by the server, which may run as another user.  extra
+// holds the enrichment column values of each observation, and is nil if there are none.
+func fileInsert(batch []fred.Observation, extra [][]float64, j *job, con *chutils.Connect) error {
+	format := j.fileFmt
+	if format == "" {
+		format = "values"
+	}
+	f, e := os.CreateTemp(j.fileDir, "fred2ch_*."+format)
+	if e != nil {
+		return e
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	// CreateTemp makes the file readable by its owner only
+	if e := f.Chmod(0644); e != nil {
+		_ = f.Close()
+		return e
+	}
+	w := bufio.NewWriter(f)
+	var line bytes.Buffer
+	cw := csv.NewWriter(&line)
+	for ind, o := range batch {
+		var ex []float64
+		if extra != nil {
+			ex = extra[ind]
+		}
+		line.Reset()
+		if e := writeFileRow(&line, cw, format, j, o, ex); e != nil {
+			_ = f.Close()
+			return e
+		}
+		if _, e := w.Write(line.Bytes()); e != nil {
+			_ = f.Close()
+			return e
+		}
+		j.written += int64(line.Len())
+	}
+	if e := w.Flush(); e != nil {
+		_ = f.Close()
+		return e
+	}
+	if e := f.Close(); e != nil {
+		return e
+	}
+	qry := fmt.Sprintf("INSERT INTO %s SELECT * FROM file(%s, '%s', %s)", j.tc.insertTarget(j.table),
+		quote(filepath.Base(f.Name())), fileFormats[format], quote(seriesSpec(j.seriesId, j.tc).structure()))
+	_, e = con.Exec(qry)
+	return chsink.Classify(e)
+}
+
+// writeFileRow writes the row of observation o to line in format: a parenthesized Values row or a CSV record,
+// through cw, with \N for NULL.  Each ends with a newline.
+func writeFileRow(line *bytes.Buffer, cw *csv.Writer, format string, j *job, o fred.Observation,
+	extra []float64) error {
+	if format == "values" {
+		row, e := j.tc.row(j.seriesId, o, j.frequency, extra)
+		if e != nil {
+			return e
+		}
+		line.WriteString("(" + row + ")\n")
+		return nil
+	}
+	cells, e := j.tc.cells(j.seriesId, o, j.frequency, extra)
+	if e != nil {
+		return e
+	}
+	record := make([]string, len(cells))
+	for ind, c := range cells {
+		record[ind] = c.text
+		if c.null {
+			record[ind] = `\N`
+		}
+	}
+	if e := cw.Write(record); e != nil {
+		return e
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// structure returns the columns of ts as the structure argument of a table function, e.g. "a String, b Date".
+func (ts *tableSpec) structure() string {
+	cols := make([]string, 0, len(ts.columns))
+	for _, c := range ts.columns {
+		cols = append(cols, c.name+" "+c.chType)
+	}
+	return strings.Join(cols, ", ")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/invertedv/fred2ch/fred"
+	"testing"
+	"time"
+)
+
+func TestParseFileFormat(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		want   string
+		err    bool
+	}{
+		{format: "", want: "values"},
+		{format: "values", want: "values"},
+		{format: "CSV", want: "csv"},
+		{format: "parquet", err: true},
+		{format: "tsv", err: true},
+	} {
+		got, e := parseFileFormat(tt.format)
+		if (e != nil) != tt.err {
+			t.Errorf("%q: error %v, want an error: %v", tt.format, e, tt.err)
+		}
+		if got != tt.want {
+			t.Errorf("%q: format %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestWriteFileRow(t *testing.T) {
+	date := time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name     string
+		format   string
+		seriesId string
+		o        fred.Observation
+		nulls    string
+		want     string
+	}{
+		{name: "values", format: "values", seriesId: "GDP", o: fred.Observation{Date: date, Value: 1.25},
+			want: "('GDP','2020-04-01',1.25)\n"},
+		{name: "values NULL", format: "values", seriesId: "GDP", o: fred.Observation{Date: date, Missing: true},
+			nulls: "null", want: "('GDP','2020-04-01',NULL)\n"},
+		{name: "csv", format: "csv", seriesId: "GDP", o: fred.Observation{Date: date, Value: 1.25},
+			want: "GDP,2020-04-01,1.25\n"},
+		{name: "csv quoted", format: "csv", seriesId: `A,"B"`, o: fred.Observation{Date: date, Value: 2},
+			want: `"A,""B""",2020-04-01,2` + "\n"},
+		{name: "csv NULL", format: "csv", seriesId: "GDP", o: fred.Observation{Date: date, Missing: true},
+			nulls: "null", want: `GDP,2020-04-01,\N` + "\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &job{seriesId: tt.seriesId, frequency: "Q", tc: newTableConfig()}
+			j.tc.nulls = tt.nulls
+			var line bytes.Buffer
+			if e := writeFileRow(&line, csv.NewWriter(&line), tt.format, j, tt.o, nil); e != nil {
+				t.Fatal(e)
+			}
+			if line.String() != tt.want {
+				t.Errorf("row %q, want %q", line.String(), tt.want)
+			}
+		})
+	}
+}
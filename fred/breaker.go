@@ -0,0 +1,80 @@
+package fred
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Breaker.Do once the breaker has tripped and is not pausing.
+var ErrCircuitOpen = errors.New("circuit breaker open: too many consecutive failures")
+
+// Breaker is a circuit breaker for runs that make many Fred II or ClickHouse calls.  After Threshold
+// consecutive failures it trips.  A tripped breaker either:
+//   - pauses: if Cooldown > 0, the next call waits out the cooldown and is then tried.  Success closes the
+//     breaker, failure trips it again.
+//   - aborts: if Cooldown is 0, every later call returns ErrCircuitOpen without being tried.
+//
+// A Breaker is safe for concurrent use.
+type Breaker struct {
+	Threshold int           // consecutive failures that trip the breaker. 0 means never trip.
+	Cooldown  time.Duration // pause after tripping. 0 means abort instead.
+
+	mu       sync.Mutex
+	failures int       // consecutive failures so far
+	opened   time.Time // when the breaker last tripped
+}
+
+// NewBreaker returns a Breaker that trips after threshold consecutive failures.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// Do calls fn unless the breaker is open, recording whether it failed.
+func (b *Breaker) Do(fn func() error) error {
+	if e := b.wait(); e != nil {
+		return e
+	}
+	e := fn()
+	b.record(e)
+	return e
+}
+
+// Open returns true if the breaker has tripped.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Threshold > 0 && b.failures >= b.Threshold
+}
+
+// wait blocks until a call may proceed, or returns ErrCircuitOpen if the breaker aborts.
+func (b *Breaker) wait() error {
+	b.mu.Lock()
+	open := b.Threshold > 0 && b.failures >= b.Threshold
+	remaining := b.Cooldown - time.Since(b.opened)
+	b.mu.Unlock()
+	if !open {
+		return nil
+	}
+	if b.Cooldown == 0 {
+		return ErrCircuitOpen
+	}
+	if remaining > 0 {
+		time.Sleep(remaining)
+	}
+	return nil
+}
+
+// record updates the count of consecutive failures with the result of a call.
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.Threshold > 0 && b.failures >= b.Threshold {
+		b.opened = time.Now()
+	}
+}
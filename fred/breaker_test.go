@@ -0,0 +1,66 @@
+package fred
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	fail := errors.New("fail")
+	for _, tt := range []struct {
+		name      string
+		threshold int
+		results   []error // results of the calls made before the last
+		open      bool    // true if the last call isn't made
+	}{
+		{name: "never trips", threshold: 0, results: []error{fail, fail, fail}},
+		{name: "below threshold", threshold: 3, results: []error{fail, fail}},
+		{name: "trips", threshold: 2, results: []error{fail, fail}, open: true},
+		{name: "success resets", threshold: 2, results: []error{fail, nil, fail}},
+		{name: "trips after a success", threshold: 2, results: []error{nil, fail, fail}, open: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(tt.threshold, 0)
+			for _, r := range tt.results {
+				r := r
+				if e := b.Do(func() error { return r }); e != r {
+					t.Fatalf("call returned %v, want %v", e, r)
+				}
+			}
+			if b.Open() != tt.open {
+				t.Errorf("open %v, want %v", b.Open(), tt.open)
+			}
+			called := false
+			e := b.Do(func() error {
+				called = true
+				return nil
+			})
+			if tt.open && (!errors.Is(e, ErrCircuitOpen) || called) {
+				t.Errorf("open breaker returned %v and called fn: %v", e, called)
+			}
+			if !tt.open && (e != nil || !called) {
+				t.Errorf("closed breaker returned %v and called fn: %v", e, called)
+			}
+		})
+	}
+}
+
+func TestBreakerCooldown(t *testing.T) {
+	cooldown := 50 * time.Millisecond
+	b := NewBreaker(1, cooldown)
+	_ = b.Do(func() error { return errors.New("fail") })
+	if !b.Open() {
+		t.Fatal("breaker didn't trip")
+	}
+	start := time.Now()
+	if e := b.Do(func() error { return nil }); e != nil {
+		t.Fatal(e)
+	}
+	if waited := time.Since(start); waited < cooldown/2 {
+		t.Errorf("waited %s after tripping, want about %s", waited, cooldown)
+	}
+	if b.Open() {
+		t.Error("a success didn't close the breaker")
+	}
+}
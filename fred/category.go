@@ -0,0 +1,38 @@
+package fred
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// categorySeriesPath and categoryChildrenPath are the endpoints for the series and the child categories of a
+// category
+const (
+	categorySeriesPath   = "category/series"
+	categoryChildrenPath = "category/children"
+)
+
+// Category is a category of Fred II's tree of categories
+type Category struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	ParentID int    `json:"parent_id"`
+}
+
+// GetCategorySeries returns the metadata of the series in the category categoryId, but not in its children.
+func GetCategorySeries(categoryId int, apiKey string) ([]SeriesInfo, error) {
+	return listSeries(categorySeriesPath, url.Values{"category_id": {strconv.Itoa(categoryId)}}, 0, apiKey)
+}
+
+// GetCategoryChildren returns the child categories of the category categoryId.  The root category is 0.
+func GetCategoryChildren(categoryId int, apiKey string) ([]Category, error) {
+	var resp struct {
+		Categories []Category `json:"categories"`
+	}
+	q := url.Values{"category_id": {strconv.Itoa(categoryId)}}
+	if e := getJSON(context.Background(), categoryChildrenPath, q, apiKey, &resp); e != nil {
+		return nil, e
+	}
+	return resp.Categories, nil
+}
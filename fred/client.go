@@ -0,0 +1,115 @@
+package fred
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxIdlePerHost is how many idle connections to Fred II are kept open for reuse.  It covers the concurrent
+// requests of a load's page workers and of the loads run at once, which http.DefaultTransport's 2 doesn't, so
+// connections beyond 2 would be closed after each request and opened again for the next.
+const maxIdlePerHost = 32
+
+var (
+	clientMu      sync.RWMutex
+	defaultClient = &http.Client{Transport: Transport()}
+	client        = defaultClient
+)
+
+// Transport returns a new transport suited to the many requests of mirroring Fred II: it negotiates HTTP/2 and
+// keeps enough connections alive between requests that each isn't made on a new one.  Clients given to SetClient
+// should start from it.
+func Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// setting TLSClientConfig on the transport would otherwise turn HTTP/2 off
+	t.ForceAttemptHTTP2 = true
+	t.MaxIdleConns = 2 * maxIdlePerHost
+	t.MaxIdleConnsPerHost = maxIdlePerHost
+	t.IdleConnTimeout = 2 * time.Minute
+	return t
+}
+
+// SetClient makes the package issue its later requests with c, e.g. a client that trusts the certificates of a
+// proxy.  A nil c restores the package's client, which shares one Transport across all requests.
+func SetClient(c *http.Client) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if c == nil {
+		c = defaultClient
+	}
+	client = c
+}
+
+// httpClient returns the client requests are issued with.
+func httpClient() *http.Client {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return client
+}
+
+// Usage is the use the package has made of Fred II
+type Usage struct {
+	Requests int64 // requests made
+	Bytes    int64 // bytes of responses read
+}
+
+// used is the Usage so far, updated atomically
+var used Usage
+
+// TotalUsage returns the use the package has made of Fred II since the program started.  The difference between
+// two calls is the use in between.
+func TotalUsage() Usage {
+	return Usage{Requests: atomic.LoadInt64(&used.Requests), Bytes: atomic.LoadInt64(&used.Bytes)}
+}
+
+// usageKey is the context key of the Usage a request is counted in besides the package's
+type usageKey struct{}
+
+// withUsage returns ctx with u, if it isn't nil, as the Usage its requests are counted in besides the package's.
+func withUsage(ctx context.Context, u *Usage) context.Context {
+	if u == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+// countRequest adds a request to the package's Usage and to that of ctx, if it has one, and returns that.
+func countRequest(ctx context.Context) *Usage {
+	atomic.AddInt64(&used.Requests, 1)
+	u, _ := ctx.Value(usageKey{}).(*Usage)
+	if u != nil {
+		atomic.AddInt64(&u.Requests, 1)
+	}
+	return u
+}
+
+// countedBody is a response body that adds the bytes read from it to the package's Usage and to also, if it isn't
+// nil
+type countedBody struct {
+	io.ReadCloser
+	also *Usage
+}
+
+// maxDrain is the most of an unread response body Close reads so the connection can be reused
+const maxDrain = 64 << 10
+
+// Close reads what's left of the body, if it's short, before closing it.  An HTTP/1.1 connection is only reused
+// once its response has been read to the end, which a failed decode doesn't do.
+func (b countedBody) Close() error {
+	_, _ = io.CopyN(io.Discard, b, maxDrain)
+	return b.ReadCloser.Close()
+}
+
+// Read reads from the body, counting the bytes.
+func (b countedBody) Read(p []byte) (int, error) {
+	n, e := b.ReadCloser.Read(p)
+	atomic.AddInt64(&used.Bytes, int64(n))
+	if b.also != nil {
+		atomic.AddInt64(&b.also.Bytes, int64(n))
+	}
+	return n, e
+}
@@ -0,0 +1,73 @@
+package fred
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	debugMu  sync.RWMutex
+	debugOut io.Writer
+)
+
+// SetDebug logs each later request the package makes to w: its URL with the API key redacted, the protocol and
+// status code, the size of the response and the time to the response's headers and to its end.  A nil w stops the
+// logging.
+func SetDebug(w io.Writer) {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	debugOut = w
+}
+
+// debugWriter returns where requests are logged, nil if they aren't.
+func debugWriter() io.Writer {
+	debugMu.RLock()
+	defer debugMu.RUnlock()
+	return debugOut
+}
+
+// debugResponse logs the request for requestURL, made at start, which returned resp and err.  If the request
+// succeeded, the logging waits for the response body to be closed, so it has the size and time of the whole
+// response.
+func debugResponse(requestURL string, start time.Time, resp *http.Response, err error) (*http.Response, error) {
+	w := debugWriter()
+	if w == nil {
+		return resp, err
+	}
+	if err != nil {
+		fmt.Fprintf(w, "fred: GET %s failed after %s: %v\n", requestURL, time.Since(start).Round(time.Millisecond), err)
+		return resp, err
+	}
+	resp.Body = &debugBody{ReadCloser: resp.Body, w: w, requestURL: requestURL, status: resp.Proto + " " + resp.Status,
+		start: start, headers: time.Since(start)}
+	return resp, nil
+}
+
+// debugBody is a response body that counts the bytes read from it and logs the request when it's closed
+type debugBody struct {
+	io.ReadCloser
+	w          io.Writer
+	requestURL string
+	status     string
+	start      time.Time
+	headers    time.Duration // time to the response's headers
+	size       int64         // bytes read
+}
+
+// Read reads from the body, counting the bytes.
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, e := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	return n, e
+}
+
+// Close closes the body and logs the request.
+func (b *debugBody) Close() error {
+	e := b.ReadCloser.Close()
+	fmt.Fprintf(b.w, "fred: GET %s: %s, %d bytes, headers in %s, done in %s\n", b.requestURL, b.status, b.size,
+		b.headers.Round(time.Millisecond), time.Since(b.start).Round(time.Millisecond))
+	return e
+}
@@ -0,0 +1,99 @@
+package fred
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// jsonFields returns the json names of the fields of the struct v.
+func jsonFields(v interface{}) map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(v)
+	for ind := 0; ind < t.NumField(); ind++ {
+		name, _, _ := strings.Cut(t.Field(ind).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+var (
+	// seriesFields are the fields expected in an observations response, which also has the error fields if it's
+	// an error
+	seriesFields = jsonFields(Series{})
+
+	// datumFields are the fields expected in an observation
+	datumFields = jsonFields(Datum{})
+
+	// datumRequired are the fields every observation must have
+	datumRequired = []string{"date", "value"}
+)
+
+// drift reports the ways a response differs from what the package expects to Options' Drift function, each once.
+type drift struct {
+	report func(problem string) error
+	seen   map[string]bool
+}
+
+// newDrift returns the drift checker for a response for seriesId, nil if opts has no Drift function.
+func newDrift(seriesId string, opts *Options) *drift {
+	if opts == nil || opts.Drift == nil {
+		return nil
+	}
+	return &drift{report: func(problem string) error { return opts.Drift(seriesId, problem) },
+		seen: make(map[string]bool)}
+}
+
+// flag reports problem, unless it has been reported already.
+func (dr *drift) flag(problem string) error {
+	if dr.seen[problem] {
+		return nil
+	}
+	dr.seen[problem] = true
+	return dr.report(problem)
+}
+
+// checkHeader flags the fields of the response outside the observations that the package doesn't know.
+func (dr *drift) checkHeader(header map[string]json.RawMessage) error {
+	if dr == nil {
+		return nil
+	}
+	for key := range header {
+		if !seriesFields[key] && key != "error_code" && key != "error_message" {
+			if e := dr.flag(fmt.Sprintf("unexpected field %q in response", key)); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// decodeDatum decodes the next observation from dec, flagging fields the package doesn't know and required fields
+// that are missing.
+func (dr *drift) decodeDatum(dec *json.Decoder, d *Datum) error {
+	if dr == nil {
+		return dec.Decode(d)
+	}
+	var raw map[string]json.RawMessage
+	if e := dec.Decode(&raw); e != nil {
+		return e
+	}
+	for key := range raw {
+		if !datumFields[key] {
+			if e := dr.flag(fmt.Sprintf("unexpected field %q in observations", key)); e != nil {
+				return e
+			}
+		}
+	}
+	for _, key := range datumRequired {
+		if _, ok := raw[key]; !ok {
+			if e := dr.flag(fmt.Sprintf("observation without field %q", key)); e != nil {
+				return e
+			}
+		}
+	}
+	return unmarshalHeader(raw, d)
+}
@@ -0,0 +1,60 @@
+package fred
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		body     string
+		problems []string
+	}{
+		{name: "as expected", body: `{"count":1,"units":"lin","observations":[{"realtime_start":"2020-01-01",` +
+			`"realtime_end":"2020-01-01","date":"2020-01-01","value":"1"}]}`},
+		{name: "unknown header field", body: `{"count":1,"vintage":"x","observations":` +
+			`[{"date":"2020-01-01","value":"1"}]}`, problems: []string{`unexpected field "vintage" in response`}},
+		{name: "unknown observation field, once", body: `{"observations":[{"date":"2020-01-01","value":"1",` +
+			`"flag":"p"},{"date":"2020-02-01","value":"2","flag":"p"}]}`,
+			problems: []string{`unexpected field "flag" in observations`}},
+		{name: "missing fields", body: `{"observations":[{"date":"2020-01-01"},{"value":"2"}]}`,
+			problems: []string{`observation without field "date"`, `observation without field "value"`}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var problems []string
+			opts := &Options{Drift: func(seriesId string, problem string) error {
+				if seriesId != "GDP" {
+					t.Errorf("problem reported for %s", seriesId)
+				}
+				problems = append(problems, problem)
+				return nil
+			}}
+			if _, e := decode(strings.NewReader(tt.body), newDrift("GDP", opts), func(d Datum) error {
+				return nil
+			}); e != nil {
+				t.Fatal(e)
+			}
+			sort.Strings(problems)
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Errorf("problems %q, want %q", problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestDriftFails(t *testing.T) {
+	strict := errors.New("strict")
+	opts := &Options{Drift: func(string, string) error { return strict }}
+	_, e := decode(strings.NewReader(`{"observations":[{"date":"2020-01-01","value":"1","flag":"p"}]}`),
+		newDrift("GDP", opts), func(d Datum) error { return nil })
+	if e != strict {
+		t.Errorf("decode returned %v, want the error of Drift", e)
+	}
+	if newDrift("GDP", nil) != nil || newDrift("GDP", &Options{}) != nil {
+		t.Error("a drift checker without a Drift function")
+	}
+}
@@ -0,0 +1,51 @@
+package fred
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrSeriesNotFound is matched, using errors.Is, by errors for series Fred II doesn't have
+	ErrSeriesNotFound = errors.New("series not found")
+
+	// ErrRateLimited is matched, using errors.Is, by errors for requests Fred II refused because too many were made
+	ErrRateLimited = errors.New("rate limited by Fred II")
+)
+
+// APIError is the error structure Fred II returns in place of data, for instance for an invalid API key or a
+// series that does not exist.
+type APIError struct {
+	Code    int    `json:"error_code"`    // http status code
+	Message string `json:"error_message"` // Fred II's description of the problem
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Fred II error %d: %s", e.Code, e.Message)
+}
+
+// Is reports whether the error is one of the sentinel errors ErrSeriesNotFound or ErrRateLimited.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrSeriesNotFound:
+		return strings.Contains(strings.ToLower(e.Message), "series does not exist")
+	case ErrRateLimited:
+		return e.Code == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// statusError returns the error for a response with a status other than OK that isn't a Fred II error structure.
+// what is the subject of the request.
+func statusError(resp *http.Response, what string) error {
+	e := fmt.Errorf("Fred II returned %s for %s", resp.Status, what)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%v: %w", e, ErrRateLimited)
+	case http.StatusNotFound:
+		return fmt.Errorf("%v: %w", e, ErrSeriesNotFound)
+	}
+	return e
+}
@@ -0,0 +1,291 @@
+package fred
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Formula defines a derived series as an arithmetic expression over other series, e.g.
+//
+//	real_rate = DGS10 - T10YIE
+//
+// Expressions may use numbers, series IDs, + - * /, parentheses and the functions log, exp and abs.
+type Formula struct {
+	Name   string   // name of the derived series
+	Expr   string   // the expression
+	Series []string // series the expression refers to, in order of first appearance
+
+	root node
+}
+
+// ParseFormula parses a definition of the form "name = expression".
+func ParseFormula(def string) (*Formula, error) {
+	name, expr, ok := strings.Cut(def, "=")
+	name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+	if !ok || name == "" || expr == "" {
+		return nil, fmt.Errorf("formula %q is not of the form name = expression", def)
+	}
+	p := &parser{tokens: tokenize(expr)}
+	root, e := p.expr()
+	if e != nil {
+		return nil, fmt.Errorf("formula %s: %w", name, e)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("formula %s: unexpected %s", name, p.tokens[p.pos])
+	}
+	f := &Formula{Name: name, Expr: expr, root: root}
+	seen := make(map[string]bool)
+	root.refs(func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			f.Series = append(f.Series, id)
+		}
+	})
+	if len(f.Series) == 0 {
+		return nil, fmt.Errorf("formula %s refers to no series", name)
+	}
+	return f, nil
+}
+
+// String returns the definition of the formula.
+func (f *Formula) String() string {
+	return fmt.Sprintf("%s = %s", f.Name, f.Expr)
+}
+
+// Evaluate computes the derived series from the observations of the series it refers to.  The series are
+// aligned by date: the derived series has an observation on each date that every series has a value for.
+// Dates where the result isn't a finite number, e.g. division by zero, are dropped.
+func (f *Formula) Evaluate(series map[string][]Observation) ([]Observation, error) {
+	values := make(map[string]map[int64]float64)
+	for _, id := range f.Series {
+		obs, ok := series[id]
+		if !ok {
+			return nil, fmt.Errorf("formula %s: no observations for series %s", f.Name, id)
+		}
+		values[id] = make(map[int64]float64)
+		for _, o := range obs {
+			if !o.Missing {
+				values[id][o.Date.Unix()] = o.Value
+			}
+		}
+	}
+	var out []Observation
+	env := make(map[string]float64)
+	for _, o := range series[f.Series[0]] {
+		key, complete := o.Date.Unix(), true
+		for _, id := range f.Series {
+			v, ok := values[id][key]
+			if !ok {
+				complete = false
+				break
+			}
+			env[id] = v
+		}
+		if !complete {
+			continue
+		}
+		if v := f.root.eval(env); !math.IsNaN(v) && !math.IsInf(v, 0) {
+			out = append(out, Observation{Date: o.Date, Value: v})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	return out, nil
+}
+
+// Fetch pulls the series the formula refers to and evaluates it.
+func (f *Formula) Fetch(apiKey string, opts *Options) ([]Observation, error) {
+	series := make(map[string][]Observation)
+	for _, id := range f.Series {
+		obs, e := GetObservations(id, apiKey, opts)
+		if e != nil {
+			return nil, e
+		}
+		series[id] = obs
+	}
+	return f.Evaluate(series)
+}
+
+// node is a node of a parsed expression
+type node interface {
+	eval(env map[string]float64) float64
+	refs(fn func(id string))
+}
+
+type number float64
+
+func (n number) eval(map[string]float64) float64 { return float64(n) }
+func (n number) refs(func(string))               {}
+
+type ref string
+
+func (r ref) eval(env map[string]float64) float64 { return env[string(r)] }
+func (r ref) refs(fn func(string))                { fn(string(r)) }
+
+type unary struct {
+	op  string
+	arg node
+}
+
+func (u *unary) eval(env map[string]float64) float64 {
+	v := u.arg.eval(env)
+	switch u.op {
+	case "-":
+		return -v
+	case "log":
+		return math.Log(v)
+	case "exp":
+		return math.Exp(v)
+	case "abs":
+		return math.Abs(v)
+	}
+	return v
+}
+func (u *unary) refs(fn func(string)) { u.arg.refs(fn) }
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (b *binary) eval(env map[string]float64) float64 {
+	l, r := b.left.eval(env), b.right.eval(env)
+	switch b.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	}
+	return l / r
+}
+func (b *binary) refs(fn func(string)) {
+	b.left.refs(fn)
+	b.right.refs(fn)
+}
+
+// functions are the functions expressions may call
+var functions = map[string]bool{"log": true, "exp": true, "abs": true}
+
+// tokenize splits an expression into numbers, identifiers and single-character operators.
+func tokenize(expr string) []string {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '.':
+			j := i
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) ||
+				expr[j] == '_' || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+// parser is a recursive-descent parser over the tokens of an expression
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// expr parses term {(+|-) term}.
+func (p *parser) expr() (node, error) {
+	left, e := p.term()
+	if e != nil {
+		return nil, e
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.next()[0]
+		right, e := p.term()
+		if e != nil {
+			return nil, e
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term parses factor {(*|/) factor}.
+func (p *parser) term() (node, error) {
+	left, e := p.factor()
+	if e != nil {
+		return nil, e
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := p.next()[0]
+		right, e := p.factor()
+		if e != nil {
+			return nil, e
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// factor parses a number, series ID, function call, parenthesized expression or negated factor.
+func (p *parser) factor() (node, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "-":
+		arg, e := p.factor()
+		if e != nil {
+			return nil, e
+		}
+		return &unary{op: "-", arg: arg}, nil
+	case tok == "(":
+		n, e := p.expr()
+		if e != nil {
+			return nil, e
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return n, nil
+	case functions[strings.ToLower(tok)] && p.peek() == "(":
+		p.next()
+		arg, e := p.expr()
+		if e != nil {
+			return nil, e
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ) after %s", tok)
+		}
+		return &unary{op: strings.ToLower(tok), arg: arg}, nil
+	}
+	if v, e := strconv.ParseFloat(tok, 64); e == nil {
+		return number(v), nil
+	}
+	c := rune(tok[0])
+	if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+		return nil, fmt.Errorf("unexpected %s", tok)
+	}
+	return ref(strings.ToUpper(tok)), nil
+}
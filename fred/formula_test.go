@@ -0,0 +1,103 @@
+package fred
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseFormula(t *testing.T) {
+	for _, tt := range []struct {
+		def    string
+		name   string
+		series []string
+		env    map[string]float64
+		want   float64
+		err    bool
+	}{
+		{def: "real_rate = DGS10 - T10YIE", name: "real_rate", series: []string{"DGS10", "T10YIE"},
+			env: map[string]float64{"DGS10": 4, "T10YIE": 2.5}, want: 1.5},
+		{def: "x = a + b * c", name: "x", series: []string{"A", "B", "C"},
+			env: map[string]float64{"A": 1, "B": 2, "C": 3}, want: 7},
+		{def: "x = (a + b) * c", name: "x", series: []string{"A", "B", "C"},
+			env: map[string]float64{"A": 1, "B": 2, "C": 3}, want: 9},
+		{def: "x = a - b - c", name: "x", series: []string{"A", "B", "C"},
+			env: map[string]float64{"A": 10, "B": 2, "C": 3}, want: 5},
+		{def: "x = a / b / 2", name: "x", series: []string{"A", "B"},
+			env: map[string]float64{"A": 12, "B": 3}, want: 2},
+		{def: "x = -a * 2", name: "x", series: []string{"A"}, env: map[string]float64{"A": 3}, want: -6},
+		{def: "x = a * a + a", name: "x", series: []string{"A"}, env: map[string]float64{"A": 3}, want: 12},
+		{def: "x = 100 * LOG(gdp) - abs(cpi)", name: "x", series: []string{"GDP", "CPI"},
+			env: map[string]float64{"GDP": math.E, "CPI": -5}, want: 95},
+		{def: "x = exp(0) * a", name: "x", series: []string{"A"}, env: map[string]float64{"A": 4}, want: 4},
+		{def: "x = 1.5e2 * a", name: "x", series: []string{"A"}, env: map[string]float64{"A": 2}, want: 300},
+		{def: "x = ", err: true},
+		{def: "= a", err: true},
+		{def: "a + b", err: true},
+		{def: "x = 1 + 2", err: true},
+		{def: "x = (a + b", err: true},
+		{def: "x = a + b)", err: true},
+		{def: "x = a +", err: true},
+		{def: "x = log(a", err: true},
+		{def: "x = a $ b", err: true},
+	} {
+		f, e := ParseFormula(tt.def)
+		if tt.err {
+			if e == nil {
+				t.Errorf("ParseFormula(%q) isn't an error", tt.def)
+			}
+			continue
+		}
+		if e != nil {
+			t.Errorf("ParseFormula(%q): %v", tt.def, e)
+			continue
+		}
+		if f.Name != tt.name {
+			t.Errorf("ParseFormula(%q) is named %s, want %s", tt.def, f.Name, tt.name)
+		}
+		if len(f.Series) != len(tt.series) {
+			t.Errorf("ParseFormula(%q) refers to %v, want %v", tt.def, f.Series, tt.series)
+			continue
+		}
+		for ind := range f.Series {
+			if f.Series[ind] != tt.series[ind] {
+				t.Errorf("ParseFormula(%q) refers to %v, want %v", tt.def, f.Series, tt.series)
+				break
+			}
+		}
+		if got := f.root.eval(tt.env); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s evaluates to %g, want %g", tt.def, got, tt.want)
+		}
+	}
+}
+
+func TestFormulaEvaluate(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	f, e := ParseFormula("ratio = a / b")
+	if e != nil {
+		t.Fatal(e)
+	}
+	series := map[string][]Observation{
+		// day 2 is missing from b, day 3 has no value in a and day 4 divides by zero
+		"A": {{Date: day(5), Value: 8}, {Date: day(1), Value: 6}, {Date: day(2), Value: 1},
+			{Date: day(3), Missing: true}, {Date: day(4), Value: 1}},
+		"B": {{Date: day(1), Value: 3}, {Date: day(3), Value: 1}, {Date: day(4), Value: 0},
+			{Date: day(5), Value: 2}},
+	}
+	obs, e := f.Evaluate(series)
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := []Observation{{Date: day(1), Value: 2}, {Date: day(5), Value: 4}}
+	if len(obs) != len(want) {
+		t.Fatalf("got %v, want %v", obs, want)
+	}
+	for ind := range want {
+		if !obs[ind].Date.Equal(want[ind].Date) || obs[ind].Value != want[ind].Value {
+			t.Errorf("observation %d is %v, want %v", ind, obs[ind], want[ind])
+		}
+	}
+	if _, e := f.Evaluate(map[string][]Observation{"A": series["A"]}); e == nil {
+		t.Error("a series without observations isn't an error")
+	}
+}
@@ -0,0 +1,399 @@
+// Package fred pulls series from the St Louis Federal Reserve database Fred II and returns them as
+// typed observations.
+package fred
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Datum is the data for a single date
+type Datum struct {
+	RtStart string `json:"realtime_start,omitempty"`
+	RtEnd   string `json:"realtime_end,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Value   string `json:"value,omitempty"`
+}
+
+// Series is the outermost struct returned by the http Get
+type Series struct {
+	ObservationStart string  `json:"observation_start,omitempty"`
+	ObservationEnd   string  `json:"observation_end,omitempty"`
+	Units            string  `json:"units,omitempty"`
+	OrderBy          string  `json:"order_by,omitempty"`
+	Count            int     `json:"count,omitempty"`
+	RealtimeStart    string  `json:"realtime_start,omitempty"`
+	RealtimeEnd      string  `json:"realtime_end,omitempty"`
+	OutputType       int     `json:"output_type,omitempty"`
+	FileType         string  `json:"file_type,omitempty"`
+	SortOrder        string  `json:"sort_order,omitempty"`
+	Offset           int     `json:"offset,omitempty"`
+	Limit            int     `json:"limit,omitempty"`
+	Results          []Datum `json:"observations,omitempty"`
+}
+
+// apiUrl is the address of the API
+const apiUrl = "https://api.stlouisfed.org/fred/"
+
+// observationsPath is the endpoint for the observations of a series
+const observationsPath = "series/observations"
+
+// GetSeries pulls the raw data for the series seriesId.
+func GetSeries(seriesId string, apiKey string, opts *Options) (*Series, error) {
+	var results []Datum
+	series, e := fetch(context.Background(), seriesId, apiKey, opts, func(d Datum) error {
+		results = append(results, d)
+		return nil
+	})
+	if e != nil {
+		return nil, e
+	}
+	series.Results = results
+	return series, nil
+}
+
+// GetObservations pulls the series seriesId and returns its parsed observations.
+func GetObservations(seriesId string, apiKey string, opts *Options) ([]Observation, error) {
+	return Fetch(context.Background(), seriesId, apiKey, opts)
+}
+
+// Fetch pulls the series seriesId and returns its parsed observations.  Canceling ctx abandons the requests.
+func Fetch(ctx context.Context, seriesId string, apiKey string, opts *Options) ([]Observation, error) {
+	var obs []Observation
+	if _, e := StreamContext(ctx, seriesId, apiKey, opts, func(o Observation) error {
+		obs = append(obs, o)
+		return nil
+	}); e != nil {
+		return nil, e
+	}
+	return obs, nil
+}
+
+// Stream pulls the series seriesId, calling fn for each observation as it is decoded from the response, after
+// any transforms in opts.  Observations that can't be parsed are passed to opts' Reject, if it has one.
+// Unless opts asks for the response to be archived, the whole response is never held in memory.
+// The returned Series has every field except Results.  Stream stops at the first error returned by fn.
+func Stream(seriesId string, apiKey string, opts *Options, fn func(o Observation) error) (*Series, error) {
+	return StreamContext(context.Background(), seriesId, apiKey, opts, fn)
+}
+
+// StreamContext is Stream with a context: canceling ctx abandons the requests.
+func StreamContext(ctx context.Context, seriesId string, apiKey string, opts *Options,
+	fn func(o Observation) error) (*Series, error) {
+	loc, transforms := opts.location(), opts.transforms()
+	reject, rejectDates := opts.reject()
+	return fetch(ctx, seriesId, apiKey, opts, func(d Datum) error {
+		o, e := d.ParseIn(loc)
+		if reject != nil {
+			if e == nil && o.BadDate && rejectDates {
+				e = fmt.Errorf("cannot parse date %q", d.Date)
+			}
+			if e != nil {
+				reject(seriesId, d, e)
+				return nil
+			}
+		}
+		if e != nil {
+			return e
+		}
+		o, keep, e := apply(transforms, seriesId, o)
+		if e != nil || !keep {
+			return e
+		}
+		return fn(o)
+	})
+}
+
+// fetch issues the Gets for seriesId and decodes the responses, calling fn for each raw Datum in order.  A series
+// longer than a page is fetched a page at a time: once the first page says how many observations there are and how
+// many a page holds, the rest are fetched concurrently, by opts' PageWorkers at a time, and passed to fn in order.
+func fetch(ctx context.Context, seriesId string, apiKey string, opts *Options,
+	fn func(d Datum) error) (*Series, error) {
+	ctx = withUsage(ctx, opts.usage())
+	query := opts.Query(seriesId)
+	// a request for the last observations is a single page
+	if opts != nil && opts.Last > 0 {
+		return fetchPage(ctx, seriesId, query, apiKey, opts, fn)
+	}
+	size := opts.pageSize()
+	query.Set("limit", strconv.Itoa(size))
+	series, e := fetchPage(ctx, seriesId, query, apiKey, opts, fn)
+	if e != nil {
+		return nil, e
+	}
+	// the rest of the pages follow the limit Fred II reports, which may be less than was asked for
+	if series.Limit > 0 && series.Limit < size {
+		size = series.Limit
+		query.Set("limit", strconv.Itoa(size))
+	}
+	if series.Count <= size {
+		return series, nil
+	}
+
+	// pages[ind] delivers the observations of the page at offset (ind+1)*size.  A page holds a worker from the time
+	// it's requested until it's taken off, so no more than opts.pageWorkers() pages are in memory.  The workers are
+	// handed out in page order, so the next page to be taken off always has one.
+	pages := make([]chan page, (series.Count-1)/size)
+	for ind := range pages {
+		pages[ind] = make(chan page, 1)
+	}
+	// returning early cancels the requests in flight and those not yet made
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	workers := make(chan struct{}, opts.pageWorkers())
+	go func() {
+		for ind := range pages {
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(ind int) {
+				q := url.Values{}
+				for k, v := range query {
+					q[k] = v
+				}
+				offset := (ind + 1) * size
+				q.Set("offset", strconv.Itoa(offset))
+				var p page
+				ps, e := fetchPage(ctx, seriesId, q, apiKey, opts, func(d Datum) error {
+					p.data = append(p.data, d)
+					return nil
+				})
+				if p.err = e; e == nil && ps.Offset != offset {
+					p.err = fmt.Errorf("series %s: asked Fred II for the page at offset %d, got %d", seriesId,
+						offset, ps.Offset)
+				}
+				pages[ind] <- p
+			}(ind)
+		}
+	}()
+	for _, ch := range pages {
+		var p page
+		select {
+		case p = <-ch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		<-workers
+		if p.err != nil {
+			return nil, p.err
+		}
+		for _, d := range p.data {
+			if e := fn(d); e != nil {
+				return nil, e
+			}
+		}
+	}
+	return series, nil
+}
+
+// page is a page of the observations of a series, or the error fetching it
+type page struct {
+	data []Datum
+	err  error
+}
+
+// fetchPage issues the Get for seriesId with query and decodes the response, calling fn for each raw Datum.
+func fetchPage(ctx context.Context, seriesId string, query url.Values, apiKey string, opts *Options,
+	fn func(d Datum) error) (*Series, error) {
+	redacted := apiUrl + observationsPath + "?" + query.Encode()
+	fetched := time.Now()
+	resp, e := get(ctx, observationsPath, query, apiKey)
+	if e != nil {
+		return nil, e
+	}
+	// keep a copy of the body if it's to be archived
+	var body io.Reader = resp.Body
+	var raw *bytes.Buffer
+	archive := opts.archive()
+	if archive != nil {
+		raw = &bytes.Buffer{}
+		body = io.TeeReader(resp.Body, raw)
+	}
+	series, e := decode(body, newDrift(seriesId, opts), fn)
+	if e := resp.Body.Close(); e != nil {
+		return nil, e
+	}
+	if e != nil {
+		// the body wasn't even an error structure
+		if _, ok := e.(*APIError); ok {
+			return nil, e
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, statusError(resp, "series "+seriesId)
+		}
+		return nil, fmt.Errorf("series %s: %w", seriesId, e)
+	}
+	if series == nil {
+		return nil, fmt.Errorf("no data returned for series %s: %w", seriesId, ErrSeriesNotFound)
+	}
+	if archive != nil {
+		if e := archive(redacted, fetched, raw.Bytes()); e != nil {
+			return nil, e
+		}
+	}
+	return series, nil
+}
+
+// get issues a Get to the endpoint path with the query parameters plus the API key, once the Pacer allows.  If
+// Fred II refuses it for too many requests or fails, or it doesn't reach Fred II, it's retried as SetRetries allows.
+// Each request is counted in the package's Usage, and in that of ctx if it has one, and logged if SetDebug has been
+// called.  Canceling ctx abandons it, even while it waits for the Pacer.
+func get(ctx context.Context, path string, query url.Values, apiKey string) (*http.Response, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("file_type", "json")
+	q.Set("api_key", "REDACTED")
+	redacted := apiUrl + path + "?" + q.Encode()
+	q.Set("api_key", apiKey)
+	for attempt := 0; ; attempt++ {
+		if e := pace(ctx); e != nil {
+			return nil, e
+		}
+		start := time.Now()
+		counted := countRequest(ctx)
+		req, e := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl+path+"?"+q.Encode(), nil)
+		if e != nil {
+			return nil, e
+		}
+		resp, e := httpClient().Do(req)
+		if e == nil {
+			resp.Body = countedBody{ReadCloser: resp.Body, also: counted}
+		}
+		resp, e = debugResponse(redacted, start, resp, e)
+		// a request that failed on the way is retried too, unless it failed because ctx is done
+		retry := e == nil && retryable(resp.StatusCode) || e != nil && ctx.Err() == nil
+		if !retry || attempt >= int(atomic.LoadInt32(&maxRetries)) {
+			return resp, e
+		}
+		wait := backoff(resp, attempt)
+		discard(resp, e, redacted, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// getJSON issues a Get to the endpoint path and unmarshals the response into v.  Fred II error responses are
+// returned as an *APIError.
+func getJSON(ctx context.Context, path string, query url.Values, apiKey string, v interface{}) error {
+	resp, e := get(ctx, path, query, apiKey)
+	if e != nil {
+		return e
+	}
+	body, e := io.ReadAll(resp.Body)
+	if e := resp.Body.Close(); e != nil {
+		return e
+	}
+	if e != nil {
+		return e
+	}
+	apiErr := &APIError{}
+	if e := json.Unmarshal(body, apiErr); e == nil && apiErr.Code != 0 {
+		return apiErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, path)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// decode stream-parses a response, calling fn for each element of the observations array as it is read.
+// The remaining fields are returned in a Series. If there is no observations array, the Series is nil.
+// If the response is a Fred II error structure, the error is an *APIError.  If dr isn't nil, fields that differ
+// from those expected are flagged to it.
+func decode(r io.Reader, dr *drift, fn func(d Datum) error) (*Series, error) {
+	dec := json.NewDecoder(r)
+	if e := expectDelim(dec, '{'); e != nil {
+		return nil, e
+	}
+	// header holds the fields other than the observations, which are small
+	header := make(map[string]json.RawMessage)
+	found := false
+	for dec.More() {
+		tok, e := dec.Token()
+		if e != nil {
+			return nil, e
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected token %v in response", tok)
+		}
+		if key != "observations" {
+			var val json.RawMessage
+			if e := dec.Decode(&val); e != nil {
+				return nil, e
+			}
+			header[key] = val
+			continue
+		}
+		found = true
+		if e := expectDelim(dec, '['); e != nil {
+			return nil, e
+		}
+		for dec.More() {
+			var d Datum
+			if e := dr.decodeDatum(dec, &d); e != nil {
+				return nil, e
+			}
+			if e := fn(d); e != nil {
+				return nil, e
+			}
+		}
+		if e := expectDelim(dec, ']'); e != nil {
+			return nil, e
+		}
+	}
+	if _, ok := header["error_code"]; ok {
+		apiErr := &APIError{}
+		if e := unmarshalHeader(header, apiErr); e != nil {
+			return nil, e
+		}
+		return nil, apiErr
+	}
+	if !found {
+		return nil, nil
+	}
+	if e := dr.checkHeader(header); e != nil {
+		return nil, e
+	}
+	var series Series
+	if e := unmarshalHeader(header, &series); e != nil {
+		return nil, e
+	}
+	return &series, nil
+}
+
+// unmarshalHeader populates v from the decoded header fields by round-tripping them through json.
+func unmarshalHeader(header map[string]json.RawMessage, v interface{}) error {
+	raw, e := json.Marshal(header)
+	if e != nil {
+		return e
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// expectDelim reads the next token from dec and checks that it is the delimiter want.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, e := dec.Token()
+	if e != nil {
+		return e
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %v in response, got %v", want, tok)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package fred
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		body   string
+		dates  []string
+		count  int
+		units  string
+		series bool // true if a Series is returned
+		err    bool
+	}{
+		{name: "observations", body: `{"count":2,"observations":[{"date":"2020-01-01","value":"1.5"},` +
+			`{"date":"2020-02-01","value":"."}],"units":"lin"}`, dates: []string{"2020-01-01", "2020-02-01"},
+			count: 2, units: "lin", series: true},
+		{name: "no observations", body: `{"count":0,"observations":[]}`, series: true},
+		{name: "no observations array", body: `{"count":0}`},
+		{name: "not an object", body: `[1, 2]`, err: true},
+		{name: "truncated", body: `{"count":2,"observations":[{"date":"2020-01-01","value":"1.5"},{"date":"20`,
+			dates: []string{"2020-01-01"}, err: true},
+		{name: "empty", body: ``, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var dates []string
+			series, e := decode(strings.NewReader(tt.body), nil, func(d Datum) error {
+				dates = append(dates, d.Date)
+				return nil
+			})
+			if (e != nil) != tt.err {
+				t.Fatalf("error %v, want an error: %v", e, tt.err)
+			}
+			if strings.Join(dates, ",") != strings.Join(tt.dates, ",") {
+				t.Errorf("observations dated %v, want %v", dates, tt.dates)
+			}
+			if tt.err {
+				return
+			}
+			if (series != nil) != tt.series {
+				t.Fatalf("series %v, want one: %v", series, tt.series)
+			}
+			if series != nil && (series.Count != tt.count || series.Units != tt.units) {
+				t.Errorf("series has count %d and units %q, want %d and %q", series.Count, series.Units, tt.count,
+					tt.units)
+			}
+		})
+	}
+}
+
+func TestDecodeStops(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	_, e := decode(strings.NewReader(`{"observations":[{"date":"2020-01-01","value":"1"},`+
+		`{"date":"2020-02-01","value":"2"},{"date":"2020-03-01","value":"3"}]}`), nil, func(d Datum) error {
+		calls++
+		if calls == 2 {
+			return stop
+		}
+		return nil
+	})
+	if e != stop || calls != 2 {
+		t.Errorf("decode returned %v after %d observations, want the error of fn after 2", e, calls)
+	}
+}
+
+func TestDecodeAPIError(t *testing.T) {
+	for _, body := range []string{
+		`{"error_code":400,"error_message":"Bad Request.  The series does not exist."}`,
+		`{"error_message":"Bad Request.  The series does not exist.","error_code":400,"observations":[]}`,
+	} {
+		_, e := decode(strings.NewReader(body), nil, func(d Datum) error { return nil })
+		apiErr, ok := e.(*APIError)
+		if !ok {
+			t.Errorf("decode(%s) returned %v, not an *APIError", body, e)
+			continue
+		}
+		if apiErr.Code != 400 || apiErr.Message != "Bad Request.  The series does not exist." {
+			t.Errorf("decode(%s) returned %+v", body, apiErr)
+		}
+	}
+}
+
+// fakeFred is a transport serving the observations endpoint for a series of count observations, whose values are
+// their positions.  It returns at most maxLimit a request, reporting that as the limit, and records the offsets
+// asked for.
+type fakeFred struct {
+	count        int
+	maxLimit     int
+	ignoreOffset bool // if true, every request gets the first page
+
+	mu      sync.Mutex
+	offsets []int
+}
+
+func (f *fakeFred) RoundTrip(req *http.Request) (*http.Response, error) {
+	q := req.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit == 0 || limit > f.maxLimit {
+		limit = f.maxLimit
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	f.mu.Lock()
+	f.offsets = append(f.offsets, offset)
+	f.mu.Unlock()
+	if f.ignoreOffset {
+		offset = 0
+	}
+	obs := []Datum{}
+	for ind := offset; ind < f.count && ind < offset+limit; ind++ {
+		obs = append(obs, Datum{Date: "2000-01-01", Value: strconv.Itoa(ind)})
+	}
+	body, e := json.Marshal(map[string]interface{}{"count": f.count, "offset": offset, "limit": limit,
+		"observations": obs})
+	if e != nil {
+		return nil, e
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{},
+		Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+}
+
+func TestFetchPages(t *testing.T) {
+	defer SetClient(nil)
+	for _, tt := range []struct {
+		name     string
+		count    int
+		pageSize int
+		maxLimit int
+		last     int
+		offsets  []int
+	}{
+		{name: "one short page", count: 5, pageSize: 10, maxLimit: 100, offsets: []int{0}},
+		{name: "one full page", count: 10, pageSize: 10, maxLimit: 100, offsets: []int{0}},
+		{name: "one over a page", count: 11, pageSize: 10, maxLimit: 100, offsets: []int{0, 10}},
+		{name: "several pages", count: 25, pageSize: 10, maxLimit: 100, offsets: []int{0, 10, 20}},
+		{name: "pages exactly", count: 30, pageSize: 10, maxLimit: 100, offsets: []int{0, 10, 20}},
+		{name: "limit cut by Fred II", count: 25, pageSize: 10, maxLimit: 4,
+			offsets: []int{0, 4, 8, 12, 16, 20, 24}},
+		{name: "default page size", count: 25, maxLimit: 100000, offsets: []int{0}},
+		{name: "last observations", count: 25, pageSize: 10, maxLimit: 100, last: 3, offsets: []int{0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ff := &fakeFred{count: tt.count, maxLimit: tt.maxLimit}
+			SetClient(&http.Client{Transport: ff})
+			var got []string
+			opts := &Options{PageSize: tt.pageSize, PageWorkers: 2, Last: tt.last}
+			if _, e := fetch(context.Background(), "TEST", "key", opts, func(d Datum) error {
+				got = append(got, d.Value)
+				return nil
+			}); e != nil {
+				t.Fatal(e)
+			}
+			want := tt.count
+			if tt.last > 0 {
+				want = tt.last
+			}
+			if len(got) != want {
+				t.Fatalf("got %d observations, want %d", len(got), want)
+			}
+			for ind, v := range got {
+				if v != strconv.Itoa(ind) {
+					t.Fatalf("observation %d has value %s, so they're out of order", ind, v)
+				}
+			}
+			sort.Ints(ff.offsets)
+			if !equalInts(ff.offsets, tt.offsets) {
+				t.Errorf("offsets asked for %v, want %v", ff.offsets, tt.offsets)
+			}
+		})
+	}
+}
+
+func TestFetchWrongOffset(t *testing.T) {
+	defer SetClient(nil)
+	SetClient(&http.Client{Transport: &fakeFred{count: 25, maxLimit: 100, ignoreOffset: true}})
+	_, e := fetch(context.Background(), "TEST", "key", &Options{PageSize: 10}, func(d Datum) error { return nil })
+	if e == nil {
+		t.Fatal("a page at the wrong offset wasn't an error")
+	}
+}
+
+func TestFetchHoldsWorkers(t *testing.T) {
+	defer SetClient(nil)
+	ff := &fakeFred{count: 100, maxLimit: 100}
+	SetClient(&http.Client{Transport: ff})
+	opts := &Options{PageSize: 10, PageWorkers: 2}
+	requested := 0
+	if _, e := fetch(context.Background(), "TEST", "key", opts, func(d Datum) error {
+		// the loader is slow with the second page, which the pages after it mustn't pile up behind
+		if d.Value == "10" {
+			time.Sleep(50 * time.Millisecond)
+			ff.mu.Lock()
+			requested = len(ff.offsets)
+			ff.mu.Unlock()
+		}
+		return nil
+	}); e != nil {
+		t.Fatal(e)
+	}
+	// the first page, the second and a page per worker
+	if requested > 2+opts.PageWorkers {
+		t.Errorf("%d pages were requested while the second was loaded, want at most %d", requested,
+			2+opts.PageWorkers)
+	}
+}
+
+// stallingFred serves the first two pages of fakeFred and stalls on the rest until their requests are canceled
+type stallingFred struct {
+	fakeFred
+	canceled chan struct{}
+}
+
+func (f *stallingFred) RoundTrip(req *http.Request) (*http.Response, error) {
+	if offset, _ := strconv.Atoi(req.URL.Query().Get("offset")); offset < 20 {
+		return f.fakeFred.RoundTrip(req)
+	}
+	<-req.Context().Done()
+	f.canceled <- struct{}{}
+	return nil, req.Context().Err()
+}
+
+func TestFetchCancelsPages(t *testing.T) {
+	defer SetClient(nil)
+	sf := &stallingFred{fakeFred: fakeFred{count: 100, maxLimit: 100}, canceled: make(chan struct{}, 10)}
+	SetClient(&http.Client{Transport: sf})
+	stop := errors.New("stop")
+	_, e := fetch(context.Background(), "TEST", "key", &Options{PageSize: 10, PageWorkers: 3},
+		func(d Datum) error {
+			if d.Value == "10" {
+				return stop
+			}
+			return nil
+		})
+	if e != stop {
+		t.Fatalf("fetch returned %v, want the error of fn", e)
+	}
+	select {
+	case <-sf.canceled:
+	case <-time.After(time.Second):
+		t.Error("the requests in flight weren't canceled when fetch returned")
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ind := range a {
+		if a[ind] != b[ind] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package fred
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// UpdatedFormat is the layout of the LastUpdated field of SeriesInfo
+const UpdatedFormat = "2006-01-02 15:04:05-07"
+
+// seriesPath is the endpoint for the metadata of a series
+const seriesPath = "series"
+
+// SeriesInfo is the metadata Fred II keeps for a series
+type SeriesInfo struct {
+	ID                      string `json:"id"`
+	RealtimeStart           string `json:"realtime_start"`
+	RealtimeEnd             string `json:"realtime_end"`
+	Title                   string `json:"title"`
+	ObservationStart        string `json:"observation_start"`
+	ObservationEnd          string `json:"observation_end"`
+	Frequency               string `json:"frequency"`
+	FrequencyShort          string `json:"frequency_short"`
+	Units                   string `json:"units"`
+	UnitsShort              string `json:"units_short"`
+	SeasonalAdjustment      string `json:"seasonal_adjustment"`
+	SeasonalAdjustmentShort string `json:"seasonal_adjustment_short"`
+	LastUpdated             string `json:"last_updated"`
+	Popularity              int    `json:"popularity"`
+	Notes                   string `json:"notes"`
+}
+
+// Updated returns LastUpdated as a time.
+func (si *SeriesInfo) Updated() (time.Time, error) {
+	return time.Parse(UpdatedFormat, si.LastUpdated)
+}
+
+// GetInfo pulls the metadata for the series seriesId.
+func GetInfo(seriesId string, apiKey string) (*SeriesInfo, error) {
+	var resp struct {
+		Series []SeriesInfo `json:"seriess"`
+	}
+	if e := getJSON(context.Background(), seriesPath, url.Values{"series_id": {seriesId}}, apiKey, &resp); e != nil {
+		return nil, e
+	}
+	if len(resp.Series) == 0 {
+		return nil, fmt.Errorf("no metadata returned for series %s", seriesId)
+	}
+	return &resp.Series[0], nil
+}
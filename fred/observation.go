@@ -0,0 +1,104 @@
+package fred
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateFormat is the layout of dates returned by Fred II
+const DateFormat = "2006-01-02"
+
+// missingValue is the value Fred II returns when an observation is not available
+const missingValue = "."
+
+// decimal matches the decimal numbers Fred II gives as values.  strconv.ParseFloat alone would also take "NaN",
+// "Inf", hexadecimal and underscored numbers.
+var decimal = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+
+// MissingDate is the date assigned to observations whose date cannot be parsed.  Observations parsed in another
+// location get the same calendar date in that location; use IsMissingDate to test for it.
+var MissingDate = time.Date(1969, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// IsMissingDate returns true if t is MissingDate in its own location.
+func IsMissingDate(t time.Time) bool {
+	y, m, d := t.Date()
+	return y == MissingDate.Year() && m == MissingDate.Month() && d == MissingDate.Day()
+}
+
+// Observation is a single parsed observation of a series.
+type Observation struct {
+	Date    time.Time // date of the observation. MissingDate if the date is not valid.
+	Value   float64   // value of the observation. Zero if Missing.
+	Missing bool      // true if Fred II reports no value for the date
+	BadDate bool      // true if the date couldn't be parsed, in which case Date is MissingDate
+
+	// RealtimeStart and RealtimeEnd are the first and last days the value was current: the period of the vintage
+	// it's from.  A value still current ends on RealtimeForever.  They are zero if Fred II didn't give them.
+	RealtimeStart time.Time
+	RealtimeEnd   time.Time
+}
+
+// RealtimeForever is the RealtimeEnd of a value that is still current
+var RealtimeForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Parse converts the raw Datum into an Observation, with the date at midnight UTC.
+func (d Datum) Parse() (Observation, error) {
+	return d.ParseIn(time.UTC)
+}
+
+// ParseIn converts the raw Datum into an Observation, with the date at midnight in loc.
+func (d Datum) ParseIn(loc *time.Location) (Observation, error) {
+	dt, e := time.ParseInLocation(DateFormat, d.Date, loc)
+	if e != nil {
+		y, m, day := MissingDate.Date()
+		dt = time.Date(y, m, day, 0, 0, 0, 0, loc)
+	}
+	bad := e != nil
+	// the real-time period is the same for every observation of a request that isn't for vintages, so one that
+	// can't be parsed is left zero rather than failing the observation
+	rtStart, _ := time.ParseInLocation(DateFormat, d.RtStart, loc)
+	rtEnd, _ := time.ParseInLocation(DateFormat, d.RtEnd, loc)
+	if d.Value == missingValue {
+		return Observation{Date: dt, Missing: true, BadDate: bad, RealtimeStart: rtStart, RealtimeEnd: rtEnd}, nil
+	}
+	v, e := strconv.ParseFloat(d.Value, 64)
+	if e != nil || !decimal.MatchString(d.Value) {
+		return Observation{}, fmt.Errorf("cannot parse value %q for date %s", d.Value, d.Date)
+	}
+	return Observation{Date: dt, Value: v, BadDate: bad, RealtimeStart: rtStart, RealtimeEnd: rtEnd}, nil
+}
+
+// Observations parses the observations of the series.
+func (s *Series) Observations() ([]Observation, error) {
+	obs := make([]Observation, 0, len(s.Results))
+	for _, d := range s.Results {
+		o, e := d.Parse()
+		if e != nil {
+			return nil, e
+		}
+		obs = append(obs, o)
+	}
+	return obs, nil
+}
+
+// PeriodEnd returns the last day of the period that starts on date, for a series with the given frequency (the
+// FrequencyShort of its SeriesInfo).  Fred II dates daily, weekly and biweekly observations by the day the period
+// ends, so for those frequencies date is returned unchanged.
+func PeriodEnd(date time.Time, frequency string) (time.Time, error) {
+	switch strings.ToUpper(frequency) {
+	case "D", "W", "BW":
+		return date, nil
+	case "M":
+		return date.AddDate(0, 1, -1), nil
+	case "Q":
+		return date.AddDate(0, 3, -1), nil
+	case "SA":
+		return date.AddDate(0, 6, -1), nil
+	case "A":
+		return date.AddDate(1, 0, -1), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown frequency %s", frequency)
+}
@@ -0,0 +1,97 @@
+package fred
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodEnd(t *testing.T) {
+	date := func(s string) time.Time {
+		d, e := time.Parse(DateFormat, s)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return d
+	}
+	for _, tt := range []struct {
+		date      string
+		frequency string
+		want      string
+		err       bool
+	}{
+		{date: "2020-03-17", frequency: "D", want: "2020-03-17"},
+		{date: "2020-03-20", frequency: "W", want: "2020-03-20"},
+		{date: "2020-03-20", frequency: "BW", want: "2020-03-20"},
+		{date: "2020-01-01", frequency: "M", want: "2020-01-31"},
+		{date: "2020-02-01", frequency: "M", want: "2020-02-29"},
+		{date: "2021-02-01", frequency: "m", want: "2021-02-28"},
+		{date: "2020-10-01", frequency: "Q", want: "2020-12-31"},
+		{date: "2020-07-01", frequency: "SA", want: "2020-12-31"},
+		{date: "2020-01-01", frequency: "A", want: "2020-12-31"},
+		{date: "2020-01-01", frequency: "", err: true},
+		{date: "2020-01-01", frequency: "X", err: true},
+	} {
+		got, e := PeriodEnd(date(tt.date), tt.frequency)
+		if tt.err {
+			if e == nil {
+				t.Errorf("PeriodEnd(%s, %q) isn't an error", tt.date, tt.frequency)
+			}
+			continue
+		}
+		if e != nil {
+			t.Errorf("PeriodEnd(%s, %q): %v", tt.date, tt.frequency, e)
+			continue
+		}
+		if got.Format(DateFormat) != tt.want {
+			t.Errorf("PeriodEnd(%s, %q) = %s, want %s", tt.date, tt.frequency, got.Format(DateFormat), tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		want    float64
+		missing bool
+		err     bool
+	}{
+		{value: "1.5", want: 1.5},
+		{value: "-2", want: -2},
+		{value: "+3", want: 3},
+		{value: ".5", want: 0.5},
+		{value: "5.", want: 5},
+		{value: "1e3", want: 1000},
+		{value: "1.2E-3", want: 0.0012},
+		{value: ".", missing: true},
+		{value: "NaN", err: true},
+		{value: "Inf", err: true},
+		{value: "-Infinity", err: true},
+		{value: "0x10", err: true},
+		{value: "1_000", err: true},
+		{value: "1,000", err: true},
+		{value: "", err: true},
+		{value: "1.5x", err: true},
+		{value: "--1", err: true},
+		{value: "1e", err: true},
+	} {
+		o, e := Datum{Date: "2020-01-01", Value: tt.value}.Parse()
+		if (e != nil) != tt.err {
+			t.Errorf("value %q: error %v, want an error: %v", tt.value, e, tt.err)
+			continue
+		}
+		if !tt.err && (o.Value != tt.want || o.Missing != tt.missing) {
+			t.Errorf("value %q parsed as %g (missing %v), want %g (missing %v)", tt.value, o.Value, o.Missing,
+				tt.want, tt.missing)
+		}
+	}
+}
+
+func TestParseBadDate(t *testing.T) {
+	o, e := Datum{Date: "2020-13-01", Value: "1"}.Parse()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !o.BadDate || !IsMissingDate(o.Date) || o.Value != 1 {
+		t.Errorf("parsed as %+v, want MissingDate with BadDate set", o)
+	}
+}
@@ -0,0 +1,200 @@
+package fred
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Options are the optional settings of a request for a series.  A nil *Options uses the defaults.
+type Options struct {
+	// Archive, if not nil, is called with the raw response body once it has been decoded successfully.
+	// requestURL is the url of the request with the API key removed and fetched is when the request was made.
+	// Setting Archive means the whole response is held in memory.
+	Archive func(requestURL string, fetched time.Time, body []byte) error
+
+	// Last, if positive, limits the request to the most recent Last observations, which arrive newest first.
+	Last int
+
+	// Location, if not nil, is the location of the dates of the observations, which are midnight there.
+	// The default is UTC.
+	Location *time.Location
+
+	// Transforms are applied, in order, to each observation with a value.
+	Transforms []Transform
+
+	// Reject, if not nil, is called with each datum whose date or value can't be parsed, which is then skipped.
+	// Otherwise a value that can't be parsed fails the request and a date that can't be parsed becomes MissingDate.
+	Reject func(seriesId string, d Datum, err error)
+
+	// Drift, if not nil, is called with each way a response differs from what the package expects -- a field it
+	// doesn't know or an observation missing its date or value -- once per request.  If it returns an error, the
+	// request fails with it.  Otherwise such fields are ignored and missing ones left blank.
+	Drift func(seriesId string, problem string) error
+
+	// KeepBadDates, if true, passes on observations whose date can't be parsed, with BadDate set, even if there
+	// is a Reject function.
+	KeepBadDates bool
+
+	// PageSize is the most observations requested at a time, up to the Fred II maximum of 100,000, which is the
+	// default.
+	PageSize int
+
+	// PageWorkers is the most pages of a long series fetched, or fetched and waiting to be passed on, at the same
+	// time.  The default is 4.
+	PageWorkers int
+
+	// Usage, if not nil, counts the requests for the observations and the bytes of their responses, besides the
+	// package's Usage, so the use of one load can be told apart from that of others running at the same time.
+	Usage *Usage
+
+	// Start, if not zero, is the first date requested (observation_start): observations before it aren't
+	// fetched.
+	Start time.Time
+
+	// End, if not zero, is the last date requested (observation_end): observations after it aren't fetched.
+	End time.Time
+
+	// RealtimeStart and RealtimeEnd, if not zero, are the real-time period requested: the values of the vintages
+	// current during it, as ALFRED has them, rather than today's.  A period spanning several vintages returns an
+	// observation for each value a date has had.
+	RealtimeStart time.Time
+	RealtimeEnd   time.Time
+
+	// Frequency, if not blank, is the lower frequency Fred II aggregates the observations to (frequency): w, bw,
+	// m, q, sa or a.
+	Frequency string
+
+	// Aggregation, if not blank, is how Fred II aggregates the observations to Frequency (aggregation_method):
+	// avg, the Fred II default, sum or eop, the value at the end of the period.
+	Aggregation string
+
+	// Units, if not blank, is the transformation Fred II applies to the values (units), such as chg (change), pch
+	// (percent change) or log.  The Fred II default is lin, the values as they are.
+	Units string
+}
+
+// maxPageSize is the most observations Fred II returns for a request
+const maxPageSize = 100000
+
+// defaultPageWorkers is the default number of pages fetched at the same time
+const defaultPageWorkers = 4
+
+// Query returns the query parameters of a request for seriesId, excluding the API key.
+func (o *Options) Query(seriesId string) url.Values {
+	q := url.Values{}
+	q.Set("series_id", seriesId)
+	q.Set("file_type", "json")
+	if o == nil {
+		return q
+	}
+	if o.Last > 0 {
+		q.Set("limit", strconv.Itoa(o.Last))
+		q.Set("sort_order", "desc")
+	}
+	if !o.Start.IsZero() {
+		q.Set("observation_start", o.Start.Format(DateFormat))
+	}
+	if !o.End.IsZero() {
+		q.Set("observation_end", o.End.Format(DateFormat))
+	}
+	if !o.RealtimeStart.IsZero() {
+		q.Set("realtime_start", o.RealtimeStart.Format(DateFormat))
+	}
+	if !o.RealtimeEnd.IsZero() {
+		q.Set("realtime_end", o.RealtimeEnd.Format(DateFormat))
+	}
+	if o.Frequency != "" {
+		q.Set("frequency", o.Frequency)
+	}
+	if o.Aggregation != "" {
+		q.Set("aggregation_method", o.Aggregation)
+	}
+	if o.Units != "" {
+		q.Set("units", o.Units)
+	}
+	return q
+}
+
+// ParseQuery returns the Options of a request with the query parameters q, as returned by Query.  It is the
+// inverse of Query, so a recorded request can be repeated.  Archive and Location aren't part of the query.
+func ParseQuery(q url.Values) (*Options, error) {
+	o := &Options{Frequency: q.Get("frequency"), Aggregation: q.Get("aggregation_method"), Units: q.Get("units")}
+	if limit := q.Get("limit"); limit != "" {
+		last, e := strconv.Atoi(limit)
+		if e != nil {
+			return nil, fmt.Errorf("bad limit %q in query", limit)
+		}
+		o.Last = last
+	}
+	for _, d := range []struct {
+		param string
+		date  *time.Time
+	}{{"observation_start", &o.Start}, {"observation_end", &o.End}, {"realtime_start", &o.RealtimeStart},
+		{"realtime_end", &o.RealtimeEnd}} {
+		if v := q.Get(d.param); v != "" {
+			var e error
+			if *d.date, e = time.Parse(DateFormat, v); e != nil {
+				return nil, fmt.Errorf("bad %s %q in query", d.param, v)
+			}
+		}
+	}
+	return o, nil
+}
+
+// location returns the Location of the dates, which is UTC for default options.
+func (o *Options) location() *time.Location {
+	if o == nil || o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// transforms returns the Transforms, which are none for default options.
+func (o *Options) transforms() []Transform {
+	if o == nil {
+		return nil
+	}
+	return o.Transforms
+}
+
+// pageSize returns the PageSize, which is the Fred II maximum for default options.
+func (o *Options) pageSize() int {
+	if o == nil || o.PageSize <= 0 || o.PageSize > maxPageSize {
+		return maxPageSize
+	}
+	return o.PageSize
+}
+
+// pageWorkers returns the PageWorkers, which is defaultPageWorkers for default options.
+func (o *Options) pageWorkers() int {
+	if o == nil || o.PageWorkers <= 0 {
+		return defaultPageWorkers
+	}
+	return o.PageWorkers
+}
+
+// reject returns the Reject function, which is nil for default options, and whether it's passed bad dates.
+func (o *Options) reject() (func(seriesId string, d Datum, err error), bool) {
+	if o == nil {
+		return nil, false
+	}
+	return o.Reject, !o.KeepBadDates
+}
+
+// usage returns the Usage, which is nil for default options.
+func (o *Options) usage() *Usage {
+	if o == nil {
+		return nil
+	}
+	return o.Usage
+}
+
+// archive returns the Archive function, which is nil for default options.
+func (o *Options) archive() func(requestURL string, fetched time.Time, body []byte) error {
+	if o == nil {
+		return nil
+	}
+	return o.Archive
+}
@@ -0,0 +1,138 @@
+package fred
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pacer spaces out Fred II requests so a run stays within a budget of requests per minute and per day.  Once a
+// budget is used up, requests wait until the oldest request in its window ages out.
+// A Pacer is safe for concurrent use.
+type Pacer struct {
+	PerMinute int // requests allowed in any minute. 0 means no limit.
+	PerDay    int // requests allowed in any 24 hours. 0 means no limit.
+
+	mu    sync.Mutex
+	calls []time.Time // times of the requests of the last 24 hours, oldest first
+	total int         // requests made
+}
+
+// NewPacer returns a Pacer with the budgets perMinute and perDay.
+func NewPacer(perMinute, perDay int) *Pacer {
+	return &Pacer{PerMinute: perMinute, PerDay: perDay}
+}
+
+var (
+	pacerMu sync.RWMutex
+	pacer   *Pacer
+)
+
+// SetPacer paces every later request the package makes with p.  A nil p stops pacing.
+func SetPacer(p *Pacer) {
+	pacerMu.Lock()
+	defer pacerMu.Unlock()
+	pacer = p
+}
+
+// pace waits for the package's Pacer, if it has one, to allow a request.  It returns ctx.Err() if ctx is done
+// first.
+func pace(ctx context.Context) error {
+	pacerMu.RLock()
+	p := pacer
+	pacerMu.RUnlock()
+	if p == nil {
+		return nil
+	}
+	return p.Wait(ctx)
+}
+
+// Wait blocks until a request fits the budgets and records it.  If ctx is done first, it returns ctx.Err() and
+// the request isn't recorded.
+func (p *Pacer) Wait(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		p.prune(now)
+		wait := p.delay(now)
+		if wait <= 0 {
+			p.calls = append(p.calls, now)
+			p.total++
+			p.mu.Unlock()
+			return nil
+		}
+		p.mu.Unlock()
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Calls returns the number of requests made.
+func (p *Pacer) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.total
+}
+
+// Projected returns when remaining more requests would be done, if they are made as fast as the budgets allow.
+func (p *Pacer) Projected(remaining int) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.prune(now)
+	var d time.Duration
+	if p.PerMinute > 0 {
+		d = time.Duration(remaining) * time.Minute / time.Duration(p.PerMinute)
+	}
+	// requests beyond what's left of the day's budget wait for later days
+	if p.PerDay > 0 {
+		if over := remaining - (p.PerDay - len(p.calls)); over > 0 {
+			if days := time.Duration((over+p.PerDay-1)/p.PerDay) * 24 * time.Hour; days > d {
+				d = days
+			}
+		}
+	}
+	return now.Add(d)
+}
+
+// prune forgets the requests more than a day before now.
+func (p *Pacer) prune(now time.Time) {
+	ind := 0
+	for ind < len(p.calls) && now.Sub(p.calls[ind]) >= 24*time.Hour {
+		ind++
+	}
+	p.calls = p.calls[ind:]
+}
+
+// delay returns how long a request must wait at now to fit the budgets.
+func (p *Pacer) delay(now time.Time) time.Duration {
+	var wait time.Duration
+	for _, w := range []struct {
+		budget int
+		window time.Duration
+	}{{p.PerMinute, time.Minute}, {p.PerDay, 24 * time.Hour}} {
+		if w.budget <= 0 || p.inWindow(now, w.window) < w.budget {
+			continue
+		}
+		// the request can go once the oldest request still counted against the budget ages out
+		oldest := p.calls[len(p.calls)-w.budget]
+		if d := oldest.Add(w.window).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// inWindow returns the number of requests in the window before now.
+func (p *Pacer) inWindow(now time.Time, window time.Duration) int {
+	n := 0
+	for ind := len(p.calls) - 1; ind >= 0 && now.Sub(p.calls[ind]) < window; ind-- {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,90 @@
+package fred
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPacerDelay(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name      string
+		perMinute int
+		perDay    int
+		ago       []time.Duration // how long before now each request was made, oldest first
+		want      time.Duration
+	}{
+		{name: "no budgets", ago: []time.Duration{3 * time.Second, 2 * time.Second, time.Second}},
+		{name: "no requests", perMinute: 1, perDay: 1},
+		{name: "minute has room", perMinute: 2, ago: []time.Duration{90 * time.Second, 10 * time.Second}},
+		{name: "minute full", perMinute: 2, ago: []time.Duration{30 * time.Second, 10 * time.Second},
+			want: 30 * time.Second},
+		{name: "minute full, older requests", perMinute: 2,
+			ago: []time.Duration{50 * time.Second, 40 * time.Second, 5 * time.Second}, want: 20 * time.Second},
+		{name: "day full", perDay: 2, ago: []time.Duration{23 * time.Hour, time.Hour}, want: time.Hour},
+		{name: "day waits longer than minute", perMinute: 2, perDay: 2,
+			ago: []time.Duration{2 * time.Hour, time.Second}, want: 22 * time.Hour},
+		{name: "minute waits longer than day", perMinute: 2, perDay: 3,
+			ago: []time.Duration{30 * time.Second, 20 * time.Second}, want: 30 * time.Second},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPacer(tt.perMinute, tt.perDay)
+			for _, ago := range tt.ago {
+				p.calls = append(p.calls, now.Add(-ago))
+			}
+			if got := p.delay(now); got != tt.want {
+				t.Errorf("delay %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacerProjected(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		perMinute int
+		perDay    int
+		made      int // requests made in the last hour
+		remaining int
+		want      time.Duration
+	}{
+		{name: "no budgets", remaining: 1000},
+		{name: "per minute", perMinute: 60, remaining: 120, want: 2 * time.Minute},
+		{name: "within the day", perMinute: 60, perDay: 1000, made: 10, remaining: 120, want: 2 * time.Minute},
+		{name: "into the next day", perMinute: 60, perDay: 10, made: 5, remaining: 15, want: 24 * time.Hour},
+		{name: "several days", perDay: 10, remaining: 35, want: 72 * time.Hour},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPacer(tt.perMinute, tt.perDay)
+			for ind := 0; ind < tt.made; ind++ {
+				p.calls = append(p.calls, time.Now().Add(-time.Hour))
+			}
+			start := time.Now()
+			got := p.Projected(tt.remaining)
+			if d := got.Sub(start); d < tt.want || d > tt.want+time.Second {
+				t.Errorf("projected in %s, want %s", d, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacerWaitCanceled(t *testing.T) {
+	p := NewPacer(1, 0)
+	if e := p.Wait(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+	// the minute's budget is used, so the next request waits until ctx gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if e := p.Wait(ctx); e != context.DeadlineExceeded {
+		t.Errorf("error %v, want %v", e, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("waited %s after ctx was done", d)
+	}
+	if p.Calls() != 1 {
+		t.Errorf("%d calls recorded, want 1", p.Calls())
+	}
+}
@@ -0,0 +1,48 @@
+package fred
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// releaseSeriesPath is the endpoint for the series of a release
+const releaseSeriesPath = "release/series"
+
+// maxListed is the most series Fred II lists for a request
+const maxListed = 1000
+
+// GetReleaseSeries returns the metadata of the series of the release releaseId, such as 18 for the H.15 Selected
+// Interest Rates.
+func GetReleaseSeries(releaseId int, apiKey string) ([]SeriesInfo, error) {
+	return listSeries(releaseSeriesPath, url.Values{"release_id": {strconv.Itoa(releaseId)}}, 0, apiKey)
+}
+
+// listSeries returns the series listed by the endpoint path, such as release/series, for query: the first most of
+// them, or all of them if most isn't positive.  The list is fetched a page at a time.
+func listSeries(path string, query url.Values, most int, apiKey string) ([]SeriesInfo, error) {
+	var series []SeriesInfo
+	for offset := 0; most <= 0 || offset < most; offset += maxListed {
+		var resp struct {
+			Count  int          `json:"count"`
+			Series []SeriesInfo `json:"seriess"`
+		}
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("limit", strconv.Itoa(maxListed))
+		q.Set("offset", strconv.Itoa(offset))
+		if e := getJSON(context.Background(), path, q, apiKey, &resp); e != nil {
+			return nil, e
+		}
+		series = append(series, resp.Series...)
+		if len(resp.Series) == 0 || offset+len(resp.Series) >= resp.Count {
+			break
+		}
+	}
+	if most > 0 && len(series) > most {
+		series = series[:most]
+	}
+	return series, nil
+}
@@ -0,0 +1,62 @@
+package fred
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// maxRetryWait is the longest wait before retrying a request
+const maxRetryWait = time.Minute
+
+// maxRetries is the most times a request is retried, set by SetRetries
+var maxRetries int32
+
+// SetRetries retries every later request the package makes up to n times, with exponential backoff, if Fred II
+// refuses it for too many requests (429) or fails with a server error (5xx), or it fails on the way to Fred II (a
+// reset connection, a timeout).  0, the default, never retries.
+func SetRetries(n int) {
+	atomic.StoreInt32(&maxRetries, int32(n))
+}
+
+// retryable returns true if a request that got status may succeed if it's made again.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// backoff returns how long to wait before retrying the request that got resp, nil if it got none, for the
+// attempt'th time counting from 0: the Retry-After of resp, if it gives one in seconds, otherwise 1s doubled for
+// each attempt, at most maxRetryWait either way.
+func backoff(resp *http.Response, attempt int) time.Duration {
+	retryAfter := ""
+	if resp != nil {
+		retryAfter = resp.Header.Get("Retry-After")
+	}
+	wait := maxRetryWait
+	if s, e := strconv.Atoi(retryAfter); e == nil && s >= 0 {
+		wait = time.Duration(s) * time.Second
+	} else if attempt < 6 {
+		wait = time.Second << attempt
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	return wait
+}
+
+// discard reads and closes the body of a response that's to be retried, so its connection can be reused; resp is
+// nil if the request failed with err.  The wait before the retry is logged if SetDebug has been called.
+func discard(resp *http.Response, err error, requestURL string, wait time.Duration) {
+	reason := fmt.Sprint(err)
+	if resp != nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		reason = resp.Status
+	}
+	if w := debugWriter(); w != nil {
+		fmt.Fprintf(w, "fred: GET %s: %s, retrying in %s\n", requestURL, reason, wait)
+	}
+}
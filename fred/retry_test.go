@@ -0,0 +1,94 @@
+package fred
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	for status, want := range map[int]bool{200: false, 400: false, 404: false, 429: true, 500: true, 502: true,
+		503: true} {
+		if got := retryable(status); got != want {
+			t.Errorf("retryable(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{attempt: 0, want: time.Second},
+		{attempt: 1, want: 2 * time.Second},
+		{attempt: 3, want: 8 * time.Second},
+		{attempt: 5, want: 32 * time.Second},
+		{attempt: 6, want: time.Minute},
+		{attempt: 40, want: time.Minute},
+		{retryAfter: "3", attempt: 4, want: 3 * time.Second},
+		{retryAfter: "0", attempt: 2, want: 0},
+		{retryAfter: "600", want: time.Minute},
+		{retryAfter: "-1", attempt: 1, want: 2 * time.Second},
+		{retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT", attempt: 2, want: 4 * time.Second},
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.retryAfter != "" {
+			resp.Header.Set("Retry-After", tt.retryAfter)
+		}
+		if got := backoff(resp, tt.attempt); got != tt.want {
+			t.Errorf("backoff with Retry-After %q for attempt %d = %s, want %s", tt.retryAfter, tt.attempt, got,
+				tt.want)
+		}
+	}
+}
+
+// statusFred is a transport answering each request with the next of its statuses, with a Retry-After of 0
+type statusFred struct {
+	statuses []int
+	requests int
+}
+
+func (f *statusFred) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := f.statuses[f.requests]
+	f.requests++
+	return &http.Response{StatusCode: status, Status: http.StatusText(status),
+		Header: http.Header{"Retry-After": {"0"}}, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+func TestGetRetries(t *testing.T) {
+	defer SetClient(nil)
+	defer SetRetries(0)
+	for _, tt := range []struct {
+		name     string
+		retries  int
+		statuses []int
+		want     int // status returned
+		requests int
+	}{
+		{name: "no retries", retries: 0, statuses: []int{429, 200}, want: 429, requests: 1},
+		{name: "recovers", retries: 2, statuses: []int{429, 503, 200}, want: 200, requests: 3},
+		{name: "runs out", retries: 1, statuses: []int{429, 503, 200}, want: 503, requests: 2},
+		{name: "not retried", retries: 3, statuses: []int{404, 200}, want: 404, requests: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ff := &statusFred{statuses: tt.statuses}
+			SetClient(&http.Client{Transport: ff})
+			SetRetries(tt.retries)
+			resp, e := get(context.Background(), observationsPath, url.Values{}, "key")
+			if e != nil {
+				t.Fatal(e)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want || ff.requests != tt.requests {
+				t.Errorf("got %d after %d requests, want %d after %d", resp.StatusCode, ff.requests, tt.want,
+					tt.requests)
+			}
+		})
+	}
+}
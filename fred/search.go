@@ -0,0 +1,12 @@
+package fred
+
+import "net/url"
+
+// searchPath is the endpoint for the full-text search of series
+const searchPath = "series/search"
+
+// SearchSeries returns the metadata of the series whose title, notes or other attributes match text, most
+// relevant first: the first most of them, or all of them if most isn't positive.
+func SearchSeries(text string, most int, apiKey string) ([]SeriesInfo, error) {
+	return listSeries(searchPath, url.Values{"search_text": {text}}, most, apiKey)
+}
@@ -0,0 +1,168 @@
+package fred
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sink is a destination for the observations of a series, such as a warehouse table or an internal service.
+// CreateSchema is called before the first batch, WriteBatch with each batch of observations with values, in the
+// order they were fetched, and Finalize once, with the error the load failed with or nil if it succeeded.
+type Sink interface {
+	CreateSchema(seriesId string) error
+	WriteBatch(seriesId string, batch []Observation) error
+	Finalize(seriesId string, err error) error
+}
+
+// SinkMaker makes a Sink from its argument, which is blank if none was given.
+type SinkMaker func(arg string) (Sink, error)
+
+// SinkBatch is the number of observations Load passes to each call of WriteBatch
+const SinkBatch = 10000
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = map[string]SinkMaker{"csv": makeCSV}
+)
+
+// RegisterSink makes a sink available by name, so programs embedding the loader can add their own destinations,
+// typically in an init function.  Registering a name twice replaces the first.
+func RegisterSink(name string, maker SinkMaker) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks[strings.ToLower(name)] = maker
+}
+
+// NewSink makes the registered sink given as name or name:arg.
+func NewSink(spec string) (Sink, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	sinksMu.RLock()
+	maker, ok := sinks[strings.ToLower(name)]
+	sinksMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %s (registered: %s)", name, strings.Join(Sinks(), ", "))
+	}
+	return maker(arg)
+}
+
+// Sinks returns the names of the registered sinks, in order.
+func Sinks() []string {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load streams the series seriesId into sink, SinkBatch observations at a time.  Observations without a value
+// aren't written.  Canceling ctx abandons the requests, and the load fails.  The returned Series has every field
+// except Results.
+func Load(ctx context.Context, seriesId string, apiKey string, opts *Options, sink Sink) (series *Series, err error) {
+	if e := sink.CreateSchema(seriesId); e != nil {
+		return nil, e
+	}
+	defer func() {
+		if e := sink.Finalize(seriesId, err); err == nil {
+			err = e
+		}
+	}()
+	batch := make([]Observation, 0, SinkBatch)
+	series, err = StreamContext(ctx, seriesId, apiKey, opts, func(o Observation) error {
+		if o.Missing {
+			return nil
+		}
+		if batch = append(batch, o); len(batch) < SinkBatch {
+			return nil
+		}
+		e := sink.WriteBatch(seriesId, batch)
+		batch = make([]Observation, 0, SinkBatch)
+		return e
+	})
+	if err == nil && len(batch) > 0 {
+		err = sink.WriteBatch(seriesId, batch)
+	}
+	return series, err
+}
+
+// csvSink is the built-in csv sink, which writes the observations to a CSV file with columns series, date and
+// value.  Several series may be written to it, one call at a time: the file is replaced by the first and added to
+// by the rest, and it's open while any of them is.
+type csvSink struct {
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	created bool // true once the file has been replaced
+	open    int  // series between CreateSchema and Finalize
+}
+
+// makeCSV makes the built-in csv sink, which writes to the file its argument names (e.g. csv:/tmp/gdp.csv),
+// replacing it.
+func makeCSV(arg string) (Sink, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("csv needs a file, as in csv:/tmp/gdp.csv")
+	}
+	return &csvSink{path: arg}, nil
+}
+
+// CreateSchema creates the file and writes the header, the first time.  After that it opens the file, if it
+// isn't open, to add to it.
+func (s *csvSink) CreateSchema(seriesId string) error {
+	if s.file == nil && s.created {
+		f, e := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+		if e != nil {
+			return e
+		}
+		s.file, s.w = f, bufio.NewWriter(f)
+	}
+	if s.file == nil {
+		f, e := os.Create(s.path)
+		if e != nil {
+			return e
+		}
+		s.file, s.w, s.created = f, bufio.NewWriter(f), true
+		if _, e := s.w.WriteString("series,date,value\n"); e != nil {
+			return e
+		}
+	}
+	s.open++
+	return nil
+}
+
+// WriteBatch writes a line per observation.
+func (s *csvSink) WriteBatch(seriesId string, batch []Observation) error {
+	for _, o := range batch {
+		line := seriesId + "," + o.Date.Format(DateFormat) + "," + strconv.FormatFloat(o.Value, 'f', -1, 64) + "\n"
+		if _, e := s.w.WriteString(line); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Finalize flushes the file, closing it if no other series is being written.
+func (s *csvSink) Finalize(seriesId string, err error) error {
+	if s.open > 0 {
+		s.open--
+	}
+	if s.file == nil {
+		return nil
+	}
+	e := s.w.Flush()
+	if s.open > 0 {
+		return e
+	}
+	if ce := s.file.Close(); e == nil {
+		e = ce
+	}
+	s.file, s.w = nil, nil
+	return e
+}
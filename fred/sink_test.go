@@ -0,0 +1,47 @@
+package fred
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCSVSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	if e := os.WriteFile(path, []byte("old\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	sk, e := NewSink("csv:" + path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	obs := func(day int, value float64) []Observation {
+		return []Observation{{Date: time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC), Value: value}}
+	}
+	// two series at once, then a third once they're done
+	for _, step := range []func() error{
+		func() error { return sk.CreateSchema("A") },
+		func() error { return sk.CreateSchema("B") },
+		func() error { return sk.WriteBatch("A", obs(1, 1)) },
+		func() error { return sk.WriteBatch("B", obs(2, 2.5)) },
+		func() error { return sk.Finalize("A", nil) },
+		func() error { return sk.WriteBatch("B", obs(3, 3)) },
+		func() error { return sk.Finalize("B", nil) },
+		func() error { return sk.CreateSchema("C") },
+		func() error { return sk.WriteBatch("C", obs(4, -4)) },
+		func() error { return sk.Finalize("C", nil) },
+	} {
+		if e := step(); e != nil {
+			t.Fatal(e)
+		}
+	}
+	got, e := os.ReadFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := "series,date,value\nA,2020-01-01,1\nB,2020-01-02,2.5\nB,2020-01-03,3\nC,2020-01-04,-4\n"
+	if string(got) != want {
+		t.Errorf("file has\n%swant\n%s", got, want)
+	}
+}
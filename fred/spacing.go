@@ -0,0 +1,110 @@
+package fred
+
+import "time"
+
+// Gap is a stretch of a series with no observations, longer than its frequency allows
+type Gap struct {
+	After  time.Time // last date before the gap
+	Before time.Time // first date after the gap
+}
+
+// Spacing checks the spacing of a series' observation dates as they arrive.  It detects the frequency of the
+// series from the most common interval between dates, then reports the intervals that are too long for that
+// frequency.  Dates may arrive in either order.
+type Spacing struct {
+	prev      time.Time
+	started   bool
+	intervals map[int]int // number of intervals of each length in days
+	long      []Gap       // intervals that could be gaps for some frequency
+}
+
+// NewSpacing returns an empty Spacing.
+func NewSpacing() *Spacing {
+	return &Spacing{intervals: make(map[int]int)}
+}
+
+// Add records the next observation date.
+func (sp *Spacing) Add(date time.Time) {
+	if !sp.started {
+		sp.prev, sp.started = date, true
+		return
+	}
+	after, before := sp.prev, date
+	if before.Before(after) {
+		after, before = before, after
+	}
+	sp.prev = date
+	days := int(before.Sub(after).Hours() / 24)
+	sp.intervals[days]++
+	// daily series tolerate long weekends, so shorter intervals are never gaps
+	if days > maxDailyInterval {
+		sp.long = append(sp.long, Gap{After: after, Before: before})
+	}
+}
+
+// maxDailyInterval is the longest interval in days that isn't a gap in a daily series (a holiday next to a weekend)
+const maxDailyInterval = 5
+
+// Frequency returns the frequency code (D, W, BW, M, Q, SA or A) matching the most common interval between dates.
+// It returns "" if there are too few dates or the interval doesn't match a Fred II frequency.
+func (sp *Spacing) Frequency() string {
+	mode, most := 0, 0
+	for days, n := range sp.intervals {
+		if n > most || (n == most && days < mode) {
+			mode, most = days, n
+		}
+	}
+	switch {
+	case most == 0:
+		return ""
+	case mode <= 3:
+		return "D"
+	case mode >= 6 && mode <= 8:
+		return "W"
+	case mode >= 13 && mode <= 15:
+		return "BW"
+	case mode >= 28 && mode <= 31:
+		return "M"
+	case mode >= 89 && mode <= 92:
+		return "Q"
+	case mode >= 181 && mode <= 184:
+		return "SA"
+	case mode >= 365 && mode <= 366:
+		return "A"
+	}
+	return ""
+}
+
+// Gaps returns the intervals that are longer than the detected frequency allows.
+func (sp *Spacing) Gaps() []Gap {
+	freq := sp.Frequency()
+	var gaps []Gap
+	for _, g := range sp.long {
+		if isGap(g, freq) {
+			gaps = append(gaps, g)
+		}
+	}
+	return gaps
+}
+
+// isGap returns true if g is longer than the frequency freq allows.
+func isGap(g Gap, freq string) bool {
+	days := int(g.Before.Sub(g.After).Hours() / 24)
+	switch freq {
+	case "D":
+		return days > maxDailyInterval
+	case "W":
+		return days > 7
+	case "BW":
+		return days > 14
+	case "M":
+		return g.Before.After(g.After.AddDate(0, 1, 0))
+	case "Q":
+		return g.Before.After(g.After.AddDate(0, 3, 0))
+	case "SA":
+		return g.Before.After(g.After.AddDate(0, 6, 0))
+	case "A":
+		return g.Before.After(g.After.AddDate(1, 0, 0))
+	}
+	return false
+}
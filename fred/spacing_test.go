@@ -0,0 +1,57 @@
+package fred
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpacing(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		dates []string
+		freq  string
+		gaps  [][2]string // after and before of each gap
+	}{
+		{name: "no dates"},
+		{name: "one date", dates: []string{"2020-01-01"}},
+		{name: "daily with a weekend", dates: []string{"2020-01-02", "2020-01-03", "2020-01-06", "2020-01-07"},
+			freq: "D"},
+		{name: "daily with a gap", dates: []string{"2020-01-02", "2020-01-03", "2020-01-06", "2020-01-07",
+			"2020-01-20", "2020-01-21"}, freq: "D", gaps: [][2]string{{"2020-01-07", "2020-01-20"}}},
+		{name: "weekly", dates: []string{"2020-01-03", "2020-01-10", "2020-01-17"}, freq: "W"},
+		{name: "monthly", dates: []string{"2020-01-01", "2020-02-01", "2020-03-01", "2020-04-01"}, freq: "M"},
+		{name: "monthly with a gap", dates: []string{"2020-01-01", "2020-02-01", "2020-03-01", "2020-05-01",
+			"2020-06-01"}, freq: "M", gaps: [][2]string{{"2020-03-01", "2020-05-01"}}},
+		{name: "monthly newest first", dates: []string{"2020-06-01", "2020-05-01", "2020-03-01", "2020-02-01",
+			"2020-01-01"}, freq: "M", gaps: [][2]string{{"2020-03-01", "2020-05-01"}}},
+		{name: "quarterly", dates: []string{"2020-01-01", "2020-04-01", "2020-07-01", "2020-10-01"}, freq: "Q"},
+		{name: "semiannual", dates: []string{"2019-01-01", "2019-07-01", "2020-01-01"}, freq: "SA"},
+		{name: "annual with a gap", dates: []string{"2015-01-01", "2016-01-01", "2017-01-01", "2019-01-01"},
+			freq: "A", gaps: [][2]string{{"2017-01-01", "2019-01-01"}}},
+		{name: "no Fred II frequency", dates: []string{"2020-01-01", "2020-01-11", "2020-01-21"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := NewSpacing()
+			for _, d := range tt.dates {
+				date, e := time.Parse(DateFormat, d)
+				if e != nil {
+					t.Fatal(e)
+				}
+				sp.Add(date)
+			}
+			if got := sp.Frequency(); got != tt.freq {
+				t.Errorf("frequency %q, want %q", got, tt.freq)
+			}
+			gaps := sp.Gaps()
+			if len(gaps) != len(tt.gaps) {
+				t.Fatalf("gaps %v, want %v", gaps, tt.gaps)
+			}
+			for ind, g := range gaps {
+				if g.After.Format(DateFormat) != tt.gaps[ind][0] || g.Before.Format(DateFormat) != tt.gaps[ind][1] {
+					t.Errorf("gap %d is %s to %s, want %s to %s", ind, g.After.Format(DateFormat),
+						g.Before.Format(DateFormat), tt.gaps[ind][0], tt.gaps[ind][1])
+				}
+			}
+		})
+	}
+}
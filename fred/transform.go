@@ -0,0 +1,91 @@
+package fred
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Transform changes the observations of a series as they are decoded, for instance to filter outliers or make a
+// proprietary adjustment.  Apply returns the observation to use in place of o, and false if o is to be dropped.
+// Observations without a value (Missing) aren't passed to transforms.
+type Transform interface {
+	Apply(seriesId string, o Observation) (out Observation, keep bool, err error)
+}
+
+// TransformFunc lets an ordinary function be used as a Transform.
+type TransformFunc func(seriesId string, o Observation) (Observation, bool, error)
+
+// Apply calls f.
+func (f TransformFunc) Apply(seriesId string, o Observation) (Observation, bool, error) {
+	return f(seriesId, o)
+}
+
+// TransformMaker makes a Transform from its argument, which is blank if none was given.
+type TransformMaker func(arg string) (Transform, error)
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[string]TransformMaker{"scale": makeScale}
+)
+
+// RegisterTransform makes a transform available by name, so programs embedding the loader can add their own,
+// typically in an init function.  Registering a name twice replaces the first.
+func RegisterTransform(name string, maker TransformMaker) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	transforms[strings.ToLower(name)] = maker
+}
+
+// NewTransform makes the registered transform given as name or name:arg.
+func NewTransform(spec string) (Transform, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	transformsMu.RLock()
+	maker, ok := transforms[strings.ToLower(name)]
+	transformsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown transform %s (registered: %s)", name, strings.Join(Transforms(), ", "))
+	}
+	return maker(arg)
+}
+
+// Transforms returns the names of the registered transforms, in order.
+func Transforms() []string {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// makeScale makes the built-in scale transform, which multiplies values by its argument (e.g. scale:0.001).
+func makeScale(arg string) (Transform, error) {
+	k, e := strconv.ParseFloat(arg, 64)
+	if e != nil {
+		return nil, fmt.Errorf("scale needs a number, as in scale:0.001, not %q", arg)
+	}
+	return TransformFunc(func(seriesId string, o Observation) (Observation, bool, error) {
+		o.Value *= k
+		return o, true, nil
+	}), nil
+}
+
+// apply runs o through the transforms in order.  It returns false if one of them drops o.
+func apply(transforms []Transform, seriesId string, o Observation) (Observation, bool, error) {
+	if o.Missing {
+		return o, true, nil
+	}
+	for _, t := range transforms {
+		var keep bool
+		var e error
+		if o, keep, e = t.Apply(seriesId, o); e != nil || !keep {
+			return o, false, e
+		}
+	}
+	return o, true, nil
+}
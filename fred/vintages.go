@@ -0,0 +1,42 @@
+package fred
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// vintageDatesPath is the endpoint for the dates of the vintages of a series
+const vintageDatesPath = "series/vintagedates"
+
+// maxVintageDates is the most vintage dates Fred II returns for a request
+const maxVintageDates = 10000
+
+// GetVintageDates returns the dates, in order, on which the series seriesId was published or revised.  Each starts
+// a vintage in ALFRED.
+func GetVintageDates(seriesId string, apiKey string) ([]time.Time, error) {
+	var dates []time.Time
+	for offset := 0; ; offset += maxVintageDates {
+		var resp struct {
+			Count int      `json:"count"`
+			Dates []string `json:"vintage_dates"`
+		}
+		q := url.Values{"series_id": {seriesId}, "limit": {strconv.Itoa(maxVintageDates)},
+			"offset": {strconv.Itoa(offset)}}
+		if e := getJSON(context.Background(), vintageDatesPath, q, apiKey, &resp); e != nil {
+			return nil, e
+		}
+		for _, d := range resp.Dates {
+			dt, e := time.Parse(DateFormat, d)
+			if e != nil {
+				return nil, fmt.Errorf("series %s: cannot parse vintage date %q", seriesId, d)
+			}
+			dates = append(dates, dt)
+		}
+		if len(resp.Dates) == 0 || offset+len(resp.Dates) >= resp.Count {
+			return dates, nil
+		}
+	}
+}
@@ -1,206 +1,939 @@
 // Command fred2ch is a simple command that pulls a single series from the St Louis Federal Reserve database
 // Fred II then creates and populates a ClickHouse table for it.
 // Required command line arguments:
-//    -series         Fred II series id
+//    -series         Fred II series id, or a comma-separated list of them
 //    -table          destination ClickHouse table.
-//    -api            Fred II API key
+//    -api            Fred II API key, or - to read it from stdin
 //
 // Optional command line arguments:
-//    -host           IP of ClickHouse database. Default: 127.0.0.1
+//    -host           IP of ClickHouse database, or a comma-separated list to fail over between. Default: 127.0.0.1
 //    -user           ClickHouse user. Default: "default"
-//    -password       ClickHouse password. Default: ""
+//    -password       ClickHouse password, or - to read it from stdin. Default: ""
+//    -insert-settings ClickHouse settings for the inserts, as name=value,... e.g. insert_quorum=2. Default: none
+//    -compression    compression of the ClickHouse connection: lz4 or none. Default: lz4
+//    -ssh            [user@]host of an SSH bastion to tunnel to ClickHouse through. Default: none
+//    -wait-for-db    how long to keep retrying the connection to ClickHouse, e.g. 60s. Default: none
+//    -secure         connect to ClickHouse over TLS, on port 9440 unless -host gives one. Default: false
+//    -ca-cert        PEM file of CA certificates to trust for ClickHouse and Fred II. Default: none
+//    -insecure-skip-verify don't verify the TLS certificates of ClickHouse and Fred II. Default: false
+//    -tls-cert       PEM file of a client certificate to authenticate to ClickHouse with. Default: none
+//    -tls-key        PEM file of the private key of -tls-cert. Default: none
+//    -secrets        secret holding the API key and credentials: vault://path or aws-sm://id. Default: none
+//    -profile        profile of ClickHouse and Fred II settings to use, from -profiles. Default: none
+//    -profiles       YAML file with the profiles. Default: ~/.fred2ch.yaml
+//    -api-per-minute Fred II requests allowed per minute, 0 for no limit. Default: 120 (Fred II's own limit)
+//    -api-per-day    Fred II requests allowed per 24 hours. Default: no limit
+//    -max-retries    times a refused, failed or undelivered Fred II request is retried. Default: 5
+//    -rate           deprecated name of -api-per-minute
+//    -usage-table    table counting the Fred II requests made per API key per day. Default: none
+//    -batch          rows per insert. Default: 10000
+//    -last           load only the most recent N observations. Default: 0 (all)
+//    -start          load only the observations from this date (YYYY-MM-DD). Default: the first
+//    -end            load only the observations up to this date (YYYY-MM-DD). Default: the last
+//    -realtime-start load the values current from this date (YYYY-MM-DD), as ALFRED has them. Default: today
+//    -realtime-end   load the values current up to this date (YYYY-MM-DD). Default: today
+//    -vintages       load every vintage of the series, each value with the period it was current. Default: false
+//    -freq           frequency Fred II aggregates the series to: w, bw, m, q, sa or a. Default: the series' own
+//    -agg            how -freq aggregates the observations: avg, sum or eop (end of period). Default: avg
+//    -units          transformation Fred II applies to the values, e.g. pch (percent change). Default: lin (none)
+//    -formula        derive the series from others, e.g. "real_rate = DGS10 - T10YIE". Default: none
+//    -release        load every series of this Fred II release (e.g. 18, the H.15 interest rates). Default: none
+//    -category       load every series of this Fred II category. Default: none
+//    -recursive      with -category, also load the series of every category below it. Default: false
+//    -search         load every series matching this Fred II full-text search (the 1000 most relevant). Default: none
+//    -filter-frequency with -release, -category or -search, load only series of this frequency (e.g. M). Default: all
+//    -filter-units   with -release, -category or -search, load only series whose units contain this. Default: all
+//    -min-popularity with -release, -category or -search, load only series at least this popular. Default: 0
+//    -archive        table to archive the raw Fred II response in. Default: none
+//    -registry       table recording each load and its query parameters. Default: none
+//    -dead-letter    table recording observations the load rejects, with the reason. Default: none
+//    -skip-unchanged skip the load if the registry has it and Fred II hasn't updated the series since. Default: false
+//    -lock-table     table of advisory locks, so concurrent runs never write the same table at once. Default: none
+//    -latest         maintain this latest-readings table instead of loading -table. Default: none
+//    -meta-table     table to record the Fred II metadata of the series in. Default: none
+//    -meta           record the Fred II metadata of the series in <table>_meta. Default: false
+//    -dictionary     create a dictionary keyed by series ID over -meta-table. Default: none
+//    -create-db      create the databases of tables given as db.table if they don't exist. Default: false
+//    -namespace      put every table the load creates, and the registry, within namespace NS. Default: none
+//    -ddl-only       print the DDL the run would issue and exit, without touching Fred II or ClickHouse
+//    -dry-run        print the series the run would load and exit, without touching ClickHouse
+//    -col-series     name of the series ID column. Default: seriesId
+//    -col-date       name of the date column. Default: date
+//    -col-value      name of the value column. Default: value
+//    -detect-int     if every value is an integer, make the value column UInt32 or Int64. Default: false
+//    -rollup         comma-separated periods (monthly, quarterly, annual) to keep aggregates of. Default: none
+//    -rollup-engine  engine of the -rollup tables: aggregating or summing. Default: aggregating
+//    -preset         table layout preset: grafana. Default: none
+//    -period-end     add: also store period-end dates, replace: store them instead. Default: none
+//    -date-type      type of the date column: Date, Date32, DateTime or DateTime64 (see below). Default: Date
+//    -date32         make the date column Date32, to keep observations before 1970. Default: false
+//    -tz             location of the dates, e.g. America/Chicago, and time zone of DateTime columns. Default: UTC
+//    -zscore         add a zscore column: full for full-sample, or a trailing window length. Default: none
+//    -pct-rank       if true, add a pctRank column: the percentile rank of the value to date. Default: false
+//    -outlier        add an outlier flag column: k or k:window for k MADs from the trailing median. Default: none
+//    -events         where to send JSON lifecycle events: stdout, tcp://host:port or unix:///path. Default: none
+//    -config         load the series declared in this manifest, a jobs file, once each (see below). Default: none
+//    -transform      comma-separated transforms applied to each observation, e.g. scale:0.001. Default: none
+//    -sink           comma-separated sinks, name or name:arg, to write the observations to as well. Default: none
+//    -dupes          observations repeating a date: error, latest (keep the last) or all. Default: error
+//    -bad-dates      observations whose date can't be parsed: skip, error or a date to give them. Default: skip
+//    -nulls          observations Fred II has no value for: skip, null or zero. Default: skip
+//    -strict-json    warn of fields in Fred II responses that are unexpected or missing. Default: false
+//    -strict         fail the load at the first problem rather than working around it. Default: false
+//    -mode           replace, create or append to an existing table (see below). Default: replace
+//    -refresh        load only the dates after those already in the table; same as -mode append. Default: false
+//    -snapshot       keep the replaced table as a dated snapshot, keeping the newest N. Default: 0 (drop it)
+//    -backup-days    keep the replaced table as a timestamped backup for N days. Default: 0 (drop it)
+//    -cluster        create the table on every host of this ClickHouse cluster. Default: none
+//    -distributed    with -cluster, make the table Distributed over a local table per shard. Default: false
+//    -spool          directory to spool rows to if ClickHouse goes down during a load. Default: none
+//    -file-dir       insert through files in the server's user_files directory D. Default: none
+//    -file-format    format of the -file-dir files: values or csv. Default: values
+//    -buffer         insert through a Buffer table, <table>_buffer, in front of the table. Default: false
+//    -date-index     add a minmax skip index on the date column. Default: false
+//    -series-index   add a bloom_filter skip index on the series column. Default: false
+//    -projection     comma-separated columns ordering a projection of the table, e.g. date,seriesId. Default: none
+//    -fanout         comma-separated tables the load is fanned out to through a Null-engine -table. Default: none
+//    -insert-retries times a failed insert is retried, if the failure may be momentary. Default: 3
+//    -page-workers   pages of a series longer than 100,000 observations fetched at a time. Default: 4
+//    -workers        series of a list, release, category or search loaded at a time. Default: 1
+//    -breaker        loads failing in a row that stop the rest, 0 for never. Default: 0
+//    -breaker-cooldown how long to pause once -breaker trips, e.g. 5m, rather than stopping. Default: none
+//    -debug-http     log each Fred II request, its status, size and timing, to stderr. Default: false
+//    -color          color the statuses of the summary printed at the end of the run. Default: false
+//    -pprof-addr     address to serve net/http/pprof on, e.g. localhost:6060. Default: none
+//    -cpu-profile    file to write a CPU profile to. Default: none
+//    -mem-profile    file to write a heap profile to at the end of the run. Default: none
 //
-// The table created has these fields:
+// The table created has these fields (names can be changed with -col-series, -col-date and -col-value):
 //
 //     seriesId    String     series ID requested
 //     date        Date       date of metric value
 //     value       Float32    value of metric
 //
-// All months available for the series are loaded.
+// All observations available for the series are loaded, unless -last, -start or -end is given. Observations Fred II
+// reports as missing are skipped, unless -nulls says otherwise. Rows are inserted in batches while the series is
+// still downloading, so memory use doesn't grow with the length of the series.
+//
+// If -archive is given, the raw Fred II response is also saved to that table, along with the request url
+// (without the API key) and the time of the request, so the load can be replayed or audited later.
+// The archive table is created if needed and is never dropped:
+//
+//     seriesId    String     series ID requested
+//     url         String     request url
+//     fetched     DateTime   time of the request
+//     payload     String     raw response
+//
+// If -registry is given, each load is recorded in that table, including the Fred II query parameters used,
+// so loads of the same series with different transformations can be told apart.
+// The registry table is created if needed and is never dropped:
+//
+//     table              String     destination table
+//     seriesId           String     series ID loaded
+//     loaded             DateTime   time of the load
+//     rows               UInt64     rows loaded
+//     minDate            Date       first date loaded
+//     maxDate            Date       last date loaded
+//     units              String     units transformation requested
+//     frequency          String     frequency requested
+//     aggregation        String     aggregation method requested
+//     realtimeStart      String     start of real-time period requested
+//     realtimeEnd        String     end of real-time period requested
+//     query              String     full query, without the API key
+//     detectedFrequency  String     frequency detected from the dates
+//     provenance         String     formula deriving the series
+//     apiRequests        UInt64     Fred II requests made by the load
+//     downloaded         UInt64     bytes of Fred II responses
+//     peakHeap           UInt64     most bytes of heap in use during the load
+//     written            UInt64     bytes of rows sent to ClickHouse
+//     shape              String     settings shaping the table and its rows
+//
+// Blank parameters mean the Fred II default was used.
+//
+// With -ddl-only, the DROP and CREATE statements the run would issue are printed and nothing else is done, so
+// tables can be reviewed or created ahead of time. -api is not required.
+//
+// With -detect-int, a series whose values are all integers (counts such as housing starts) gets a UInt32 value
+// column, or Int64 if some value is negative or too large, so the values are stored exactly. The type can't be
+// chosen until the whole series has arrived, so the series is held in memory and -ddl-only shows Float32.
+//
+// With -latest, the run doesn't load -table (which isn't required). Instead it fetches only the newest few
+// observations and records the most recent value in the -latest table, which has one row per series and is
+// created if needed. It's a ReplacingMergeTree, so query it with FINAL:
+//
+//     seriesId    String     series ID
+//     date        Date       date of the latest value
+//     value       Float64    latest value
+//     updated     DateTime   time of the refresh
+//
+// If -meta-table is given, the series' Fred II metadata is recorded in that table, which has one row per series
+// and is created if needed. -meta records it in <table>_meta, next to the series table. It's a
+// ReplacingMergeTree, so query it with FINAL:
+//
+//     seriesId            String     series ID
+//     title               String     series title
+//     units               String     units
+//     frequency           String     frequency
+//     seasonalAdjustment  String     seasonal adjustment
+//     lastUpdated         DateTime   when Fred II last updated the series
+//     observationStart    String     first date available
+//     observationEnd      String     last date available
+//     notes               String     Fred II notes
+//     updated             DateTime   time of the refresh
+//
+// -dictionary additionally creates a ClickHouse dictionary over the metadata table, keyed by seriesId, so
+// queries can use e.g. dictGet('dict', 'title', tuple(seriesId)) instead of a join. The dictionary reads the
+// table as -user/-password; -ddl-only prints the password as REDACTED.
+//
+// For each -rollup period, an AggregatingMergeTree table <table>_<period> is created along with a materialized
+// view <table>_<period>_mv that fills it from the series table, so the aggregates stay current as rows are
+// loaded. They are dropped and recreated with the series table. The aggregate table has the series and date
+// columns (date is the start of the period, a Date) plus the aggregate states avg, min, max, sum, last and count,
+// which are read with the -Merge combinators, e.g. avgMerge(avg). Since a Date can't be before 1970, -rollup
+// can't be used with a Date32 or DateTime64 date column.
+//
+// -rollup-engine summing makes the aggregate tables SummingMergeTree tables instead. Their sum and count columns are
+// summed as parts merge and min and max are SimpleAggregateFunction columns, so queries aggregate them again without
+// combinators, e.g. sum(sum) / sum(count) for the average. They have no last column.
+//
+// -preset grafana lays the table out the way Grafana's ClickHouse datasource expects a time series: the columns
+// are metric, time (a DateTime) and value, and the table is ordered by metric, time. Column names given with
+// -col-series, -col-date and -col-value override the preset.
+//
+// Fred II dates monthly, quarterly, semiannual and annual observations by the start of the period. With
+// -period-end add, the table gets a periodEnd column holding the last day of the period; with -period-end
+// replace, the date column holds it instead. Daily and weekly observations are already dated by the end of the
+// period, so they are unchanged.
+//
+// The frequency of the series (D, W, BW, M, Q, SA or A) is detected from the spacing of its dates, and a
+// warning is printed for each stretch without observations that is longer than the frequency allows. The
+// detected frequency is recorded in the registry.
+//
+// -date-type DateTime or DateTime64 (e.g. -date-type "DateTime64(3, 'UTC')") gives the date column a time type,
+// so the data can be unioned with intraday tables. Dates are stored at midnight.
+//
+// A Date column, the default, can't hold dates before 1970, so the observations before then are skipped, counted in
+// the warnings summary and recorded in the -dead-letter table if there is one. -date32 (or -date-type Date32) makes
+// the column Date32, which holds dates from 1900, so long histories such as GNPCA's, back to 1929, are loaded whole.
+// A DateTime64 column holds them too. verify and bulk take -date32 for such tables.
+//
+// -formula loads a series derived from other Fred II series in place of -series (which isn't required). The
+// formula is "name = expression", where the expression uses series IDs, numbers, + - * /, parentheses and the
+// functions log, exp and abs. The series are aligned by date, so the derived series has a value on each date
+// where all of them do. It is loaded with seriesId set to name, and the formula is recorded in the registry.
+//
+// -series may list several series (e.g. -series CPIAUCSL,UNRATE,GDP), which are loaded in turn into the one table,
+// ordered by series then date. The first series loaded replaces the table (see -mode) and the rest are added to it.
+// A series that fails doesn't stop the others; the run exits with an error once they're all tried. A list can't be
+// used with -formula, -detect-int or -skip-unchanged, nor in a jobs file, where each series is its own job. Series
+// IDs aren't case-sensitive: the loads and the commands store and look them up in upper case, so -series gdp loads
+// GDP.
+//
+// -release loads all the series of a Fred II release in place of -series: e.g. -release 18 loads the H.15 Selected
+// Interest Rates. fred2ch lists the release's series, a page at a time, and loads them as it does a list given to
+// -series, into the one table.
+//
+// -category loads the series of a Fred II category in the same way, and with -recursive those of every category
+// below it too, walking the tree through its children, so one command can mirror a whole section of Fred II. A
+// series listed in more than one category is loaded once.
+//
+// -search loads the series matching a Fred II full-text search, the 1000 most relevant, in the same way. The series
+// picked by -release, -category or -search can be narrowed with -filter-frequency (the short code, such as M, or
+// the name, such as Monthly), -filter-units (a case-insensitive part of the units, such as Percent) and
+// -min-popularity (Fred II's popularity, 0 to 100). -dry-run prints the series picked, with their frequency, units,
+// popularity and title, and exits without loading them, so a search can be reviewed first.
+//
+// -workers N loads the series of a list, release, category or search N at a time. Once the first has created the
+// table, each worker fetches and parses its series while the others do theirs, and the workers take turns inserting
+// into the table. The Fred II requests of all of them count against -api-per-minute and -api-per-day.
+//
+// -breaker N stops a list, release, category or search, or the loads of a -config manifest, once N in a row have
+// failed, as when Fred II or ClickHouse is down, rather than grinding through the rest: those left fail without being
+// tried. With -breaker-cooldown D they wait D instead and then carry on, the breaker tripping again if the next fails
+// too. run takes -breaker and -breaker-cooldown as well.
+//
+// -mode decides what happens to an existing table. replace, the default, drops it (or keeps it as a snapshot or
+// backup). create fails, with an error matching chsink.ErrTableExists. append checks that the table has the
+// columns, and the types, the load writes -- failing with an error matching chsink.ErrSchemaMismatch if not -- and
+// inserts only the observations after the last date of the series in the table, so a later run picks up where an
+// earlier one stopped. Fred II is asked only for the observations from that date on, so a nightly update of a long
+// daily series downloads a few rows rather than all of them. -refresh is the same as -mode append. A table that
+// doesn't exist is created in every mode. append can't be used with -fanout, -zscore, -pct-rank or -outlier, and
+// -latest tables are always kept.
+//
+// -realtime-start and -realtime-end load the values of the series as they were known during that real-time period,
+// from ALFRED, rather than as revised since: e.g. -realtime-start 2008-10-01 -realtime-end 2008-10-01 loads the
+// vintage current on that day. -vintages asks Fred II for the series' vintage dates and loads every vintage from
+// the first on, so the table holds each value a date has had. With any of these the table gets two Date columns,
+// realtime_start and realtime_end, holding the first and last days each value was current, and is ordered by
+// realtime_start after the date. A value still current ends on 2149-06-06, the last date a Date column can hold.
+// Vintages can't be loaded with -formula, -latest, -rollup, -dupes latest, -zscore, -pct-rank, -outlier or -mode
+// append.
+//
+// -freq has Fred II aggregate the series to a lower frequency before it's sent, e.g. -freq m loads a daily series as
+// monthly observations dated the first of the month, so there's no need to aggregate it in ClickHouse. -agg says how:
+// avg, the default, averages the observations of the period, sum adds them up and eop takes the last. The registry
+// records both, and refresh repeats them.
+//
+// -start and -end limit the load to the observations in that window, e.g. -start 2000-01-01 -end 2020-12-31, and
+// only those are requested from Fred II. Either can be given alone.
+//
+// -units has Fred II transform the values before they're sent: lin (levels, the default), chg (change), ch1 (change
+// from a year ago), pch (percent change), pc1 (percent change from a year ago), pca (compounded annual rate of
+// change), cch (continuously compounded rate of change), cca (continuously compounded annual rate of change) or log
+// (natural log). The transformation is named in the comment of the value column, and recorded in the registry. The
+// first observations of a change have no value, so -nulls says what becomes of them.
+//
+// -zscore adds a zscore column (Float64) holding the z-score of each value, either against the whole series
+// (-zscore full) or against the trailing window of that many observations (e.g. -zscore 60). Computed columns
+// need the whole series, so it is held in memory before it is inserted.
+//
+// -pct-rank adds a pctRank column (Float64) holding the fraction of the observations up to and including that date
+// whose value is no greater, so the newest row answers "how unusual is today's reading" without window functions.
+// Only history is used, so past ranks don't change as the series grows.
+//
+// -outlier adds an outlier column (UInt8) that is 1 where the value is more than k median absolute deviations from
+// the median of the window observations before it (-outlier 5:60; the window defaults to 60), so obviously
+// erroneous prints can be excluded with WHERE outlier = 0. Observations without a full window, or whose window has
+// no variation, get 0.
+//
+// -tz sets the location the dates are in: each date is midnight there, as is a -bad-dates sentinel.
+// A DateTime or DateTime64 date column without a time zone gets -tz as its time zone, so the stored instants agree
+// with the dates; give -date-type a time zone of its own to override it. Date columns are unaffected.
+//
+// -lock-table makes the run lock the destination table while it writes it, so two concurrent runs (on any machines)
+// can't drop and recreate the same table under each other. The locks are rows in the lock table, which is created
+// if it doesn't exist, timed by the ClickHouse server rather than the machines' clocks. A run that finds the table
+// locked fails. The run holding a lock refreshes it every 2 minutes while it loads, and a lock left by a run that
+// died expires 10 minutes after its last refresh, so a load of any length keeps its lock.
+//
+// A jobs file declares many loads to run with one command. It gives the ClickHouse and Fred II access (host,
+// user, password, api) and a list of jobs. Each job takes the settings of a load, named as the flags are, plus an
+// optional name and a schedule, the interval between runs as a Go duration. For instance:
+//
+//     host: 127.0.0.1
+//     api: 0123456789abcdef0123456789abcdef
+//     jobs:
+//       - name: cpi
+//         series: CPIAUCSL
+//         table: fred.cpi
+//         registry: fred.registry
+//         zscore: full
+//         schedule: 24h
+//       - series: UNRATE
+//         latest: fred.latest
+//
+// A job that fails doesn't stop the others; run exits with status 1 if any job failed.
+//
+// -config F loads the series declared in F, a jobs file used as a manifest that can be kept in version control, each
+// once, whatever its schedule: the same as fred2ch run -jobs F -once. Each job has its own table, window (start and
+// end), units transformation and mode (replace or append), with the defaults block giving those they share:
+//
+//     api: ${FRED_API_KEY}
+//     defaults:
+//       registry: fred.registry
+//       mode: append
+//     jobs:
+//       - series: GNPCA
+//         table: fred.gnp
+//         date32: true
+//       - series: DGS10
+//         table: fred.dgs10_2000s
+//         start: 2000-01-01
+//         end: 2009-12-31
+//         mode: replace
+//       - series: CPIAUCSL
+//         table: fred.cpi_yoy
+//         units: pc1
+//
+// The file gives the ClickHouse and Fred II access, so of the other flags only -debug-http and -color apply.
+//
+// A jobs file can refer to variables as ${NAME}, or ${NAME:-default} to fall back on a default. Variables come
+// from the vars block of the file (whose values may refer to environment variables), then the environment;
+// -var name=value overrides them. Settings in the defaults block apply to every job that doesn't set them. So one
+// file serves dev, stage and prod:
+//
+//     api: ${FRED_API_KEY}
+//     vars:
+//       db: fred_${ENV:-dev}
+//     defaults:
+//       registry: ${db}.registry
+//     jobs:
+//       - series: CPIAUCSL
+//         table: ${db}.cpi
+//
+// A reference to a variable that isn't set and has no default is an error.
+//
+// -transform runs each observation with a value through the named transforms, in order, as it is fetched.
+// A transform is given as name or name:argument. The built-in transform scale:k multiplies values by k. Programs
+// embedding the loader add their own transforms, such as outlier filters or proprietary adjustments, by
+// implementing fred.Transform and registering it with fred.RegisterTransform.
+//
+// -sink writes the observations to other destinations too, as each batch is inserted into the table. A sink is
+// given as name or name:argument, and several are separated by commas. Each sink is made once per run and the loads
+// of the run share it, taking turns, so a list's series all go to the same place. Only observations with values are
+// written to a sink. The built-in sink csv:F writes the series to CSV file F, replacing it the first time it's
+// written in the run. Programs embedding the loader add their own destinations, such as internal services or other
+// warehouses, by implementing fred.Sink and registering it with fred.RegisterSink.
+//
+// -events emits lifecycle events as JSON objects, one per line, so orchestrators (Airflow, Dagster, ...) can
+// follow a run as it goes. Each has event (started, skipped, fetched, inserted, finished or failed), time, series
+// and table; fetched has rows (observations fetched), inserted has rows (in the batch) and total (so far), finished
+// has rows and seconds, and failed has seconds and error. In a jobs file, events: gives the destination for all the
+// jobs. With -events stdout, fred2ch's own messages go to stderr, so stdout carries only the events.
+//
+// Fred II can return more than one observation for a date, for instance with some combinations of real-time
+// parameters. -dupes says what to do: error (the default) fails the load, latest keeps the last observation for
+// each date in the response, which is the latest vintage, and all loads them all. latest holds the whole series
+// in memory.
+//
+// Giving -password or -api as - reads it from stdin, so secrets stay out of shell history and process listings.
+// At a terminal the secret is prompted for without echo; otherwise it is the next line of stdin, the password
+// first if both are -. The commands read -password and -api the same way.
+//
+// FRED_API_KEY, CH_HOST, CH_USER and CH_PASSWORD in the environment stand in for -api, -host, -user and -password
+// when those flags aren't given, so the key and password needn't appear in shell history or cron logs. Flags, a
+// profile and a secret take precedence over the environment. The commands read the environment the same way, and a
+// jobs file takes from it the settings it leaves out.
+//
+// -insert-settings sets ClickHouse settings for the session the run inserts with, so loads into replicated
+// clusters get the durability they need, e.g. -insert-settings insert_quorum=2,insert_distributed_sync=1 or
+// max_insert_threads=4. The commands take it too, and a jobs file gives it as insert-settings.
+//
+// A batch whose insert ClickHouse refuses in a way that may not recur -- too many parts, too many queries, a replica
+// that is briefly read-only or a refused connection -- is retried after waiting 1 second, then 2, 4 and so on up to 30
+// seconds, up to -insert-retries times. Other failures, such as a schema mismatch, fail the load at once, as do a
+// timeout or a dropped connection, after which the batch may have been inserted and retrying it would duplicate it.
+//
+// -spool DIR keeps the Fred II requests a load has made from being wasted if ClickHouse goes down partway. Once an
+// insert still fails after the retries because ClickHouse can't be reached, the rest of the series is fetched and
+// written to a file in DIR rather than ClickHouse, and the load fails. The next run with -spool DIR inserts the
+// spooled rows before its own load, creating the table if the failed load hadn't, and run does so before each round
+// of jobs, so a daemon catches up once ClickHouse is back. The rows already inserted stay in the table. Spooled rows
+// aren't registered, -snapshot and -backup-days don't apply to them, and -spool can't be used with -latest.
+//
+// -compression sets the compression of the ClickHouse connection. lz4, the default, cuts the time to load long
+// series into a remote cluster over a slow link; none saves the CPU on a local server. zstd is refused: the
+// ClickHouse driver fred2ch is built with, clickhouse-go v2.0.14, compresses only with lz4. The commands take
+// -compression too, and a jobs file gives it as compression.
+//
+// -file-dir D inserts each batch by writing it to a file in directory D and having ClickHouse read it with the
+// file() table function (INSERT ... SELECT * FROM file(...)), rather than sending the rows over the connection. The
+// server parses the file itself, which is far faster for big backfills. D must be the server's user_files_path, so
+// fred2ch runs on the ClickHouse host or D is a directory both share. The files are readable by all, since the
+// server may run as another user, and are removed once they're inserted. -file-format says how they're written:
+// values (SQL VALUES rows, the default) or csv, with \N for NULL. Parquet isn't available, since fred2ch isn't
+// built with a Parquet writer. fred2ch bench -file-dir D compares both formats with the other insert paths.
+//
+// -buffer puts a Buffer table, <table>_buffer, in front of the table (or the -latest table) and sends the inserts to
+// it. ClickHouse flushes the buffer into the table every 10 to 100 seconds, so many small, frequent loads -- a jobs
+// file refreshing latest readings every minute, say -- make a few large parts rather than a part per insert. Until a
+// flush, the new rows are seen by queries of <table>_buffer but not of the table itself.
+//
+// -date-index and -series-index add data-skipping indexes to the table: a minmax index on the date column and a
+// bloom_filter index on the series column. They help queries of very large tables shared by many series that filter
+// on the column the table isn't ordered by.
+//
+// -projection adds a projection to the table holding its rows in another order, e.g. -projection date,seriesId for a
+// table shared by many series that's ordered by series (as -preset grafana's is) but also scanned by date. ClickHouse
+// keeps the projection current as rows are inserted and uses whichever order suits a query, without a second table.
+// The columns are named as the table has them.
+//
+// -fanout T1,T2,... makes -table a landing table with the Null engine, which stores nothing, and creates a
+// materialized view <T>_mv for each target T that copies every inserted row into it. So a single load fills several
+// tables shaped for different uses. Targets that don't exist are created as the series table would be; a target
+// created beforehand can have its own engine, order and columns, and keeps the columns of the landing table it has.
+// The rows of the series already in a target are deleted before the load. The views are dropped and recreated with
+// the landing table, but the targets are kept. -fanout can't be used with -latest, and verify and list should be
+// pointed at a target rather than the landing table.
+//
+// -api-per-minute and -api-per-day set a budget for the Fred II requests of the run: 120 a minute (Fred II's own
+// limit) and none a day unless set otherwise, 0 for no limit. A request that would exceed either waits until the
+// oldest request in the budget's window ages out, so a long mirror job stays within the API key's quota rather than
+// being refused; a load canceled meanwhile stops waiting. Jobs files give them as api-per-minute and api-per-day;
+// run then reports, after each job, the requests made so far and when the jobs still waiting are projected to
+// finish at the average requests per job and the pace the budget allows. -rate, the old name of -api-per-minute
+// (rate in jobs files), still works but is deprecated and warns; if given, it overrides -api-per-minute.
+//
+// A request Fred II refuses for too many requests (429) or fails with a server error (5xx), or one that fails on
+// the way to Fred II (a reset connection, a timeout), is retried up to -max-retries times, 5 by default, after 1s,
+// 2s, 4s and so on, at most a minute (or as long as Fred II's Retry-After says), so a large batch load rides out a
+// bad patch rather than dying halfway. Jobs files give it as max-retries.
+//
+// -usage-table U counts the Fred II requests made with each API key each day in table U, which is created if it
+// doesn't exist, so runs on several hosts or jobs files sharing a key can see what it has used between them. The key
+// is recorded by the start of its SHA-256 hash, not as is. With -api-per-day too, each load warns once the day's
+// requests with the key pass 80% of it. The columns of U, a SummingMergeTree, are:
+//
+//     key                String     start of the SHA-256 of the API key
+//     day                Date       day of the requests, in the ClickHouse server's time zone
+//     requests           UInt64     Fred II requests made
+//
+// Query it with SELECT key, day, sum(requests) FROM U GROUP BY key, day. A jobs file gives it as usage-table.
+//
+// Fred II returns at most 100,000 observations per request. A longer series is fetched a page at a time: once the
+// first page says how many observations there are, the rest are fetched -page-workers at a time and loaded in
+// order. A page holds its worker until it's loaded, so no more than -page-workers pages wait in memory.
+//
+// -skip-unchanged checks the series' last update time, which Fred II gives cheaply, before downloading its
+// observations. If the registry records a load of the series into the table with the same query since then, the
+// load is skipped, so a daily sync of many series only spends its API quota on those that have changed.
+//
+// If -dead-letter is given, observations the load rejects are recorded in that table rather than silently
+// skipped: values or dates that can't be parsed, and dates before 1970, which a Date column can't hold. Observations
+// Fred II reports as missing aren't rejections. The table is created if needed and is never dropped:
+//
+//     table      String     destination table
+//     seriesId   String     series ID loaded
+//     date       String     date as given by Fred II
+//     value      String     value as given by Fred II
+//     reason     String     why the observation was rejected
+//     rejected   DateTime   time of the load
+//
+// -bad-dates says what to do with observations whose date can't be parsed: skip (the default) drops them, recording
+// them in the -dead-letter table if there is one; error fails the load; and a date, e.g. -bad-dates 1970-01-01, is
+// given to them as a sentinel, so they are loaded and can be found. The dates that couldn't be parsed are counted in
+// the warnings summary at the end of the load.
+//
+// Values are parsed strictly as decimal numbers before they are inserted, and only the parsed number is written to
+// ClickHouse, never Fred II's text. A value that isn't a plain decimal number ("NaN", "Inf", "0x10", a truncated
+// payload, ...) is skipped, counted in the warnings summary and recorded in the -dead-letter table if there is one.
+// Values Fred II reports as missing (".") are never parsed: -nulls says what they become. skip, the default, leaves
+// them out of the table; null makes the value column Nullable and loads them as NULL; and zero loads them as 0.
+// -nulls null can't be used with -rollup, -zscore, -pct-rank or -outlier, and neither null nor zero with -latest.
+//
+// -ssh user@bastion reaches ClickHouse through an SSH tunnel from a jump host, for clusters not reachable directly.
+// fred2ch runs the system's ssh to forward a local port to port 9000 of -host as seen from the bastion, so keys,
+// agents and ~/.ssh/config settings for the bastion apply. ssh is stopped when the run ends, whether or not it
+// succeeds, and on Linux also if fred2ch is killed. The commands take -ssh too, and a jobs file gives it as ssh. A
+// -host may also give a port other than 9000, e.g. -host 10.0.0.5:9440.
+//
+// -strict-json checks each Fred II response against the fields fred2ch expects and prints a warning, once per
+// request, for each field it doesn't know and for observations missing their date or value, rather than silently
+// ignoring or zero-valuing them. Changes to the API or truncated payloads then show up on the first load they affect.
+//
+// By default a load works around the problems it finds in a series -- dates or values that can't be parsed, dates
+// before 1970, gaps in the dates and, with -strict-json, unexpected or missing fields in Fred II responses -- and
+// ends with a summary of how many of each it met, e.g. "warnings for series GDP: 2 date before 1970, 1 gap". -strict
+// makes each of them fail the load instead, whatever -bad-dates says, so a pipeline that must not load questionable
+// data stops at the first. Observations Fred II reports as missing aren't problems.
+//
+// -snapshot N keeps the table a load replaces rather than dropping it: the old table is renamed with the date as a
+// suffix, e.g. GDP_20240115, and only the newest N such snapshots are kept, the older ones being dropped. A second load
+// the same day replaces that day's snapshot. Each month's view of a series is then kept for backtesting. -snapshot
+// can't be used with -fanout or -latest, whose tables aren't replaced, and -ddl-only doesn't show the renames.
+//
+// -backup-days N is a safety net for the table a load replaces: rather than being dropped, the old table is renamed
+// with the time as a suffix, e.g. GDP_backup_on_20240115093000, and backups more than N days old are dropped. If a
+// load goes wrong, or loads the wrong series, the old table is recovered with RENAME TABLE. -backup-days can't be
+// used with -snapshot, -fanout or -latest, and -ddl-only doesn't show the renames.
+//
+// -debug-http logs each request made to Fred II to stderr: the URL, with the API key replaced by REDACTED, the
+// protocol and status, the size of the response and the time to its headers and to its end, e.g.
+//
+//     fred: GET https://api.stlouisfed.org/fred/series/observations?api_key=REDACTED&...: HTTP/2.0 200 OK, 48213 bytes,
+//     headers in 412ms, done in 590ms
+//
+// Slow headers point to throttling or a proxy, 429 and 5xx statuses to the rate limits. Requests that fail outright
+// are logged with the error. Requests share one HTTP/2 connection, or a pool of kept-alive connections if a proxy
+// only speaks HTTP/1.1, so the TLS handshake isn't repeated for each request.
+//
+// -secure connects to ClickHouse over TLS. -ca-cert names a PEM file of CA certificates trusted as well as the
+// system's, for a ClickHouse server with a private CA or a corporate proxy that re-signs the Fred II HTTPS traffic,
+// and -insecure-skip-verify turns verification of certificates off altogether, for testing only. Both apply to Fred
+// II requests and, with -secure, to ClickHouse. The commands take them too, and a jobs file gives them as secure,
+// ca-cert and insecure-skip-verify.
+//
+// -tls-cert and -tls-key give a client certificate and its key, in PEM files, for ClickHouse servers that authenticate
+// clients by certificate. They imply -secure. The commands take them too, and a jobs file gives them as tls-cert and
+// tls-key.
+//
+// -wait-for-db 60s keeps trying to connect to ClickHouse for up to a minute, backing off from one second between
+// attempts, for containers started alongside ClickHouse that may run before it's ready. Only failures that may clear
+// up, such as a refused connection, are retried; a bad password fails at once. The commands take -wait-for-db too,
+// and a jobs file gives it as wait-for-db.
+//
+// A load ends with a summary table giving the series, the rows loaded, the first and last dates, the time taken and the
+// status: ok, skipped (-skip-unchanged) or failed. The run command prints one for each round of jobs, with a line per
+// job. With -color the statuses are green, yellow and red.
+//
+// Each load reports the resources it used: the Fred II requests made for its observations and the megabytes of them
+// downloaded, which don't include those of other loads running at the same time with -workers, the peak heap,
+// sampled every quarter second, and the megabytes of rows sent to ClickHouse, before compression. With -registry
+// these are recorded with the load, as apiRequests, downloaded, peakHeap and written, for capacity planning; older
+// registries get the columns added.
+//
+// -profile names a set of ClickHouse and Fred II settings kept in the profiles block of a YAML file, ~/.fred2ch.yaml
+// unless -profiles gives another, so dev, staging and prod targets, each with its own API key, can be switched with
+// one flag. The settings have the names of the flags. Settings given as flags take precedence over the profile, which
+// takes precedence over the defaults. The commands take -profile and -profiles too, and a jobs file can have its own
+// profiles block, chosen with run -profile:
+//
+//     profiles:
+//       dev:
+//         host: localhost
+//         api: DEVKEY
+//       prod:
+//         host: ch1.example.com,ch2.example.com
+//         user: loader
+//         password: "-"
+//         secure: true
+//         api: PRODKEY
+//
+// -secrets fetches the API key and ClickHouse credentials from a secrets manager at startup, so they needn't be
+// kept in files, flags or the environment. vault://path reads the secret at path from HashiCorp Vault, at $VAULT_ADDR
+// with the token $VAULT_TOKEN (and $VAULT_NAMESPACE if set), from a KV version 1 or 2 engine. aws-sm://id reads AWS
+// Secrets Manager secret id with the aws command, so its usual credentials apply. The secret is a JSON object of
+// settings named as the flags, e.g. {"api": "...", "user": "loader", "password": "..."}. Settings given as flags take
+// precedence over the secret, which takes precedence over a profile. The commands take -secrets too, and a jobs file
+// gives it as secrets.
+//
+// Any table may be given as database.table. With -create-db the databases of the tables a load writes are created, if
+// they don't already exist, before anything is fetched from Fred II, rather than the load failing partway when it first
+// writes to a missing one. -ddl-only shows the CREATE DATABASE statements too.
+//
+// -namespace NS lets teams share a ClickHouse cluster and a deployment of fred2ch without their tables colliding. Every
+// table a load creates or records, including the registry, archive, dead-letter, lock, latest-readings, metadata and
+// fanout tables and the dictionary, is put within NS: a table given as db.table goes in database NS_db, so -create-db
+// creates that, and any other table is named NS_table. So each namespace has its own registry. list, refresh and
+// delete take -namespace too, and a jobs file gives it as namespace, in its defaults or for a job.
+//
+// -cluster C creates the table on every host of ClickHouse cluster C (CREATE TABLE ... ON CLUSTER C). With
+// -distributed too, it creates a local table, named with the suffix _local, on each shard and makes the table itself a
+// Distributed table over them, sharded by series, so the load and queries have a single entry point. Inserts into a
+// Distributed table reach the shards in the background unless -insert-settings has insert_distributed_sync=1.
+// -cluster can't be used with -rollup, -fanout, -buffer, -snapshot, -backup-days or -latest.
+//
+// fred2ch also has these commands, which take -host, -user, -password and -api like a load:
+//
+//     fred2ch recessions -table T [-series USREC]
+//         load a 0/1 recession indicator (USREC, USRECQ, USRECD, ...) into table T, replacing it, with a row
+//         per recession: seriesId String, start Date32, end Date32, ongoing UInt8 (1 if not yet over)
+//     fred2ch verify -series X -table T [-date32] [-preset P] [-col-series C] [-col-date C] [-col-value C]
+//         re-fetch series X and compare it with its rows in table T, listing dates missing from T, values that
+//         differ and rows Fred II doesn't have. Nothing is changed; the exit status is 1 if they disagree
+//     fred2ch delete -series X -table T [-registry R] [-namespace NS] [-preset P] [-col-series C]
+//         delete the rows of series X from table T, which other series share, and its loads into T from registry
+//         R. ClickHouse applies the deletes in the background. It's an error if T has no rows of X
+//     fred2ch list -registry R [-table T] [-meta-table M] [-namespace NS] [-preset P] [-col-series C]
+//         list the series in registry R (only those in table T, if given) with the table they are in, the rows,
+//         dates covered and time of their latest load, and their titles from metadata table M
+//     fred2ch info -series X
+//         print the Fred II metadata of series X: title, units, frequency, seasonal adjustment, observation range,
+//         last update and notes. Only -api is needed, ClickHouse isn't touched
+//     fred2ch refresh -registry R [-table T] [-batch N] [-lock-table L] [-namespace NS] [-preset P] [-col-* C]
+//         reload each series in registry R (only those in table T, if given) that Fred II has updated since its
+//         latest load, repeating the recorded query, and record the reloads. The rows of the series in its table
+//         are replaced, in the shape its load recorded; -preset and -col-* give the shape of loads recorded before
+//         registries had it. Derived series are reloaded when any series they come from is updated
+//     fred2ch run -jobs F [-once] [-profile P] [-debug-http] [-color] [-var name=value ...]
+//         run the loads declared in the YAML jobs file F. Jobs with a schedule are repeated at that interval until
+//         the command is stopped, the others run once. With -once every job runs once. A summary table follows each
+//         round of jobs. -profile P uses the settings of profile P of F's profiles block over those at the top of
+//         F. -debug-http, -color, -breaker and -breaker-cooldown are as for a load, but a breaker without a
+//         cooldown stops run once it trips. While run waits for the next job, SIGHUP reloads F: if it checks out,
+//         its jobs replace the running ones, new jobs running at once and the rest keeping their schedules,
+//         otherwise the error is printed and the jobs carry on. The connection, API key and budgets are kept.
+//     fred2ch bench [-table T] [-rows N | -series X] [-batch N,N,...] [-file-dir D]
+//         time loading N synthetic rows (default 1,000,000), or series X, into scratch table T (default fred2ch_bench)
+//         by the row-text writer fred2ch uses and by the driver's native batch insert, at each batch size (default
+//         10000,100000), reporting rows per second and MB allocated. T is dropped at the end. With -file-dir D the
+//         inserts through the file() table function that -file-dir gives a load are timed too, once in each
+//         -file-format
+//     fred2ch bulk -archive A -table T [-series X,Y,...] [-batch N] [-date32] [-preset P] [-col-* C]
+//         load the series of Fred II bulk download A, a path or URL of a zip of CSV files or of a single CSV file,
+//         into table T, which is replaced and ordered by series and date. A CSV file has the dates in its first
+//         column and a series in each other, named by its header; a column headed VALUE is the series the file is
+//         named for. With -series only those series are loaded. Far faster than the API for a first backfill
+//     fred2ch copy -from T1 -to T2 [-series X,Y,...] [-start D] [-end D] [-preset P] [-col-* C]
+//         replace table T2 with a table of the same columns and engine as T1 and copy T1's rows into it within
+//         ClickHouse, only those of the listed series and from date D to date D (YYYY-MM-DD) if given, e.g. to
+//         promote a staging load to production. Views fed by T1, such as rollups, aren't copied
+//     fred2ch diff -table-a A -table-b B [-series X,Y,...] [-max N] [-preset P] [-col-* C]
+//         compare two loads of the same series, e.g. before and after a change of vintage or transform: print the
+//         rows in A and B, the number of dates only in one of them and of dates whose values differ, and the first
+//         N (default 20) of those dates with both values and the change
+//     fred2ch doctor [-db D] [-color]
+//         check what a load needs and print PASS or FAIL for each: that Fred II answers and accepts the API key,
+//         that ClickHouse answers, that the user can create, write and drop a table in database D (the user's
+//         default if not given) and that the local clock is within 5 seconds of ClickHouse's. It takes the
+//         connection flags, -profile and -secrets as a load does. The first thing to run when a load fails
 //
 // Series names are case-insensitive.
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"github.com/ClickHouse/clickhouse-go/v2"
-	"github.com/invertedv/chutils"
-	s "github.com/invertedv/chutils/sql"
-	"io"
+	"github.com/invertedv/fred2ch/fred"
 	"log"
-	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// Datum is the data for a single date
-type Datum struct {
-	RtStart string `json:"realtime_start,omitempty"`
-	RtEnd   string `json:"realtime_end,omitempty"`
-	Date    string `json:"date,omitempty"`
-	Value   string `json:"value,omitempty"`
+func main() {
+	if runCommand() {
+		return
+	}
+	if e := run(); e != nil {
+		log.Fatalln(e)
+	}
 }
 
-// Series is the outermost struct returned by the http Get
-type Series struct {
-	ObservationStart string  `json:"observation_start,omitempty"`
-	ObservationEnd   string  `json:"observation_end,omitempty"`
-	Units            string  `json:"units,omitempty"`
-	OrderBy          string  `json:"order_by,omitempty"`
-	Count            int     `json:"count,omitempty"`
-	RealtimeStart    string  `json:"realtime_start,omitempty"`
-	RealtimeEnd      string  `json:"realtime_end,omitempty"`
-	OutputType       int     `json:"output_type,omitempty"`
-	FileType         string  `json:"file_type,omitempty"`
-	SortOrder        string  `json:"sort_order,omitempty"`
-	Offset           int     `json:"offset,omitempty"`
-	Limit            int     `json:"limit,omitempty"`
-	Results          []Datum `json:"observations,omitempty"`
-}
+// run runs a load as the command line describes.  Its failures are returned rather than exiting, so the deferred
+// cleanup, such as writing the profiles of a failed run and closing any SSH tunnel, happens whatever the outcome.
+func run() error {
+
+	acct := &account{}
+	acct.addFlags(flag.CommandLine)
+	flag.IntVar(&acct.PerMinute, "api-per-minute", defaultPerMinute, "int")
+	flag.IntVar(&acct.PerDay, "api-per-day", 0, "int")
+	flag.IntVar(&acct.MaxRetries, "max-retries", defaultMaxRetries, "int")
+	flag.Func("rate", "int", func(v string) error {
+		rate, e := strconv.Atoi(v)
+		acct.Rate = &rate
+		return e
+	})
+	flag.StringVar(&acct.UsageTable, "usage-table", "", "string")
+	profilePtr := flag.String("profile", "", "string")
+	profilesPtr := flag.String("profiles", "", "string")
 
-// apiUrl is the address of the API
-const apiUrl = "https://api.stlouisfed.org/fred/series/observations"
+	ls := &loadSpec{}
+	flag.StringVar(&ls.Series, "series", "", "string")
+	flag.StringVar(&ls.Formula, "formula", "", "string")
+	flag.IntVar(&ls.Release, "release", 0, "int")
+	flag.IntVar(&ls.Category, "category", 0, "int")
+	flag.BoolVar(&ls.Recursive, "recursive", false, "bool")
+	flag.StringVar(&ls.Search, "search", "", "string")
+	flag.StringVar(&ls.FilterFrequency, "filter-frequency", "", "string")
+	flag.StringVar(&ls.FilterUnits, "filter-units", "", "string")
+	flag.IntVar(&ls.MinPopularity, "min-popularity", 0, "int")
+	dryRunPtr := flag.Bool("dry-run", false, "bool")
 
-func main() {
+	flag.StringVar(&ls.Table, "table", "", "string")
+	flag.IntVar(&ls.Batch, "batch", defaultBatch, "int")
+	flag.IntVar(&ls.Last, "last", 0, "int")
+	flag.StringVar(&ls.Start, "start", "", "string")
+	flag.StringVar(&ls.End, "end", "", "string")
+	flag.StringVar(&ls.RealtimeStart, "realtime-start", "", "string")
+	flag.StringVar(&ls.RealtimeEnd, "realtime-end", "", "string")
+	flag.BoolVar(&ls.Vintages, "vintages", false, "bool")
+	flag.StringVar(&ls.Freq, "freq", "", "string")
+	flag.StringVar(&ls.Agg, "agg", "", "string")
+	flag.StringVar(&ls.Units, "units", "", "string")
+	flag.StringVar(&ls.Archive, "archive", "", "string")
+	flag.StringVar(&ls.Registry, "registry", "", "string")
+	flag.StringVar(&ls.DeadLetter, "dead-letter", "", "string")
+	flag.BoolVar(&ls.SkipUnchanged, "skip-unchanged", false, "bool")
+	flag.StringVar(&ls.LockTable, "lock-table", "", "string")
+	flag.StringVar(&ls.Latest, "latest", "", "string")
+	flag.StringVar(&ls.MetaTable, "meta-table", "", "string")
+	flag.BoolVar(&ls.Meta, "meta", false, "bool")
+	flag.StringVar(&ls.Dictionary, "dictionary", "", "string")
+	flag.BoolVar(&ls.CreateDB, "create-db", false, "bool")
+	flag.StringVar(&ls.Namespace, "namespace", "", "string")
+	ddlOnlyPtr := flag.Bool("ddl-only", false, "bool")
 
-	hostPtr := flag.String("host", "127.0.0.1", "string")
-	userPtr := flag.String("user", "", "string")
-	passwordPtr := flag.String("password", "", "string")
+	// column settings are only set if given, so they override the preset
+	colSeriesPtr := flag.String("col-series", "seriesId", "string")
+	colDatePtr := flag.String("col-date", "date", "string")
+	colValuePtr := flag.String("col-value", "value", "string")
+	flag.BoolVar(&ls.DetectInt, "detect-int", false, "bool")
+	flag.StringVar(&ls.Rollup, "rollup", "", "string")
+	flag.StringVar(&ls.RollupEngine, "rollup-engine", "aggregating", "string")
+	flag.StringVar(&ls.Preset, "preset", "", "string")
+	flag.StringVar(&ls.PeriodEnd, "period-end", "", "string")
+	dateTypePtr := flag.String("date-type", "Date", "string")
+	flag.BoolVar(&ls.Date32, "date32", false, "bool")
+	flag.StringVar(&ls.TZ, "tz", "UTC", "string")
+	flag.StringVar(&ls.ZScore, "zscore", "", "string")
+	flag.BoolVar(&ls.PctRank, "pct-rank", false, "bool")
+	flag.StringVar(&ls.Outlier, "outlier", "", "string")
+	flag.StringVar(&ls.Transform, "transform", "", "string")
+	flag.StringVar(&ls.Sink, "sink", "", "string")
+	flag.StringVar(&ls.Dupes, "dupes", "error", "string")
+	flag.StringVar(&ls.BadDates, "bad-dates", "skip", "string")
+	flag.StringVar(&ls.Nulls, "nulls", "skip", "string")
+	flag.BoolVar(&ls.StrictJSON, "strict-json", false, "bool")
+	flag.BoolVar(&ls.Strict, "strict", false, "bool")
+	flag.StringVar(&ls.Mode, "mode", "replace", "string")
+	flag.BoolVar(&ls.Refresh, "refresh", false, "bool")
+	flag.IntVar(&ls.Snapshots, "snapshot", 0, "int")
+	flag.IntVar(&ls.BackupDays, "backup-days", 0, "int")
+	flag.StringVar(&ls.Cluster, "cluster", "", "string")
+	flag.BoolVar(&ls.Distributed, "distributed", false, "bool")
+	flag.StringVar(&ls.Spool, "spool", "", "string")
+	flag.StringVar(&ls.FileDir, "file-dir", "", "string")
+	flag.StringVar(&ls.FileFormat, "file-format", "values", "string")
+	flag.BoolVar(&ls.Buffer, "buffer", false, "bool")
+	flag.BoolVar(&ls.DateIndex, "date-index", false, "bool")
+	flag.BoolVar(&ls.SeriesIndex, "series-index", false, "bool")
+	flag.StringVar(&ls.Projection, "projection", "", "string")
+	flag.StringVar(&ls.Fanout, "fanout", "", "string")
+	flag.IntVar(&ls.InsertRetries, "insert-retries", defaultInsertRetries, "int")
+	flag.IntVar(&ls.PageWorkers, "page-workers", 4, "int")
 
-	apiKeyPtr := flag.String("api", "", "string")
-	seriesPtr := flag.String("series", "", "string")
+	eventsPtr := flag.String("events", "", "string")
+	workersPtr := flag.Int("workers", 1, "int")
+	breakerPtr := flag.Int("breaker", 0, "int")
+	cooldownPtr := flag.String("breaker-cooldown", "", "string")
+	configPtr := flag.String("config", "", "string")
 
-	tablePtr := flag.String("table", "", "string")
+	debugHTTPPtr := flag.Bool("debug-http", false, "bool")
+	colorPtr := flag.Bool("color", false, "bool")
+	pprofPtr := flag.String("pprof-addr", "", "string")
+	cpuProfilePtr := flag.String("cpu-profile", "", "string")
+	memProfilePtr := flag.String("mem-profile", "", "string")
 
 	flag.Parse()
 
-	// Check if required arguments are missing
-	if *apiKeyPtr == "" || *seriesPtr == "" || *tablePtr == "" {
-		help()
-		os.Exit(1)
+	br, e := newBreaker(*breakerPtr, *cooldownPtr)
+	if e != nil {
+		return e
 	}
 
-	con, err := chutils.NewConnect(*hostPtr, *userPtr, *passwordPtr, clickhouse.Settings{"max_memory_usage": 40000000000})
-	if err != nil {
-		log.Fatalln(err)
+	// a manifest is a jobs file whose loads each run once
+	if *configPtr != "" {
+		if e := runJobs(&runSettings{jobs: *configPtr, once: true, debugHTTP: *debugHTTPPtr,
+			color: *colorPtr, breaker: br}); e != nil {
+			return e
+		}
+		return nil
 	}
-	defer func() {
-		if e := con.Close(); e != nil {
-			fmt.Println(e)
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "date-type":
+			ls.DateType = *dateTypePtr
+		case "col-series":
+			ls.ColSeries = *colSeriesPtr
+		case "col-date":
+			ls.ColDate = *colDatePtr
+		case "col-value":
+			ls.ColValue = *colValuePtr
 		}
-	}()
-	sTime := time.Now()
-	results, e := getSeries(*seriesPtr, *apiKeyPtr)
-	if e != nil {
-		log.Fatalln(e)
+	})
+
+	if e := ls.inNamespace(); e != nil {
+		return e
 	}
 
-	if e := loadSeries(results, *seriesPtr, *tablePtr, con); e != nil {
-		log.Fatalln(e)
+	// settings given as flags override the profile, which overrides the environment
+	acct.applyEnv(flagsSet(flag.CommandLine))
+	if *profilePtr != "" {
+		p, e := readProfile(*profilesPtr, *profilePtr)
+		if e != nil {
+			return e
+		}
+		acct.applyProfile(p, flagsSet(flag.CommandLine))
+	}
+	if e := acct.applySecrets(flagsSet(flag.CommandLine)); e != nil {
+		return e
 	}
-	ts := int(time.Since(sTime).Seconds())
-	mins := ts / 60
-	secs := ts % 60
-	fmt.Printf("elapsed time: %d minutes %d seconds", mins, secs)
 
-}
+	// secrets given as - are read from stdin
+	if e := readSecrets(secretFlag{"ClickHouse password", &acct.Password},
+		secretFlag{"Fred II API key", &acct.API}); e != nil {
+		return e
+	}
 
-// getSeries pulls the data for the series seriesId.
-func getSeries(seriesId string, apiKey string) (*Series, error) {
-	// Build url for Get
-	source := fmt.Sprintf("%s?series_id=%s&api_key=%s&file_type=json", apiUrl, seriesId, apiKey)
-	resp, e := http.Get(source)
-	if e != nil {
-		return nil, e
+	// Check if required arguments are missing
+	if (acct.API == "" && !*ddlOnlyPtr) || ls.Batch <= 0 || *workersPtr < 1 {
+		help()
+		os.Exit(1)
 	}
-	body, e := io.ReadAll(resp.Body)
-	if e := resp.Body.Close(); e != nil {
-		return nil, e
+	if e := ls.check(); e != nil {
+		return e
 	}
+	j, e := ls.job()
 	if e != nil {
-		return nil, e
+		return e
 	}
 
-	var parsed Series
-	if e = json.Unmarshal(body, &parsed); e != nil {
-		return nil, e
+	// print the DDL for all the tables the run would create
+	if *ddlOnlyPtr {
+		printDDL(ls.ddl(j, acct))
+		return nil
 	}
-	if parsed.Results == nil {
-		return nil, fmt.Errorf("no data returned for series %s", seriesId)
-	}
-	return &parsed, nil
-}
 
-// maketable creates the output table.  If there's an existing table, it's dropped.
-func makeTable(seriesId string, table string, con *chutils.Connect) error {
-	// build field defs
-	fds := make(map[int]*chutils.FieldDef)
-	fd := &chutils.FieldDef{Name: "seriesId",
-		ChSpec:      chutils.ChField{Base: chutils.ChString},
-		Legal:       &chutils.LegalValues{},
-		Description: "Fred II series ID"}
-	fds[0] = fd
-	fd = &chutils.FieldDef{Name: "date",
-		ChSpec:      chutils.ChField{Base: chutils.ChDate},
-		Legal:       &chutils.LegalValues{},
-		Description: "date of metric value"}
-	fds[1] = fd
-	fd = &chutils.FieldDef{Name: "value",
-		ChSpec:      chutils.ChField{Base: chutils.ChFloat, Length: 32},
-		Legal:       &chutils.LegalValues{},
-		Description: fmt.Sprintf("metric value for series %s", seriesId)}
-	fds[2] = fd
-
-	td := chutils.NewTableDef("date", chutils.MergeTree, fds)
-	// check everything is OK with our TableDef
-	if e := td.Check(); e != nil {
-		return e
+	stopProfiling, err := startProfiling(*pprofPtr, *cpuProfilePtr, *memProfilePtr)
+	if err != nil {
+		return err
 	}
-	// Create table
-	if e := td.Create(con, table); e != nil {
+	defer stopProfiling()
+	if *debugHTTPPtr {
+		fred.SetDebug(os.Stderr)
+	}
+	if e := acct.fredTLS(); e != nil {
 		return e
 	}
-	return nil
-}
-
-// loadSeries pushes the returned series to ClickHouse.  Any existing version of table is dropped.
-func loadSeries(data *Series, seriesId string, table string, con *chutils.Connect) error {
-	// missing value for date if date is not valid
-	var missing = time.Date(1969, 1, 1, 0, 0, 0, 0, time.UTC)
-	if e := makeTable(seriesId, table, con); e != nil {
+	if _, e := acct.pace(); e != nil {
 		return e
 	}
-	// Create a writer
-	wtr := s.NewWriter(table, con)
-	defer func() {
-		if e := wtr.Close(); e != nil {
-			fmt.Println(e)
-		}
-	}()
-	loaded := 0
-	// work through the array
-	for _, d := range data.Results {
-		// check date is legit
-		dt, e := time.Parse("2006-01-02", d.Date)
+
+	// the series of a release, category or search are loaded as a list of them
+	shared := ls.shared()
+	if ls.fromCatalog() {
+		infos, e := ls.catalogSeries(acct.API)
 		if e != nil {
-			dt = missing
+			return e
 		}
-		// don't load dates prior to 1970.  ClickHouse Date type has a min date of 1970/1/1
-		if dt.Year() < 1970 {
-			continue
+		fmt.Printf("%s has %d series\n", ls.catalogLabel(), len(infos))
+		if *dryRunPtr {
+			printCatalog(infos)
+			return nil
 		}
-		// each row just has 3 values: seriesId, date, value
-		line := fmt.Sprintf("'%s','%s',%v", seriesId, dt.Format("2006-01-02"), d.Value)
-		if _, e := wtr.Write([]byte(line)); e != nil {
-			return e
+		ids := make([]string, 0, len(infos))
+		for _, info := range infos {
+			ids = append(ids, info.ID)
 		}
-		loaded++
+		ls.Series, ls.Release, ls.Category, ls.Search = strings.Join(ids, ","), 0, 0, ""
 	}
-	if e := wtr.Insert(); e != nil {
+	// there's nothing to look up for series given by ID
+	if *dryRunPtr {
+		fmt.Println(strings.Join(ls.seriesList(), "\n"))
+		return nil
+	}
+
+	con, err := connect(acct)
+	if err != nil {
+		return diagnose(err, acct.Host)
+	}
+	defer closeConnect(con)
+
+	if j.events, e = openEvents(*eventsPtr); e != nil {
 		return e
 	}
+	defer j.events.close()
+
+	// rows spooled by earlier runs go in before the load, which may replace them
+	if ls.Spool != "" {
+		if e := flushSpool(ls.Spool, con); e != nil {
+			return diagnose(e, acct.Host)
+		}
+	}
+
+	sTime := time.Now()
+	ids := ls.seriesList()
+	if !shared {
+		if e := runLoad(ls, j, acct, con); e != nil {
+			return diagnose(e, acct.Host)
+		}
+		printSummary([]outcome{newOutcome(j.table, j.seriesId, j, time.Since(sTime), nil)}, *colorPtr)
+		return nil
+	}
+
+	// the series of a list go into the table, -workers at a time: the first to load creates it and the rest add to it
+	outcomes, failed, e := loadList(ls, j, ids, *workersPtr, br, acct, con)
+	if e != nil {
+		return diagnose(e, acct.Host)
+	}
+	printSummary(outcomes, *colorPtr)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d series failed", failed, len(ids))
+	}
 	return nil
 }
 
@@ -209,22 +942,662 @@ func help() {
 Command fred2ch is a simple command that pulls a single series from the St Louis Federal Reserve database
 Fred II then creates and populates a ClickHouse table for it.
 Required command line arguments:
-   -series         Fred II series id
+   -series         Fred II series id, or a comma-separated list of them
    -table          destination ClickHouse table.
-   -api            Fred II API key
+   -api            Fred II API key, or - to read it from stdin
 
 Optional command line arguments:
-   -host           IP of ClickHouse database. Default: 127.0.0.1
+   -host           IP of ClickHouse database, or a comma-separated list to fail over between. Default: 127.0.0.1
    -user           ClickHouse user. Default: "default"
-   -password       ClickHouse password. Default: ""
+   -password       ClickHouse password, or - to read it from stdin. Default: ""
+   -insert-settings ClickHouse settings for the inserts, as name=value,... e.g. insert_quorum=2. Default: none
+   -compression    compression of the ClickHouse connection: lz4 or none. Default: lz4
+   -ssh            [user@]host of an SSH bastion to tunnel to ClickHouse through. Default: none
+   -wait-for-db    how long to keep retrying the connection to ClickHouse, e.g. 60s. Default: none
+   -secure         connect to ClickHouse over TLS, on port 9440 unless -host gives one. Default: false
+   -ca-cert        PEM file of CA certificates to trust for ClickHouse and Fred II. Default: none
+   -insecure-skip-verify don't verify the TLS certificates of ClickHouse and Fred II. Default: false
+   -tls-cert       PEM file of a client certificate to authenticate to ClickHouse with. Default: none
+   -tls-key        PEM file of the private key of -tls-cert. Default: none
+   -secrets        secret holding the API key and credentials: vault://path or aws-sm://id. Default: none
+   -profile        profile of ClickHouse and Fred II settings to use, from -profiles. Default: none
+   -profiles       YAML file with the profiles. Default: ~/.fred2ch.yaml
+   -api-per-minute Fred II requests allowed per minute, 0 for no limit. Default: 120 (Fred II's own limit)
+   -api-per-day    Fred II requests allowed per 24 hours. Default: no limit
+   -max-retries    times a refused, failed or undelivered Fred II request is retried. Default: 5
+   -rate           deprecated name of -api-per-minute
+   -usage-table    table counting the Fred II requests made per API key per day. Default: none
+   -batch          rows per insert. Default: 10000
+   -last           load only the most recent N observations. Default: 0 (all)
+   -start          load only the observations from this date (YYYY-MM-DD). Default: the first
+   -end            load only the observations up to this date (YYYY-MM-DD). Default: the last
+   -realtime-start load the values current from this date (YYYY-MM-DD), as ALFRED has them. Default: today
+   -realtime-end   load the values current up to this date (YYYY-MM-DD). Default: today
+   -vintages       load every vintage of the series, each value with the period it was current. Default: false
+   -freq           frequency Fred II aggregates the series to: w, bw, m, q, sa or a. Default: the series' own
+   -agg            how -freq aggregates the observations: avg, sum or eop (end of period). Default: avg
+   -units          transformation Fred II applies to the values, e.g. pch (percent change). Default: lin (none)
+   -formula        derive the series from others, e.g. "real_rate = DGS10 - T10YIE". Default: none
+   -release        load every series of this Fred II release (e.g. 18, the H.15 interest rates). Default: none
+   -category       load every series of this Fred II category. Default: none
+   -recursive      with -category, also load the series of every category below it. Default: false
+   -search         load every series matching this Fred II full-text search (the 1000 most relevant). Default: none
+   -filter-frequency with -release, -category or -search, load only series of this frequency (e.g. M). Default: all
+   -filter-units   with -release, -category or -search, load only series whose units contain this. Default: all
+   -min-popularity with -release, -category or -search, load only series at least this popular. Default: 0
+   -archive        table to archive the raw Fred II response in. Default: none
+   -registry       table recording each load and its query parameters. Default: none
+   -dead-letter    table recording observations the load rejects, with the reason. Default: none
+   -skip-unchanged skip the load if the registry has it and Fred II hasn't updated the series since. Default: false
+   -lock-table     table of advisory locks, so concurrent runs never write the same table at once. Default: none
+   -latest         maintain this latest-readings table instead of loading -table. Default: none
+   -meta-table     table to record the Fred II metadata of the series in. Default: none
+   -meta           record the Fred II metadata of the series in <table>_meta. Default: false
+   -dictionary     create a dictionary keyed by series ID over -meta-table. Default: none
+   -create-db      create the databases of tables given as db.table if they don't exist. Default: false
+   -namespace      put every table the load creates, and the registry, within namespace NS. Default: none
+   -ddl-only       print the DDL the run would issue and exit, without touching Fred II or ClickHouse
+   -dry-run        print the series the run would load and exit, without touching ClickHouse
+   -col-series     name of the series ID column. Default: seriesId
+   -col-date       name of the date column. Default: date
+   -col-value      name of the value column. Default: value
+   -detect-int     if every value is an integer, make the value column UInt32 or Int64. Default: false
+   -rollup         comma-separated periods (monthly, quarterly, annual) to keep aggregates of. Default: none
+   -rollup-engine  engine of the -rollup tables: aggregating or summing. Default: aggregating
+   -preset         table layout preset: grafana. Default: none
+   -period-end     add: also store period-end dates, replace: store them instead. Default: none
+   -date-type      type of the date column: Date, Date32, DateTime or DateTime64 (see below). Default: Date
+   -date32         make the date column Date32, to keep observations before 1970. Default: false
+   -tz             location of the dates, e.g. America/Chicago, and time zone of DateTime columns. Default: UTC
+   -zscore         add a zscore column: full for full-sample, or a trailing window length. Default: none
+   -pct-rank       if true, add a pctRank column: the percentile rank of the value to date. Default: false
+   -outlier        add an outlier flag column: k or k:window for k MADs from the trailing median. Default: none
+   -events         where to send JSON lifecycle events: stdout, tcp://host:port or unix:///path. Default: none
+   -config         load the series declared in this manifest, a jobs file, once each (see below). Default: none
+   -transform      comma-separated transforms applied to each observation, e.g. scale:0.001. Default: none
+   -sink           comma-separated sinks, name or name:arg, to write the observations to as well. Default: none
+   -dupes          observations repeating a date: error, latest (keep the last) or all. Default: error
+   -bad-dates      observations whose date can't be parsed: skip, error or a date to give them. Default: skip
+   -nulls          observations Fred II has no value for: skip, null or zero. Default: skip
+   -strict-json    warn of fields in Fred II responses that are unexpected or missing. Default: false
+   -strict         fail the load at the first problem rather than working around it. Default: false
+   -mode           replace, create or append to an existing table (see below). Default: replace
+   -refresh        load only the dates after those already in the table; same as -mode append. Default: false
+   -snapshot       keep the replaced table as a dated snapshot, keeping the newest N. Default: 0 (drop it)
+   -backup-days    keep the replaced table as a timestamped backup for N days. Default: 0 (drop it)
+   -cluster        create the table on every host of this ClickHouse cluster. Default: none
+   -distributed    with -cluster, make the table Distributed over a local table per shard. Default: false
+   -spool          directory to spool rows to if ClickHouse goes down during a load. Default: none
+   -file-dir       insert through files in the server's user_files directory D. Default: none
+   -file-format    format of the -file-dir files: values or csv. Default: values
+   -buffer         insert through a Buffer table, <table>_buffer, in front of the table. Default: false
+   -date-index     add a minmax skip index on the date column. Default: false
+   -series-index   add a bloom_filter skip index on the series column. Default: false
+   -projection     comma-separated columns ordering a projection of the table, e.g. date,seriesId. Default: none
+   -fanout         comma-separated tables the load is fanned out to through a Null-engine -table. Default: none
+   -insert-retries times a failed insert is retried, if the failure may be momentary. Default: 3
+   -page-workers   pages of a series longer than 100,000 observations fetched at a time. Default: 4
+   -workers        series of a list, release, category or search loaded at a time. Default: 1
+   -breaker        loads failing in a row that stop the rest, 0 for never. Default: 0
+   -breaker-cooldown how long to pause once -breaker trips, e.g. 5m, rather than stopping. Default: none
+   -debug-http     log each Fred II request, its status, size and timing, to stderr. Default: false
+   -color          color the statuses of the summary printed at the end of the run. Default: false
+   -pprof-addr     address to serve net/http/pprof on, e.g. localhost:6060. Default: none
+   -cpu-profile    file to write a CPU profile to. Default: none
+   -mem-profile    file to write a heap profile to at the end of the run. Default: none
 
-The table created has these fields:
+The table created has these fields (names can be changed with -col-series, -col-date and -col-value):
 
     seriesId    String     series ID requested
     date        Date       date of metric value
     value       Float32    value of metric
 
-All months available for the series are loaded.
+All observations available for the series are loaded, unless -last, -start or -end is given. Observations Fred II
+reports as missing are skipped, unless -nulls says otherwise. Rows are inserted in batches while the series is
+still downloading, so memory use doesn't grow with the length of the series.
+
+If -archive is given, the raw Fred II response is also saved to that table, along with the request url
+(without the API key) and the time of the request, so the load can be replayed or audited later.
+The archive table is created if needed and is never dropped:
+
+    seriesId    String     series ID requested
+    url         String     request url
+    fetched     DateTime   time of the request
+    payload     String     raw response
+
+If -registry is given, each load is recorded in that table, including the Fred II query parameters used,
+so loads of the same series with different transformations can be told apart.
+The registry table is created if needed and is never dropped:
+
+    table              String     destination table
+    seriesId           String     series ID loaded
+    loaded             DateTime   time of the load
+    rows               UInt64     rows loaded
+    minDate            Date       first date loaded
+    maxDate            Date       last date loaded
+    units              String     units transformation requested
+    frequency          String     frequency requested
+    aggregation        String     aggregation method requested
+    realtimeStart      String     start of real-time period requested
+    realtimeEnd        String     end of real-time period requested
+    query              String     full query, without the API key
+    detectedFrequency  String     frequency detected from the dates
+    provenance         String     formula deriving the series
+    apiRequests        UInt64     Fred II requests made by the load
+    downloaded         UInt64     bytes of Fred II responses
+    peakHeap           UInt64     most bytes of heap in use during the load
+    written            UInt64     bytes of rows sent to ClickHouse
+    shape              String     settings shaping the table and its rows
+
+Blank parameters mean the Fred II default was used.
+
+With -ddl-only, the DROP and CREATE statements the run would issue are printed and nothing else is done, so
+tables can be reviewed or created ahead of time. -api is not required.
+
+With -detect-int, a series whose values are all integers (counts such as housing starts) gets a UInt32 value
+column, or Int64 if some value is negative or too large, so the values are stored exactly. The type can't be
+chosen until the whole series has arrived, so the series is held in memory and -ddl-only shows Float32.
+
+With -latest, the run doesn't load -table (which isn't required). Instead it fetches only the newest few
+observations and records the most recent value in the -latest table, which has one row per series and is
+created if needed. It's a ReplacingMergeTree, so query it with FINAL:
+
+    seriesId    String     series ID
+    date        Date       date of the latest value
+    value       Float64    latest value
+    updated     DateTime   time of the refresh
+
+If -meta-table is given, the series' Fred II metadata is recorded in that table, which has one row per series and
+is created if needed. -meta records it in <table>_meta, next to the series table. It's a ReplacingMergeTree, so
+query it with FINAL:
+
+    seriesId            String     series ID
+    title               String     series title
+    units               String     units
+    frequency           String     frequency
+    seasonalAdjustment  String     seasonal adjustment
+    lastUpdated         DateTime   when Fred II last updated the series
+    observationStart    String     first date available
+    observationEnd      String     last date available
+    notes               String     Fred II notes
+    updated             DateTime   time of the refresh
+
+-dictionary additionally creates a ClickHouse dictionary over the metadata table, keyed by seriesId, so
+queries can use e.g. dictGet('dict', 'title', tuple(seriesId)) instead of a join. The dictionary reads the
+table as -user/-password; -ddl-only prints the password as REDACTED.
+
+For each -rollup period, an AggregatingMergeTree table <table>_<period> is created along with a materialized view
+<table>_<period>_mv that fills it from the series table, so the aggregates stay current as rows are loaded. They
+are dropped and recreated with the series table. The aggregate table has the series and date columns (date is the
+start of the period, a Date) plus the aggregate states avg, min, max, sum, last and count, which are read with the
+-Merge combinators, e.g. avgMerge(avg). Since a Date can't be before 1970, -rollup can't be used with a Date32 or
+DateTime64 date column.
+
+-rollup-engine summing makes the aggregate tables SummingMergeTree tables instead. Their sum and count columns are
+summed as parts merge and min and max are SimpleAggregateFunction columns, so queries aggregate them again without
+combinators, e.g. sum(sum) / sum(count) for the average. They have no last column.
+
+-preset grafana lays the table out the way Grafana's ClickHouse datasource expects a time series: the columns
+are metric, time (a DateTime) and value, and the table is ordered by metric, time. Column names given with
+-col-series, -col-date and -col-value override the preset.
+
+Fred II dates monthly, quarterly, semiannual and annual observations by the start of the period. With
+-period-end add, the table gets a periodEnd column holding the last day of the period; with -period-end
+replace, the date column holds it instead. Daily and weekly observations are already dated by the end of the
+period, so they are unchanged.
+
+The frequency of the series (D, W, BW, M, Q, SA or A) is detected from the spacing of its dates, and a
+warning is printed for each stretch without observations that is longer than the frequency allows. The
+detected frequency is recorded in the registry.
+
+-date-type DateTime or DateTime64 (e.g. -date-type "DateTime64(3, 'UTC')") gives the date column a time type,
+so the data can be unioned with intraday tables. Dates are stored at midnight.
+
+A Date column, the default, can't hold dates before 1970, so the observations before then are skipped, counted in
+the warnings summary and recorded in the -dead-letter table if there is one. -date32 (or -date-type Date32) makes
+the column Date32, which holds dates from 1900, so long histories such as GNPCA's, back to 1929, are loaded whole.
+A DateTime64 column holds them too. verify and bulk take -date32 for such tables.
+
+-formula loads a series derived from other Fred II series in place of -series (which isn't required). The
+formula is "name = expression", where the expression uses series IDs, numbers, + - * /, parentheses and the
+functions log, exp and abs. The series are aligned by date, so the derived series has a value on each date
+where all of them do. It is loaded with seriesId set to name, and the formula is recorded in the registry.
+
+-series may list several series (e.g. -series CPIAUCSL,UNRATE,GDP), which are loaded in turn into the one table,
+ordered by series then date. The first series loaded replaces the table (see -mode) and the rest are added to it. A
+series that fails doesn't stop the others; the run exits with an error once they're all tried. A list can't be used
+with -formula, -detect-int or -skip-unchanged, nor in a jobs file, where each series is its own job. Series IDs
+aren't case-sensitive: the loads and the commands store and look them up in upper case, so -series gdp loads GDP.
+
+-release loads all the series of a Fred II release in place of -series: e.g. -release 18 loads the H.15 Selected
+Interest Rates. fred2ch lists the release's series, a page at a time, and loads them as it does a list given to
+-series, into the one table.
+
+-category loads the series of a Fred II category in the same way, and with -recursive those of every category below
+it too, walking the tree through its children, so one command can mirror a whole section of Fred II. A series listed
+in more than one category is loaded once.
+
+-search loads the series matching a Fred II full-text search, the 1000 most relevant, in the same way. The series
+picked by -release, -category or -search can be narrowed with -filter-frequency (the short code, such as M, or the
+name, such as Monthly), -filter-units (a case-insensitive part of the units, such as Percent) and -min-popularity
+(Fred II's popularity, 0 to 100). -dry-run prints the series picked, with their frequency, units, popularity and
+title, and exits without loading them, so a search can be reviewed first.
+
+-workers N loads the series of a list, release, category or search N at a time. Once the first has created the
+table, each worker fetches and parses its series while the others do theirs, and the workers take turns inserting
+into the table. The Fred II requests of all of them count against -api-per-minute and -api-per-day.
+
+-breaker N stops a list, release, category or search, or the loads of a -config manifest, once N in a row have
+failed, as when Fred II or ClickHouse is down, rather than grinding through the rest: those left fail without being
+tried. With -breaker-cooldown D they wait D instead and then carry on, the breaker tripping again if the next fails
+too. run takes -breaker and -breaker-cooldown as well.
+
+-mode decides what happens to an existing table. replace, the default, drops it (or keeps it as a snapshot or
+backup). create fails, with an error matching chsink.ErrTableExists. append checks that the table has the
+columns, and the types, the load writes -- failing with an error matching chsink.ErrSchemaMismatch if not -- and
+inserts only the observations after the last date of the series in the table, so a later run picks up where an
+earlier one stopped. Fred II is asked only for the observations from that date on, so a nightly update of a long
+daily series downloads a few rows rather than all of them. -refresh is the same as -mode append. A table that
+doesn't exist is created in every mode. append can't be used with -fanout, -zscore, -pct-rank or -outlier, and
+-latest tables are always kept.
+
+-realtime-start and -realtime-end load the values of the series as they were known during that real-time period,
+from ALFRED, rather than as revised since: e.g. -realtime-start 2008-10-01 -realtime-end 2008-10-01 loads the
+vintage current on that day. -vintages asks Fred II for the series' vintage dates and loads every vintage from the
+first on, so the table holds each value a date has had. With any of these the table gets two Date columns,
+realtime_start and realtime_end, holding the first and last days each value was current, and is ordered by
+realtime_start after the date. A value still current ends on 2149-06-06, the last date a Date column can hold.
+Vintages can't be loaded with -formula, -latest, -rollup, -dupes latest, -zscore, -pct-rank, -outlier or -mode
+append.
+
+-freq has Fred II aggregate the series to a lower frequency before it's sent, e.g. -freq m loads a daily series as
+monthly observations dated the first of the month, so there's no need to aggregate it in ClickHouse. -agg says how:
+avg, the default, averages the observations of the period, sum adds them up and eop takes the last. The registry
+records both, and refresh repeats them.
+
+-start and -end limit the load to the observations in that window, e.g. -start 2000-01-01 -end 2020-12-31, and
+only those are requested from Fred II. Either can be given alone.
+
+-units has Fred II transform the values before they're sent: lin (levels, the default), chg (change), ch1 (change
+from a year ago), pch (percent change), pc1 (percent change from a year ago), pca (compounded annual rate of
+change), cch (continuously compounded rate of change), cca (continuously compounded annual rate of change) or log
+(natural log). The transformation is named in the comment of the value column, and recorded in the registry. The
+first observations of a change have no value, so -nulls says what becomes of them.
+
+-zscore adds a zscore column (Float64) holding the z-score of each value, either against the whole series
+(-zscore full) or against the trailing window of that many observations (e.g. -zscore 60). Computed columns
+need the whole series, so it is held in memory before it is inserted.
+
+-pct-rank adds a pctRank column (Float64) holding the fraction of the observations up to and including that date
+whose value is no greater, so the newest row answers "how unusual is today's reading" without window functions.
+Only history is used, so past ranks don't change as the series grows.
+
+-outlier adds an outlier column (UInt8) that is 1 where the value is more than k median absolute deviations from
+the median of the window observations before it (-outlier 5:60; the window defaults to 60), so obviously
+erroneous prints can be excluded with WHERE outlier = 0. Observations without a full window, or whose window has
+no variation, get 0.
+
+-tz sets the location the dates are in: each date is midnight there, as is a -bad-dates sentinel.
+A DateTime or DateTime64 date column without a time zone gets -tz as its time zone, so the stored instants agree
+with the dates; give -date-type a time zone of its own to override it. Date columns are unaffected.
+
+-lock-table makes the run lock the destination table while it writes it, so two concurrent runs (on any machines)
+can't drop and recreate the same table under each other. The locks are rows in the lock table, which is created
+if it doesn't exist, timed by the ClickHouse server rather than the machines' clocks. A run that finds the table
+locked fails. The run holding a lock refreshes it every 2 minutes while it loads, and a lock left by a run that
+died expires 10 minutes after its last refresh, so a load of any length keeps its lock.
+
+A jobs file declares many loads to run with one command. It gives the ClickHouse and Fred II access (host,
+user, password, api) and a list of jobs. Each job takes the settings of a load, named as the flags are, plus an
+optional name and a schedule, the interval between runs as a Go duration. For instance:
+
+    host: 127.0.0.1
+    api: 0123456789abcdef0123456789abcdef
+    jobs:
+      - name: cpi
+        series: CPIAUCSL
+        table: fred.cpi
+        registry: fred.registry
+        zscore: full
+        schedule: 24h
+      - series: UNRATE
+        latest: fred.latest
+
+A job that fails doesn't stop the others; run exits with status 1 if any job failed.
+
+-config F loads the series declared in F, a jobs file used as a manifest that can be kept in version control, each
+once, whatever its schedule: the same as fred2ch run -jobs F -once. Each job has its own table, window (start and
+end), units transformation and mode (replace or append), with the defaults block giving those they share:
+
+    api: ${FRED_API_KEY}
+    defaults:
+      registry: fred.registry
+      mode: append
+    jobs:
+      - series: GNPCA
+        table: fred.gnp
+        date32: true
+      - series: DGS10
+        table: fred.dgs10_2000s
+        start: 2000-01-01
+        end: 2009-12-31
+        mode: replace
+      - series: CPIAUCSL
+        table: fred.cpi_yoy
+        units: pc1
+
+The file gives the ClickHouse and Fred II access, so of the other flags only -debug-http and -color apply.
+
+A jobs file can refer to variables as ${NAME}, or ${NAME:-default} to fall back on a default. Variables come
+from the vars block of the file (whose values may refer to environment variables), then the environment;
+-var name=value overrides them. Settings in the defaults block apply to every job that doesn't set them. So one
+file serves dev, stage and prod:
+
+    api: ${FRED_API_KEY}
+    vars:
+      db: fred_${ENV:-dev}
+    defaults:
+      registry: ${db}.registry
+    jobs:
+      - series: CPIAUCSL
+        table: ${db}.cpi
+
+A reference to a variable that isn't set and has no default is an error.
+
+-transform runs each observation with a value through the named transforms, in order, as it is fetched.
+A transform is given as name or name:argument. The built-in transform scale:k multiplies values by k. Programs
+embedding the loader add their own transforms, such as outlier filters or proprietary adjustments, by
+implementing fred.Transform and registering it with fred.RegisterTransform.
+
+-sink writes the observations to other destinations too, as each batch is inserted into the table. A sink is
+given as name or name:argument, and several are separated by commas. Each sink is made once per run and the loads
+of the run share it, taking turns, so a list's series all go to the same place. Only observations with values are
+written to a sink. The built-in sink csv:F writes the series to CSV file F, replacing it the first time it's
+written in the run. Programs embedding the loader add their own destinations, such as internal services or other
+warehouses, by implementing fred.Sink and registering it with fred.RegisterSink.
+
+-events emits lifecycle events as JSON objects, one per line, so orchestrators (Airflow, Dagster, ...) can
+follow a run as it goes. Each has event (started, skipped, fetched, inserted, finished or failed), time, series
+and table; fetched has rows (observations fetched), inserted has rows (in the batch) and total (so far), finished
+has rows and seconds, and failed has seconds and error. In a jobs file, events: gives the destination for all the
+jobs. With -events stdout, fred2ch's own messages go to stderr, so stdout carries only the events.
+
+Fred II can return more than one observation for a date, for instance with some combinations of real-time
+parameters. -dupes says what to do: error (the default) fails the load, latest keeps the last observation for
+each date in the response, which is the latest vintage, and all loads them all. latest holds the whole series
+in memory.
+
+Giving -password or -api as - reads it from stdin, so secrets stay out of shell history and process listings.
+At a terminal the secret is prompted for without echo; otherwise it is the next line of stdin, the password
+first if both are -. The commands read -password and -api the same way.
+
+FRED_API_KEY, CH_HOST, CH_USER and CH_PASSWORD in the environment stand in for -api, -host, -user and -password
+when those flags aren't given, so the key and password needn't appear in shell history or cron logs. Flags, a
+profile and a secret take precedence over the environment. The commands read the environment the same way, and a
+jobs file takes from it the settings it leaves out.
+
+-insert-settings sets ClickHouse settings for the session the run inserts with, so loads into replicated
+clusters get the durability they need, e.g. -insert-settings insert_quorum=2,insert_distributed_sync=1 or
+max_insert_threads=4. The commands take it too, and a jobs file gives it as insert-settings.
+
+A batch whose insert ClickHouse refuses in a way that may not recur -- too many parts, too many queries, a replica
+that is briefly read-only or a refused connection -- is retried after waiting 1 second, then 2, 4 and so on up to 30
+seconds, up to -insert-retries times. Other failures, such as a schema mismatch, fail the load at once, as do a
+timeout or a dropped connection, after which the batch may have been inserted and retrying it would duplicate it.
+
+-spool DIR keeps the Fred II requests a load has made from being wasted if ClickHouse goes down partway. Once an
+insert still fails after the retries because ClickHouse can't be reached, the rest of the series is fetched and
+written to a file in DIR rather than ClickHouse, and the load fails. The next run with -spool DIR inserts the
+spooled rows before its own load, creating the table if the failed load hadn't, and run does so before each round
+of jobs, so a daemon catches up once ClickHouse is back. The rows already inserted stay in the table. Spooled rows
+aren't registered, -snapshot and -backup-days don't apply to them, and -spool can't be used with -latest.
+
+-compression sets the compression of the ClickHouse connection. lz4, the default, cuts the time to load long
+series into a remote cluster over a slow link; none saves the CPU on a local server. zstd is refused: the
+ClickHouse driver fred2ch is built with, clickhouse-go v2.0.14, compresses only with lz4. The commands take
+-compression too, and a jobs file gives it as compression.
+
+-file-dir D inserts each batch by writing it to a file in directory D and having ClickHouse read it with the
+file() table function (INSERT ... SELECT * FROM file(...)), rather than sending the rows over the connection. The
+server parses the file itself, which is far faster for big backfills. D must be the server's user_files_path, so
+fred2ch runs on the ClickHouse host or D is a directory both share. The files are readable by all, since the
+server may run as another user, and are removed once they're inserted. -file-format says how they're written:
+values (SQL VALUES rows, the default) or csv, with \N for NULL. Parquet isn't available, since fred2ch isn't
+built with a Parquet writer. fred2ch bench -file-dir D compares both formats with the other insert paths.
+
+-buffer puts a Buffer table, <table>_buffer, in front of the table (or the -latest table) and sends the inserts to
+it. ClickHouse flushes the buffer into the table every 10 to 100 seconds, so many small, frequent loads -- a jobs
+file refreshing latest readings every minute, say -- make a few large parts rather than a part per insert. Until a
+flush, the new rows are seen by queries of <table>_buffer but not of the table itself.
+
+-date-index and -series-index add data-skipping indexes to the table: a minmax index on the date column and a
+bloom_filter index on the series column. They help queries of very large tables shared by many series that filter
+on the column the table isn't ordered by.
+
+-projection adds a projection to the table holding its rows in another order, e.g. -projection date,seriesId for a
+table shared by many series that's ordered by series (as -preset grafana's is) but also scanned by date. ClickHouse
+keeps the projection current as rows are inserted and uses whichever order suits a query, without a second table.
+The columns are named as the table has them.
+
+-fanout T1,T2,... makes -table a landing table with the Null engine, which stores nothing, and creates a
+materialized view <T>_mv for each target T that copies every inserted row into it. So a single load fills several
+tables shaped for different uses. Targets that don't exist are created as the series table would be; a target
+created beforehand can have its own engine, order and columns, and keeps the columns of the landing table it has.
+The rows of the series already in a target are deleted before the load. The views are dropped and recreated with
+the landing table, but the targets are kept. -fanout can't be used with -latest, and verify and list should be
+pointed at a target rather than the landing table.
+
+-api-per-minute and -api-per-day set a budget for the Fred II requests of the run: 120 a minute (Fred II's own
+limit) and none a day unless set otherwise, 0 for no limit. A request that would exceed either waits until the
+oldest request in the budget's window ages out, so a long mirror job stays within the API key's quota rather than
+being refused; a load canceled meanwhile stops waiting. Jobs files give them as api-per-minute and api-per-day;
+run then reports, after each job, the requests made so far and when the jobs still waiting are projected to
+finish at the average requests per job and the pace the budget allows. -rate, the old name of -api-per-minute
+(rate in jobs files), still works but is deprecated and warns; if given, it overrides -api-per-minute.
+
+A request Fred II refuses for too many requests (429) or fails with a server error (5xx), or one that fails on
+the way to Fred II (a reset connection, a timeout), is retried up to -max-retries times, 5 by default, after 1s,
+2s, 4s and so on, at most a minute (or as long as Fred II's Retry-After says), so a large batch load rides out a
+bad patch rather than dying halfway. Jobs files give it as max-retries.
+
+-usage-table U counts the Fred II requests made with each API key each day in table U, which is created if it
+doesn't exist, so runs on several hosts or jobs files sharing a key can see what it has used between them. The key
+is recorded by the start of its SHA-256 hash, not as is. With -api-per-day too, each load warns once the day's
+requests with the key pass 80% of it. The columns of U, a SummingMergeTree, are:
+
+    key                String     start of the SHA-256 of the API key
+    day                Date       day of the requests, in the ClickHouse server's time zone
+    requests           UInt64     Fred II requests made
+
+Query it with SELECT key, day, sum(requests) FROM U GROUP BY key, day. A jobs file gives it as usage-table.
+
+Fred II returns at most 100,000 observations per request. A longer series is fetched a page at a time: once the
+first page says how many observations there are, the rest are fetched -page-workers at a time and loaded in
+order. A page holds its worker until it's loaded, so no more than -page-workers pages wait in memory.
+
+-skip-unchanged checks the series' last update time, which Fred II gives cheaply, before downloading its
+observations. If the registry records a load of the series into the table with the same query since then, the
+load is skipped, so a daily sync of many series only spends its API quota on those that have changed.
+
+If -dead-letter is given, observations the load rejects are recorded in that table rather than silently
+skipped: values or dates that can't be parsed, and dates before 1970, which a Date column can't hold. Observations
+Fred II reports as missing aren't rejections. The table is created if needed and is never dropped:
+
+    table      String     destination table
+    seriesId   String     series ID loaded
+    date       String     date as given by Fred II
+    value      String     value as given by Fred II
+    reason     String     why the observation was rejected
+    rejected   DateTime   time of the load
+
+-bad-dates says what to do with observations whose date can't be parsed: skip (the default) drops them, recording
+them in the -dead-letter table if there is one; error fails the load; and a date, e.g. -bad-dates 1970-01-01, is
+given to them as a sentinel, so they are loaded and can be found. The dates that couldn't be parsed are counted in
+the warnings summary at the end of the load.
+
+Values are parsed strictly as decimal numbers before they are inserted, and only the parsed number is written to
+ClickHouse, never Fred II's text. A value that isn't a plain decimal number ("NaN", "Inf", "0x10", a truncated
+payload, ...) is skipped, counted in the warnings summary and recorded in the -dead-letter table if there is one.
+Values Fred II reports as missing (".") are never parsed: -nulls says what they become. skip, the default, leaves
+them out of the table; null makes the value column Nullable and loads them as NULL; and zero loads them as 0.
+-nulls null can't be used with -rollup, -zscore, -pct-rank or -outlier, and neither null nor zero with -latest.
+
+-ssh user@bastion reaches ClickHouse through an SSH tunnel from a jump host, for clusters not reachable directly.
+fred2ch runs the system's ssh to forward a local port to port 9000 of -host as seen from the bastion, so keys, agents
+and ~/.ssh/config settings for the bastion apply. ssh is stopped when the run ends, whether or not it succeeds, and
+on Linux also if fred2ch is killed. The commands take -ssh too, and a jobs file gives it as ssh. A -host may also
+give a port other than 9000, e.g. -host 10.0.0.5:9440.
+
+-strict-json checks each Fred II response against the fields fred2ch expects and prints a warning, once per
+request, for each field it doesn't know and for observations missing their date or value, rather than silently
+ignoring or zero-valuing them. Changes to the API or truncated payloads then show up on the first load they affect.
+
+By default a load works around the problems it finds in a series -- dates or values that can't be parsed, dates
+before 1970, gaps in the dates and, with -strict-json, unexpected or missing fields in Fred II responses -- and
+ends with a summary of how many of each it met, e.g. "warnings for series GDP: 2 date before 1970, 1 gap". -strict
+makes each of them fail the load instead, whatever -bad-dates says, so a pipeline that must not load questionable
+data stops at the first. Observations Fred II reports as missing aren't problems.
+
+-snapshot N keeps the table a load replaces rather than dropping it: the old table is renamed with the date as a
+suffix, e.g. GDP_20240115, and only the newest N such snapshots are kept, the older ones being dropped. A second load
+the same day replaces that day's snapshot. Each month's view of a series is then kept for backtesting. -snapshot
+can't be used with -fanout or -latest, whose tables aren't replaced, and -ddl-only doesn't show the renames.
+
+-backup-days N is a safety net for the table a load replaces: rather than being dropped, the old table is renamed
+with the time as a suffix, e.g. GDP_backup_on_20240115093000, and backups more than N days old are dropped. If a
+load goes wrong, or loads the wrong series, the old table is recovered with RENAME TABLE. -backup-days can't be
+used with -snapshot, -fanout or -latest, and -ddl-only doesn't show the renames.
+
+-debug-http logs each request made to Fred II to stderr: the URL, with the API key replaced by REDACTED, the
+protocol and status, the size of the response and the time to its headers and to its end, e.g.
+
+    fred: GET https://api.stlouisfed.org/fred/series/observations?api_key=REDACTED&...: HTTP/2.0 200 OK, 48213 bytes,
+    headers in 412ms, done in 590ms
+
+Slow headers point to throttling or a proxy, 429 and 5xx statuses to the rate limits. Requests that fail outright
+are logged with the error. Requests share one HTTP/2 connection, or a pool of kept-alive connections if a proxy
+only speaks HTTP/1.1, so the TLS handshake isn't repeated for each request.
+
+-secure connects to ClickHouse over TLS. -ca-cert names a PEM file of CA certificates trusted as well as the
+system's, for a ClickHouse server with a private CA or a corporate proxy that re-signs the Fred II HTTPS traffic,
+and -insecure-skip-verify turns verification of certificates off altogether, for testing only. Both apply to Fred
+II requests and, with -secure, to ClickHouse. The commands take them too, and a jobs file gives them as secure,
+ca-cert and insecure-skip-verify.
+
+-tls-cert and -tls-key give a client certificate and its key, in PEM files, for ClickHouse servers that authenticate
+clients by certificate. They imply -secure. The commands take them too, and a jobs file gives them as tls-cert and
+tls-key.
+
+-wait-for-db 60s keeps trying to connect to ClickHouse for up to a minute, backing off from one second between
+attempts, for containers started alongside ClickHouse that may run before it's ready. Only failures that may clear
+up, such as a refused connection, are retried; a bad password fails at once. The commands take -wait-for-db too,
+and a jobs file gives it as wait-for-db.
+
+A load ends with a summary table giving the series, the rows loaded, the first and last dates, the time taken and the
+status: ok, skipped (-skip-unchanged) or failed. The run command prints one for each round of jobs, with a line per
+job. With -color the statuses are green, yellow and red.
+
+Each load reports the resources it used: the Fred II requests made for its observations and the megabytes of them
+downloaded, which don't include those of other loads running at the same time with -workers, the peak heap, sampled
+every quarter second, and the megabytes of rows sent to ClickHouse, before compression. With -registry these are
+recorded with the load, as apiRequests, downloaded, peakHeap and written, for capacity planning; older registries
+get the columns added.
+
+-profile names a set of ClickHouse and Fred II settings kept in the profiles block of a YAML file, ~/.fred2ch.yaml
+unless -profiles gives another, so dev, staging and prod targets, each with its own API key, can be switched with
+one flag. The settings have the names of the flags. Settings given as flags take precedence over the profile, which
+takes precedence over the defaults. The commands take -profile and -profiles too, and a jobs file can have its own
+profiles block, chosen with run -profile:
+
+    profiles:
+      dev:
+        host: localhost
+        api: DEVKEY
+      prod:
+        host: ch1.example.com,ch2.example.com
+        user: loader
+        password: "-"
+        secure: true
+        api: PRODKEY
+
+-secrets fetches the API key and ClickHouse credentials from a secrets manager at startup, so they needn't be
+kept in files, flags or the environment. vault://path reads the secret at path from HashiCorp Vault, at $VAULT_ADDR
+with the token $VAULT_TOKEN (and $VAULT_NAMESPACE if set), from a KV version 1 or 2 engine. aws-sm://id reads AWS
+Secrets Manager secret id with the aws command, so its usual credentials apply. The secret is a JSON object of
+settings named as the flags, e.g. {"api": "...", "user": "loader", "password": "..."}. Settings given as flags take
+precedence over the secret, which takes precedence over a profile. The commands take -secrets too, and a jobs file
+gives it as secrets.
+
+Any table may be given as database.table. With -create-db the databases of the tables a load writes are created, if
+they don't already exist, before anything is fetched from Fred II, rather than the load failing partway when it first
+writes to a missing one. -ddl-only shows the CREATE DATABASE statements too.
+
+-namespace NS lets teams share a ClickHouse cluster and a deployment of fred2ch without their tables colliding. Every
+table a load creates or records, including the registry, archive, dead-letter, lock, latest-readings, metadata and
+fanout tables and the dictionary, is put within NS: a table given as db.table goes in database NS_db, so -create-db
+creates that, and any other table is named NS_table. So each namespace has its own registry. list, refresh and
+delete take -namespace too, and a jobs file gives it as namespace, in its defaults or for a job.
+
+-cluster C creates the table on every host of ClickHouse cluster C (CREATE TABLE ... ON CLUSTER C). With
+-distributed too, it creates a local table, named with the suffix _local, on each shard and makes the table itself a
+Distributed table over them, sharded by series, so the load and queries have a single entry point. Inserts into a
+Distributed table reach the shards in the background unless -insert-settings has insert_distributed_sync=1.
+-cluster can't be used with -rollup, -fanout, -buffer, -snapshot, -backup-days or -latest.
+
+fred2ch also has these commands, which take -host, -user, -password and -api like a load:
+
+    fred2ch recessions -table T [-series USREC]
+        load a 0/1 recession indicator (USREC, USRECQ, USRECD, ...) into table T, replacing it, with a row
+        per recession: seriesId String, start Date32, end Date32, ongoing UInt8 (1 if not yet over)
+    fred2ch verify -series X -table T [-date32] [-preset P] [-col-series C] [-col-date C] [-col-value C]
+        re-fetch series X and compare it with its rows in table T, listing dates missing from T, values that
+        differ and rows Fred II doesn't have. Nothing is changed; the exit status is 1 if they disagree
+    fred2ch delete -series X -table T [-registry R] [-namespace NS] [-preset P] [-col-series C]
+        delete the rows of series X from table T, which other series share, and its loads into T from registry
+        R. ClickHouse applies the deletes in the background. It's an error if T has no rows of X
+    fred2ch list -registry R [-table T] [-meta-table M] [-namespace NS] [-preset P] [-col-series C]
+        list the series in registry R (only those in table T, if given) with the table they are in, the rows,
+        dates covered and time of their latest load, and their titles from metadata table M
+    fred2ch info -series X
+        print the Fred II metadata of series X: title, units, frequency, seasonal adjustment, observation range,
+        last update and notes. Only -api is needed, ClickHouse isn't touched
+    fred2ch refresh -registry R [-table T] [-batch N] [-lock-table L] [-namespace NS] [-preset P] [-col-* C]
+        reload each series in registry R (only those in table T, if given) that Fred II has updated since its latest
+        load, repeating the recorded query, and record the reloads. The rows of the series in its table are
+        replaced, in the shape its load recorded; -preset and -col-* give the shape of loads recorded before
+        registries had it. Derived series are reloaded when any series they come from is updated
+    fred2ch run -jobs F [-once] [-profile P] [-debug-http] [-color] [-var name=value ...]
+        run the loads declared in the YAML jobs file F. Jobs with a schedule are repeated at that interval until
+        the command is stopped, the others run once. With -once every job runs once. A summary table follows each
+        round of jobs. -profile P uses the settings of profile P of F's profiles block over those at the top of
+        F. -debug-http, -color, -breaker and -breaker-cooldown are as for a load, but a breaker without a
+        cooldown stops run once it trips. While run waits for the next job, SIGHUP reloads F: if it checks out,
+        its jobs replace the running ones, new jobs running at once and the rest keeping their schedules,
+        otherwise the error is printed and the jobs carry on. The connection, API key and budgets are kept.
+    fred2ch bench [-table T] [-rows N | -series X] [-batch N,N,...] [-file-dir D]
+        time loading N synthetic rows (default 1,000,000), or series X, into scratch table T (default fred2ch_bench)
+        by the row-text writer fred2ch uses and by the driver's native batch insert, at each batch size (default
+        10000,100000), reporting rows per second and MB allocated. T is dropped at the end. With -file-dir D the
+        inserts through the file() table function that -file-dir gives a load are timed too, once in each
+        -file-format
+    fred2ch bulk -archive A -table T [-series X,Y,...] [-batch N] [-date32] [-preset P] [-col-* C]
+        load the series of Fred II bulk download A, a path or URL of a zip of CSV files or of a single CSV file,
+        into table T, which is replaced and ordered by series and date. A CSV file has the dates in its first
+        column and a series in each other, named by its header; a column headed VALUE is the series the file is
+        named for. With -series only those series are loaded. Far faster than the API for a first backfill
+    fred2ch copy -from T1 -to T2 [-series X,Y,...] [-start D] [-end D] [-preset P] [-col-* C]
+        replace table T2 with a table of the same columns and engine as T1 and copy T1's rows into it within
+        ClickHouse, only those of the listed series and from date D to date D (YYYY-MM-DD) if given, e.g. to
+        promote a staging load to production. Views fed by T1, such as rollups, aren't copied
+    fred2ch diff -table-a A -table-b B [-series X,Y,...] [-max N] [-preset P] [-col-* C]
+        compare two loads of the same series, e.g. before and after a change of vintage or transform: print the
+        rows in A and B, the number of dates only in one of them and of dates whose values differ, and the first
+        N (default 20) of those dates with both values and the change
+    fred2ch doctor [-db D] [-color]
+        check what a load needs and print PASS or FAIL for each: that Fred II answers and accepts the API key,
+        that ClickHouse answers, that the user can create, write and drop a table in database D (the user's
+        default if not given) and that the local clock is within 5 seconds of ClickHouse's. It takes the
+        connection flags, -profile and -secrets as a load does. The first thing to run when a load fails
 
 Series names are case-insensitive.	
 
@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/ClickHouse/clickhouse-go/v2 v2.0.14
 	github.com/invertedv/chutils v1.1.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
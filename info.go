@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"text/tabwriter"
+)
+
+// infoCmd prints the Fred II metadata of a series.  It doesn't touch ClickHouse.
+func infoCmd(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	apiKeyPtr := fs.String("api", "", "string")
+	seriesPtr := fs.String("series", "", "string")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := readSecrets(secretFlag{"Fred II API key", apiKeyPtr}); e != nil {
+		return e
+	}
+	if *apiKeyPtr == "" || *seriesPtr == "" {
+		return fmt.Errorf("info requires -api and -series")
+	}
+	info, e := fred.GetInfo(seriesID(*seriesPtr), *apiKeyPtr)
+	if e != nil {
+		return diagnose(e, "")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range [][2]string{
+		{"series", info.ID},
+		{"title", info.Title},
+		{"units", info.Units},
+		{"frequency", fmt.Sprintf("%s (%s)", info.Frequency, info.FrequencyShort)},
+		{"seasonal adjustment", info.SeasonalAdjustment},
+		{"observations", fmt.Sprintf("%s to %s", info.ObservationStart, info.ObservationEnd)},
+		{"last updated", info.LastUpdated},
+		{"popularity", fmt.Sprint(info.Popularity)},
+	} {
+		fmt.Fprintf(w, "%s:\t%s\n", f[0], f[1])
+	}
+	if e := w.Flush(); e != nil {
+		return e
+	}
+	if info.Notes != "" {
+		fmt.Printf("\n%s\n", info.Notes)
+	}
+	return nil
+}
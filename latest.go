@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+)
+
+// latestWindow is how many of the newest observations are requested to find the latest non-missing one
+const latestWindow = 10
+
+// latestSpec returns the spec of the latest-readings table.  It has one row per series: ReplacingMergeTree keeps
+// the row with the newest updated time, so queries should use FINAL.
+func latestSpec(tc *tableConfig) *tableSpec {
+	return &tableSpec{
+		columns: []column{
+			{name: tc.seriesCol, chType: "String", comment: "Fred II series ID"},
+			{name: tc.dateCol, chType: "Date", comment: "date of the latest value"},
+			{name: tc.valueCol, chType: "Float64", comment: "latest value of the series"},
+			{name: "updated", chType: "DateTime", comment: "time of the refresh"},
+		},
+		engine:  "ReplacingMergeTree(updated)",
+		orderBy: tc.seriesCol,
+	}
+}
+
+// latestDDL returns the statements that create the latest-readings table, and its Buffer table if it has one, if
+// they don't already exist.
+func latestDDL(table string, tc *tableConfig) []string {
+	ddl := []string{latestSpec(tc).createSQL(table, true)}
+	if tc.buffer {
+		ddl = append(ddl, bufferDDL(table, true)...)
+	}
+	return ddl
+}
+
+// loadLatest fetches the newest observations of the job's series and records the most recent one with a value
+// in the latest-readings table.
+func loadLatest(j *job, apiKey string, con *chutils.Connect) (*loadStats, error) {
+	opts := fred.Options{}
+	if j.opts != nil {
+		opts = *j.opts
+	}
+	opts.Last = latestWindow
+	recent := *j
+	recent.opts = &opts
+	var latest *fred.Observation
+	fetched := 0
+	if e := recent.stream(apiKey, func(o fred.Observation) error {
+		fetched++
+		if !o.Missing && (latest == nil || o.Date.After(latest.Date)) {
+			latest = &o
+		}
+		return nil
+	}); e != nil {
+		return nil, e
+	}
+	j.emit(event{Event: "fetched", Rows: fetched})
+	stats := &loadStats{}
+	if latest == nil {
+		return stats, nil
+	}
+	qry := fmt.Sprintf("INSERT INTO %s VALUES (?, ?, ?, now())", j.tc.insertTarget(j.table))
+	if _, e := con.Exec(qry, j.seriesId, latest.Date, latest.Value); e != nil {
+		return nil, e
+	}
+	stats.add(*latest)
+	j.emit(event{Event: "inserted", Rows: 1, Total: 1})
+	return stats, nil
+}
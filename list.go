@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// listing is the latest load of a series into a table, as recorded in the registry
+type listing struct {
+	table      string
+	seriesId   string
+	rows       uint64
+	minDate    time.Time
+	maxDate    time.Time
+	loaded     time.Time
+	query      string // query sent to Fred II, without the API key
+	provenance string // formula deriving the series, blank if loaded from Fred II
+	shape      string // settings shaping the table and its rows, as YAML, blank if the registry predates them
+	title      string // title from the metadata table, blank if unknown
+}
+
+// listCmd prints the series loaded, where, their date coverage and when they were last loaded.
+func listCmd(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	tf := addTableFlags(fs)
+	registryPtr := fs.String("registry", "", "string")
+	metaTablePtr := fs.String("meta-table", "", "string")
+	tablePtr := fs.String("table", "", "string")
+	namespacePtr := fs.String("namespace", "", "string")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := inNamespace(*namespacePtr, registryPtr, metaTablePtr, tablePtr); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	if *registryPtr == "" {
+		return fmt.Errorf("list requires -registry")
+	}
+	tc, e := tf.config()
+	if e != nil {
+		return e
+	}
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+	listings, e := loadedSeries(*registryPtr, *tablePtr, con)
+	if e != nil {
+		return diagnose(e, cf.Host)
+	}
+	if *metaTablePtr != "" {
+		if e := addTitles(listings, *metaTablePtr, tc, con); e != nil {
+			return diagnose(e, cf.Host)
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tSERIES\tROWS\tFROM\tTO\tLOADED\tTITLE")
+	for _, l := range listings {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", l.table, l.seriesId, l.rows, l.minDate.Format(fred.DateFormat),
+			l.maxDate.Format(fred.DateFormat), l.loaded.Format("2006-01-02 15:04:05"), l.title)
+	}
+	return w.Flush()
+}
+
+// loadedSeries returns the latest load of each series into each table from the registry.  If table isn't blank,
+// only the series in table are returned.
+func loadedSeries(registry string, table string, con *chutils.Connect) ([]*listing, error) {
+	qry := fmt.Sprintf(`SELECT table, seriesId, argMax(rows, loaded), argMax(minDate, loaded), argMax(maxDate, loaded),
+  max(loaded), argMax(query, loaded), argMax(provenance, loaded), argMax(shape, loaded)
+FROM %s
+WHERE ? = '' OR table = ?
+GROUP BY table, seriesId
+ORDER BY table, seriesId`, registry)
+	rows, e := con.Query(qry, table, table)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = rows.Close() }()
+	var listings []*listing
+	for rows.Next() {
+		l := &listing{}
+		if e := rows.Scan(&l.table, &l.seriesId, &l.rows, &l.minDate, &l.maxDate, &l.loaded, &l.query,
+			&l.provenance, &l.shape); e != nil {
+			return nil, e
+		}
+		listings = append(listings, l)
+	}
+	return listings, rows.Err()
+}
+
+// addTitles fills in the titles of the listings from the metadata table.
+func addTitles(listings []*listing, metaTable string, tc *tableConfig, con *chutils.Connect) error {
+	rows, e := con.Query(fmt.Sprintf("SELECT %s, title FROM %s FINAL", tc.seriesCol, metaTable))
+	if e != nil {
+		return e
+	}
+	defer func() { _ = rows.Close() }()
+	titles := make(map[string]string)
+	for rows.Next() {
+		var seriesId, title string
+		if e := rows.Scan(&seriesId, &title); e != nil {
+			return e
+		}
+		titles[seriesId] = title
+	}
+	for _, l := range listings {
+		l.title = titles[l.seriesId]
+	}
+	return rows.Err()
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/invertedv/chutils"
+	s "github.com/invertedv/chutils/sql"
+	"github.com/invertedv/fred2ch/chsink"
+	"github.com/invertedv/fred2ch/fred"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultBatch is the default number of rows per insert
+const defaultBatch = 10000
+
+// job is a single series to load
+type job struct {
+	seriesId  string        // Fred II series ID
+	table     string        // destination table
+	batchSize int           // rows per insert
+	tc        *tableConfig  // shape of the destination table
+	opts      *fred.Options // options of the Fred II request
+	frequency string        // Fred II frequency code of the observations, needed for period-end dates
+	formula   *fred.Formula // if not nil, the series is derived from other series by this formula
+	events    *eventSink    // where lifecycle events go, nil to discard them
+	dupes     string        // what to do with observations repeating a date: error, latest or all
+	retries   int           // times a failed insert is retried, if the failure may not recur
+	rejects   *deadLetter   // where rejected observations go, nil to discard them
+	spool     string        // directory rows go to if ClickHouse becomes unavailable, blank to fail the load
+	fileDir   string        // directory of the server's file() table function to insert through, blank to send rows
+	fileFmt   string        // format of the files inserted through fileDir: values or csv
+	sinks     []fred.Sink   // destinations the observations are written to besides the table
+	keep      bool          // if true, the table holds series loaded earlier in the run and is added to, not replaced
+	replace   bool          // if true, the kept table's rows of the series are deleted before the first insert
+	shape     string        // shape settings of the load, as YAML, recorded in the registry
+	inserts   *sync.Mutex   // taken by each write to the table, if other jobs write it at the same time, else nil
+	locked    bool          // if true, the run already holds the -lock-table lock on the table
+	after     string        // observations on or before this date (YYYY-MM-DD) are in the table already, none if blank
+
+	badDates string    // what to do with observations whose date can't be parsed: skip, error or sentinel
+	sentinel time.Time // date given to observations whose date can't be parsed, if badDates is sentinel
+	warns    *warnings // problems the load works around, nil to ignore them
+
+	stats   *loadStats // what the load put in the table, once it's done
+	skipped bool       // true if the load was skipped since the series hadn't changed
+	written int64      // bytes of rows sent to ClickHouse
+	usage   usage      // resources the load used, once it's done
+}
+
+// holds returns true if the whole series must be held in memory before it's inserted.
+func (j *job) holds() bool {
+	return j.tc.holds() || j.dupes == "latest"
+}
+
+// emit sends a lifecycle event of the job.
+func (j *job) emit(ev event) {
+	ev.Series, ev.Table = j.seriesId, j.table
+	j.events.emit(ev)
+}
+
+// lockInserts waits its turn to write the job's table, if other jobs write it at the same time, and returns the
+// function that gives up the turn.
+func (j *job) lockInserts() func() {
+	if j.inserts == nil {
+		return func() {}
+	}
+	j.inserts.Lock()
+	return j.inserts.Unlock
+}
+
+// stream calls fn for each observation of the job's series, which is either streamed from Fred II or computed by
+// the job's formula.
+func (j *job) stream(apiKey string, fn func(o fred.Observation) error) error {
+	opts := j.requestOptions()
+	if j.formula == nil {
+		_, e := fred.Stream(j.seriesId, apiKey, opts, fn)
+		return e
+	}
+	obs, e := j.formula.Fetch(apiKey, opts)
+	if e != nil {
+		return e
+	}
+	for _, o := range obs {
+		if e := fn(o); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// requestOptions returns the options of the job's Fred II requests.  If the table already has the series up to a
+// date, the request starts there rather than at j.opts' Start, so the observations before it aren't fetched again.
+// The registry records j.opts, which the next load of the whole series repeats.
+func (j *job) requestOptions() *fred.Options {
+	if j.after == "" || j.opts == nil {
+		return j.opts
+	}
+	after, e := time.Parse(fred.DateFormat, j.after)
+	if e != nil || !after.After(j.opts.Start) {
+		return j.opts
+	}
+	opts := *j.opts
+	opts.Start = after
+	return &opts
+}
+
+// loadStats summarizes what a load put in the table
+type loadStats struct {
+	rows      int        // rows inserted
+	minDate   time.Time  // first date inserted
+	maxDate   time.Time  // last date inserted
+	frequency string     // frequency detected from the spacing of the dates, blank if unknown
+	gaps      []fred.Gap // stretches without observations longer than the frequency allows
+}
+
+// add updates the stats for an inserted observation.
+func (ls *loadStats) add(o fred.Observation) {
+	if ls.rows == 0 || o.Date.Before(ls.minDate) {
+		ls.minDate = o.Date
+	}
+	if ls.rows == 0 || o.Date.After(ls.maxDate) {
+		ls.maxDate = o.Date
+	}
+	ls.rows++
+}
+
+// errStopped is returned to the fetch stage when a later stage of the pipeline has quit
+var errStopped = errors.New("pipeline stopped")
+
+// maketable creates the output table.  If there's an existing table, it's dropped, or kept as a snapshot or backup.
+// If j.keep is set, the existing table is left as it is, except that the rows of the series are deleted if j.replace
+// is set.
+func makeTable(j *job, con *chutils.Connect) error {
+	if j.keep && j.replace {
+		return deleteRows(j.seriesId, j.table, j.tc, con)
+	}
+	if j.keep {
+		return nil
+	}
+	// a snapshot or backup keeps the existing table under another name, so there's nothing to drop
+	if j.tc.snapshots > 0 {
+		if e := snapshot(j.table, j.tc, con); e != nil {
+			return e
+		}
+	}
+	if j.tc.backupDays > 0 {
+		if e := backup(j.table, j.tc, con); e != nil {
+			return e
+		}
+	}
+	return execDDL(tableDDL(j.seriesId, j.table, j.tc), con)
+}
+
+// loadSeries moves the series from Fred II into ClickHouse through a pipeline of three stages:
+//   - fetch: decodes and parses observations as the response arrives
+//   - batch: checks the spacing of the dates, drops rows that can't be loaded and groups the rest into batches of
+//     j.batchSize rows
+//   - insert: writes each batch to ClickHouse
+//
+// The stages are joined by bounded channels, so memory stays flat regardless of the length of the series and
+// inserts overlap the download.  The table is created when the first batch is ready.  Any existing version of
+// table is dropped, unless j.keep is set.  If the download fails partway, the batches already inserted remain in
+// the table; if it fails before the first full batch is ready, or the batches are held, the table is left as it
+// was.
+func loadSeries(j *job, apiKey string, con *chutils.Connect) (*loadStats, error) {
+	// done is closed when the insert stage quits, telling the other stages to stop
+	done := make(chan struct{})
+	obsCh := make(chan fred.Observation, j.batchSize)
+	batchCh := make(chan []fred.Observation, 1)
+	fetchErr := make(chan error, 1)
+	// failed is set by the fetch stage before it closes obsCh, for the batch stage
+	failed := false
+
+	// fetch stage
+	go func() {
+		defer close(obsCh)
+		fetched := 0
+		// values of a date from different vintages aren't duplicates
+		type key struct{ date, realtime time.Time }
+		seen := make(map[key]bool)
+		e := j.stream(apiKey, func(o fred.Observation) error {
+			if o.BadDate {
+				if e := j.warns.note("unparseable date", "series %s has a date that can't be parsed",
+					j.seriesId); e != nil {
+					return e
+				}
+				switch j.badDates {
+				case "error":
+					return fmt.Errorf("series %s has a date that can't be parsed (see -bad-dates)", j.seriesId)
+				case "skip":
+					return nil
+				}
+				o.Date = j.sentinel
+			}
+			if j.dupes == "error" && !o.BadDate && !fred.IsMissingDate(o.Date) {
+				k := key{date: o.Date, realtime: o.RealtimeStart}
+				if seen[k] {
+					return fmt.Errorf("series %s has more than one observation for %s (see -dupes)", j.seriesId,
+						o.Date.Format(fred.DateFormat))
+				}
+				seen[k] = true
+			}
+			// the batch stage drops these, since the date column can't hold them
+			minYear := j.tc.minYear()
+			if !o.Missing && !o.BadDate && !fred.IsMissingDate(o.Date) && o.Date.Year() < minYear {
+				category := fmt.Sprintf("date before %d", minYear)
+				if e := j.warns.note(category, "series %s has an observation on %s, before %d", j.seriesId,
+					o.Date.Format(fred.DateFormat), minYear); e != nil {
+					return e
+				}
+			}
+			select {
+			case obsCh <- o:
+				fetched++
+				return nil
+			case <-done:
+				return errStopped
+			}
+		})
+		if e == nil {
+			j.emit(event{Event: "fetched", Rows: fetched})
+		}
+		failed = e != nil
+		fetchErr <- e
+	}()
+
+	// batch stage
+	spacing := fred.NewSpacing()
+	go func() {
+		defer close(batchCh)
+		batch := make([]fred.Observation, 0, j.batchSize)
+		var prev time.Time
+		for o := range obsCh {
+			// the vintages of a date follow one another
+			if !o.BadDate && !fred.IsMissingDate(o.Date) && !o.Date.Equal(prev) {
+				spacing.Add(o.Date)
+				prev = o.Date
+			}
+			// Fred II has no value for this date
+			if o.Missing && j.tc.nulls == "skip" {
+				continue
+			}
+			// don't load dates the date column can't hold: those before 1970, unless it's a Date32 or DateTime64
+			if o.Date.Year() < j.tc.minYear() {
+				if !fred.IsMissingDate(o.Date) && !o.Missing {
+					j.rejects.add(j.seriesId, o.Date.Format(fred.DateFormat), strconv.FormatFloat(o.Value, 'f', -1, 64),
+						fmt.Sprintf("date before %d, which the date column can't hold", j.tc.minYear()))
+				}
+				continue
+			}
+			// the table already has it
+			if j.after != "" && o.Date.Format(fred.DateFormat) <= j.after {
+				continue
+			}
+			if batch = append(batch, o); len(batch) < j.batchSize {
+				continue
+			}
+			select {
+			case batchCh <- batch:
+			case <-done:
+				return
+			}
+			batch = make([]fred.Observation, 0, j.batchSize)
+		}
+		// the last batch of a series that didn't arrive whole isn't a batch of the series
+		if len(batch) > 0 && !failed {
+			select {
+			case batchCh <- batch:
+			case <-done:
+			}
+		}
+	}()
+
+	// insert stage
+	var fe error
+	received := false
+	fetched := func(wait bool) error {
+		if received {
+			return fe
+		}
+		if wait {
+			fe, received = <-fetchErr, true
+			return fe
+		}
+		select {
+		case fe = <-fetchErr:
+			received = true
+		default:
+		}
+		return fe
+	}
+	stats, e := insertBatches(batchCh, fetched, j, con)
+	close(done)
+	if fe := fetched(true); e == nil && fe != nil {
+		return nil, fe
+	}
+	if e != nil {
+		return nil, e
+	}
+	// the batch stage is finished, since batchCh is closed
+	stats.frequency, stats.gaps = spacing.Frequency(), spacing.Gaps()
+	return stats, nil
+}
+
+// insertBatches writes each batch received on batchCh to table, creating the table before the first batch.
+// If no batches arrive, an empty table is created.  If the value type is to be detected, enrichment columns
+// computed or duplicate dates resolved, the batches are held until the series is complete.  If ClickHouse becomes
+// unavailable and the job has a spool directory, the rest of the batches are spooled and ErrSpooled returned.
+// fetched returns the outcome of the fetch, waiting for it if wait is set, otherwise returning nil while the fetch
+// is running.  It's checked before the table is created and once batchCh is closed: if the fetch failed, its error
+// is returned without creating the table, inserting the held batches or keeping the spool, since the series didn't
+// arrive whole.
+func insertBatches(batchCh <-chan []fred.Observation, fetched func(wait bool) error, j *job,
+	con *chutils.Connect) (stats *loadStats, err error) {
+	stats = &loadStats{}
+	// the other sinks are finalized with the outcome of the load, whatever it is
+	for _, sk := range j.sinks {
+		if e := sk.CreateSchema(j.seriesId); e != nil {
+			return nil, e
+		}
+		defer func(sk fred.Sink) {
+			if e := sk.Finalize(j.seriesId, err); err == nil && e != nil {
+				stats, err = nil, e
+			}
+		}(sk)
+	}
+	ch := &chSink{j: j, con: con}
+	created := false
+	var sp *spool
+	write := func(batch []fred.Observation, extra [][]float64) error {
+		if !created {
+			// a fetch that has failed already doesn't get to replace the table
+			if e := fetched(false); e != nil {
+				return e
+			}
+			if e := ch.CreateSchema(j.seriesId); e != nil {
+				return e
+			}
+			created = true
+		}
+		return ch.writeEnriched(batch, extra)
+	}
+	insert := func(batch []fred.Observation, extra [][]float64) error {
+		if sp != nil {
+			return sp.add(batch, extra, j)
+		}
+		e := write(batch, extra)
+		if e != nil && j.spool != "" && unavailable(e) {
+			fmt.Printf("ClickHouse is unavailable, spooling the rest of series %s: %v\n", j.seriesId, e)
+			if sp, e = openSpool(j, created); e != nil {
+				return e
+			}
+			created = true
+			return sp.add(batch, extra, j)
+		}
+		if e != nil {
+			return e
+		}
+		for _, o := range batch {
+			stats.add(o)
+		}
+		for _, sk := range j.sinks {
+			if e := sk.WriteBatch(j.seriesId, batch); e != nil {
+				return e
+			}
+		}
+		j.emit(event{Event: "inserted", Rows: len(batch), Total: stats.rows})
+		return nil
+	}
+	// if the load fails in a way a spool won't fix, the spool is dropped
+	defer func() {
+		if sp != nil {
+			_ = sp.discard()
+		}
+	}()
+	var held []fred.Observation
+	for batch := range batchCh {
+		if j.holds() {
+			held = append(held, batch...)
+			continue
+		}
+		if e := insert(batch, nil); e != nil {
+			return nil, e
+		}
+	}
+	if e := fetched(true); e != nil {
+		// a spool of part of the series would be flushed by the next run as if it were the whole of it
+		if sp != nil {
+			fmt.Printf("series %s wasn't fetched whole, the rows spooled are discarded\n", j.seriesId)
+		}
+		return nil, e
+	}
+	if j.holds() {
+		if j.dupes == "latest" {
+			held = latestByDate(held)
+		}
+		if j.tc.detectInt {
+			detected := *j
+			detected.tc = j.tc.withValueType(detectValueType(held, j.tc.valueType))
+			j = &detected
+			ch.j = j
+		}
+		sort.SliceStable(held, func(a, b int) bool { return held[a].Date.Before(held[b].Date) })
+		extra := j.tc.enrich(held)
+		for start := 0; start < len(held); start += j.batchSize {
+			end := start + j.batchSize
+			if end > len(held) {
+				end = len(held)
+			}
+			var batchExtra [][]float64
+			if extra != nil {
+				batchExtra = extra[start:end]
+			}
+			if e := insert(held[start:end], batchExtra); e != nil {
+				return nil, e
+			}
+		}
+	}
+	if sp != nil {
+		done := sp
+		sp = nil
+		name, e := done.close()
+		if e != nil {
+			return nil, e
+		}
+		return nil, fmt.Errorf("%w: %d rows of series %s spooled to %s, to be loaded by the next run with -spool",
+			ErrSpooled, done.rows, j.seriesId, name)
+	}
+	if created {
+		return stats, nil
+	}
+	return stats, ch.CreateSchema(j.seriesId)
+}
+
+// chSink is the ClickHouse Sink of a job: its table, created by makeTable and written by retryInsert
+type chSink struct {
+	j   *job
+	con *chutils.Connect
+}
+
+// CreateSchema creates the job's table, replacing any existing one unless the job keeps it.
+func (s *chSink) CreateSchema(seriesId string) error {
+	defer s.j.lockInserts()()
+	return makeTable(s.j, s.con)
+}
+
+// WriteBatch inserts a batch into the job's table.
+func (s *chSink) WriteBatch(seriesId string, batch []fred.Observation) error {
+	return s.writeEnriched(batch, nil)
+}
+
+// writeEnriched inserts a batch into the job's table along with the values of its enrichment columns, which
+// depend on the whole series and so aren't part of the Sink interface.
+func (s *chSink) writeEnriched(batch []fred.Observation, extra [][]float64) error {
+	defer s.j.lockInserts()()
+	return retryInsert(batch, extra, s.j, s.con)
+}
+
+// Finalize does nothing: each batch is committed as it's inserted.
+func (s *chSink) Finalize(seriesId string, err error) error {
+	return nil
+}
+
+// latestByDate returns obs with only the last of the observations for each date, in the order of obs otherwise.
+func latestByDate(obs []fred.Observation) []fred.Observation {
+	last := make(map[time.Time]int)
+	for ind, o := range obs {
+		last[o.Date] = ind
+	}
+	kept := make([]fred.Observation, 0, len(last))
+	for ind, o := range obs {
+		if last[o.Date] == ind {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
+
+// detectValueType returns the integer type that holds every value in obs exactly: UInt32 if possible,
+// otherwise Int64.  If some value isn't an integer, or there are no values, def is returned.
+func detectValueType(obs []fred.Observation, def string) string {
+	valueType := ""
+	for _, o := range obs {
+		v := o.Value
+		// beyond 2^53 float64 can't tell us whether the value was an integer
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return def
+		}
+		if v < 0 || v > math.MaxUint32 {
+			valueType = "Int64"
+		} else if valueType == "" {
+			valueType = "UInt32"
+		}
+	}
+	if valueType == "" {
+		return def
+	}
+	return valueType
+}
+
+// maxRetryWait is the longest wait before retrying an insert
+const maxRetryWait = 30 * time.Second
+
+// retryInsert writes a single batch to the job's table, retrying with exponential backoff if ClickHouse refuses the
+// insert in a way that may not recur.
+func retryInsert(batch []fred.Observation, extra [][]float64, j *job, con *chutils.Connect) error {
+	wait := time.Second
+	for attempt := 0; ; attempt++ {
+		e := insertBatch(batch, extra, j, con)
+		if e == nil || attempt == j.retries || !retryableInsert(e) {
+			return e
+		}
+		fmt.Printf("insert into %s failed, retrying in %s: %v\n", j.table, wait, e)
+		time.Sleep(wait)
+		if wait *= 2; wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+	}
+}
+
+// insertBatch writes a single batch to the job's table.  extra holds the enrichment column values of each
+// observation, and is nil if there are none.
+func insertBatch(batch []fred.Observation, extra [][]float64, j *job, con *chutils.Connect) error {
+	if j.fileDir != "" {
+		return fileInsert(batch, extra, j, con)
+	}
+	// Create a writer
+	wtr := s.NewWriter(j.tc.insertTarget(j.table), con)
+	defer func() {
+		if e := wtr.Close(); e != nil {
+			fmt.Println(e)
+		}
+	}()
+	for ind, o := range batch {
+		var ex []float64
+		if extra != nil {
+			ex = extra[ind]
+		}
+		line, e := j.tc.row(j.seriesId, o, j.frequency, ex)
+		if e != nil {
+			return e
+		}
+		if _, e := wtr.Write([]byte(line)); e != nil {
+			return e
+		}
+		j.written += int64(len(line))
+	}
+	return chsink.Classify(wtr.Insert())
+}
+
+// maxGapWarnings is the most gaps listed for a series
+const maxGapWarnings = 10
+
+// warnGaps prints a warning for each gap found in the series of j.  In strict mode, a gap is an error.
+func warnGaps(j *job, stats *loadStats) error {
+	for ind, g := range stats.gaps {
+		if e := j.warns.note("gap", "series %s (frequency %s) has no observations between %s and %s", j.seriesId,
+			stats.frequency, g.After.Format(fred.DateFormat), g.Before.Format(fred.DateFormat)); e != nil {
+			return e
+		}
+		if ind < maxGapWarnings {
+			fmt.Printf("warning: series %s (frequency %s) has no observations between %s and %s\n", j.seriesId,
+				stats.frequency, g.After.Format(fred.DateFormat), g.Before.Format(fred.DateFormat))
+		}
+	}
+	if len(stats.gaps) > maxGapWarnings {
+		fmt.Printf("warning: %d more gaps in series %s\n", len(stats.gaps)-maxGapWarnings, j.seriesId)
+	}
+	return nil
+}
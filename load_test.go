@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/invertedv/fred2ch/fred"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectValueType(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		values []float64
+		want   string
+	}{
+		{name: "no values", want: "Float32"},
+		{name: "small integers", values: []float64{0, 1, 42}, want: "UInt32"},
+		{name: "largest UInt32", values: []float64{1, math.MaxUint32}, want: "UInt32"},
+		{name: "beyond UInt32", values: []float64{1, math.MaxUint32 + 1}, want: "Int64"},
+		{name: "negative", values: []float64{3, -2, 5}, want: "Int64"},
+		{name: "fraction", values: []float64{1, 2.5, 3}, want: "Float32"},
+		{name: "negative fraction", values: []float64{-1, -0.5}, want: "Float32"},
+		{name: "beyond exact integers", values: []float64{1 << 54}, want: "Float32"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var obs []fred.Observation
+			for _, v := range tt.values {
+				obs = append(obs, fred.Observation{Value: v})
+			}
+			if got := detectValueType(obs, "Float32"); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestByDate(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	obs := []fred.Observation{{Date: day(1), Value: 1}, {Date: day(2), Value: 2}, {Date: day(1), Value: 3},
+		{Date: day(3), Value: 4}, {Date: day(2), Value: 5}, {Date: day(2), Value: 6}}
+	got := latestByDate(obs)
+	want := []fred.Observation{{Date: day(1), Value: 3}, {Date: day(3), Value: 4}, {Date: day(2), Value: 6}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for ind := range want {
+		if !got[ind].Date.Equal(want[ind].Date) || got[ind].Value != want[ind].Value {
+			t.Errorf("observation %d is %v, want %v", ind, got[ind], want[ind])
+		}
+	}
+	if got := latestByDate(nil); len(got) != 0 {
+		t.Errorf("no observations gave %v", got)
+	}
+}
+
+func TestJobHolds(t *testing.T) {
+	for _, tt := range []struct {
+		dupes     string
+		detectInt bool
+		want      bool
+	}{{"error", false, false}, {"all", false, false}, {"latest", false, true}, {"error", true, true}} {
+		j := &job{dupes: tt.dupes, tc: &tableConfig{detectInt: tt.detectInt}}
+		if got := j.holds(); got != tt.want {
+			t.Errorf("-dupes %s with detectInt %v holds the series: %v, want %v", tt.dupes, tt.detectInt, got,
+				tt.want)
+		}
+	}
+}
+
+// truncatedFred is a transport whose responses break off after the first observation
+type truncatedFred struct{}
+
+func (truncatedFred) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := `{"count":3,"observations":[{"date":"2020-01-01","value":"1"},{"date":"20`
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{},
+		Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+func TestLoadSeriesFetchFails(t *testing.T) {
+	defer fred.SetClient(nil)
+	fred.SetClient(&http.Client{Transport: truncatedFred{}})
+	// the table isn't touched, so there's no connection to ClickHouse
+	for _, keep := range []bool{false, true} {
+		j := &job{seriesId: "GDP", table: "t", batchSize: 10, tc: newTableConfig(), opts: &fred.Options{},
+			keep: keep, replace: keep}
+		if _, e := loadSeries(j, "key", nil); e == nil {
+			t.Errorf("a fetch that broke off wasn't an error (keep %v)", keep)
+		}
+	}
+}
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// account is the access to ClickHouse and Fred II a load uses
+type account struct {
+	Host     string `yaml:"host"`     // ClickHouse host, or a comma-separated list of hosts
+	User     string `yaml:"user"`     // ClickHouse user
+	Password string `yaml:"password"` // ClickHouse password
+	API      string `yaml:"api"`      // Fred II API key
+
+	InsertSettings string `yaml:"insert-settings"` // ClickHouse settings for the session, as name=value,...
+	Compression    string `yaml:"compression"`     // compression of the ClickHouse connection: lz4 or none
+	SSH            string `yaml:"ssh"`             // [user@]host of a bastion to tunnel to ClickHouse through
+	WaitForDB      string `yaml:"wait-for-db"`     // how long to keep trying to connect to ClickHouse, e.g. 60s
+
+	Secure             bool   `yaml:"secure"`               // if true, the ClickHouse connection uses TLS
+	CACert             string `yaml:"ca-cert"`              // PEM file of CA certificates trusted besides the system's
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify"` // if true, server certificates aren't verified
+	TLSCert            string `yaml:"tls-cert"`             // PEM file of the client certificate for ClickHouse
+	TLSKey             string `yaml:"tls-key"`              // PEM file of the key of TLSCert
+
+	Secrets string `yaml:"secrets"` // secret holding settings: vault://path or aws-sm://id, blank for none
+
+	PerMinute  int `yaml:"api-per-minute"` // Fred II requests allowed per minute, 0 for no limit
+	PerDay     int `yaml:"api-per-day"`    // Fred II requests allowed per day, 0 for no limit
+	MaxRetries int `yaml:"max-retries"`    // times a refused, failed or undelivered Fred II request is retried
+
+	Rate *int `yaml:"rate"` // deprecated name of api-per-minute, which it overrides if set
+
+	UsageTable string `yaml:"usage-table"` // table counting the Fred II requests per API key per day, blank for none
+}
+
+// defaultPerMinute is the default number of Fred II requests allowed per minute, Fred II's own limit
+const defaultPerMinute = 120
+
+// defaultMaxRetries is the default number of times a refused or failed Fred II request is retried
+const defaultMaxRetries = 5
+
+// pace paces the Fred II requests of the run to the budgets of acct, and sets how often they are retried.
+// It returns the pacer, which is nil if there are no budgets.
+func (acct *account) pace() (*fred.Pacer, error) {
+	if acct.Rate != nil {
+		fmt.Println("warning: -rate is deprecated; use -api-per-minute")
+		acct.PerMinute, acct.Rate = *acct.Rate, nil
+	}
+	if acct.PerMinute < 0 || acct.PerDay < 0 || acct.MaxRetries < 0 {
+		return nil, fmt.Errorf("-api-per-minute, -api-per-day and -max-retries can't be negative")
+	}
+	fred.SetRetries(acct.MaxRetries)
+	if acct.PerMinute == 0 && acct.PerDay == 0 {
+		return nil, nil
+	}
+	p := fred.NewPacer(acct.PerMinute, acct.PerDay)
+	fred.SetPacer(p)
+	return p, nil
+}
+
+// loadSpec holds the settings of a load.  They come from the command line or a job in a jobs file, which use the
+// same names.  Blank column settings leave the column as the preset, or the default, has it.
+type loadSpec struct {
+	Series        string `yaml:"series"`
+	Formula       string `yaml:"formula"`
+	Release       int    `yaml:"release"`
+	Category      int    `yaml:"category"`
+	Recursive     bool   `yaml:"recursive"`
+	Search        string `yaml:"search"`
+	Table         string `yaml:"table"`
+	Batch         int    `yaml:"batch"`
+	Last          int    `yaml:"last"`
+	Start         string `yaml:"start"`
+	End           string `yaml:"end"`
+	Archive       string `yaml:"archive"`
+	Registry      string `yaml:"registry"`
+	SkipUnchanged bool   `yaml:"skip-unchanged"`
+	LockTable     string `yaml:"lock-table"`
+	Latest        string `yaml:"latest"`
+	MetaTable     string `yaml:"meta-table"`
+	Meta          bool   `yaml:"meta"`
+	DeadLetter    string `yaml:"dead-letter"`
+	Dictionary    string `yaml:"dictionary"`
+	CreateDB      bool   `yaml:"create-db"`
+	Namespace     string `yaml:"namespace"`
+	Mode          string `yaml:"mode"`
+	Refresh       bool   `yaml:"refresh"`
+
+	ColSeries    string `yaml:"col-series"`
+	ColDate      string `yaml:"col-date"`
+	ColValue     string `yaml:"col-value"`
+	DetectInt    bool   `yaml:"detect-int"`
+	Rollup       string `yaml:"rollup"`
+	RollupEngine string `yaml:"rollup-engine"`
+	Preset       string `yaml:"preset"`
+	PeriodEnd    string `yaml:"period-end"`
+	DateType     string `yaml:"date-type"`
+	Date32       bool   `yaml:"date32"`
+	TZ           string `yaml:"tz"`
+	ZScore       string `yaml:"zscore"`
+	PctRank      bool   `yaml:"pct-rank"`
+	Outlier      string `yaml:"outlier"`
+	Transform    string `yaml:"transform"`
+	Dupes        string `yaml:"dupes"`
+	BadDates     string `yaml:"bad-dates"`
+	Nulls        string `yaml:"nulls"`
+	StrictJSON   bool   `yaml:"strict-json"`
+	Strict       bool   `yaml:"strict"`
+	Buffer       bool   `yaml:"buffer"`
+	DateIndex    bool   `yaml:"date-index"`
+	SeriesIndex  bool   `yaml:"series-index"`
+	Projection   string `yaml:"projection"`
+	Fanout       string `yaml:"fanout"`
+	Snapshots    int    `yaml:"snapshot"`
+	BackupDays   int    `yaml:"backup-days"`
+	Cluster      string `yaml:"cluster"`
+	Distributed  bool   `yaml:"distributed"`
+	Spool        string `yaml:"spool"`
+	Sink         string `yaml:"sink"`
+	FileDir      string `yaml:"file-dir"`
+	FileFormat   string `yaml:"file-format"`
+
+	InsertRetries int `yaml:"insert-retries"`
+	PageWorkers   int `yaml:"page-workers"`
+
+	RealtimeStart string `yaml:"realtime-start"`
+	RealtimeEnd   string `yaml:"realtime-end"`
+	Vintages      bool   `yaml:"vintages"`
+
+	Freq  string `yaml:"freq"`
+	Agg   string `yaml:"agg"`
+	Units string `yaml:"units"`
+
+	FilterFrequency string `yaml:"filter-frequency"`
+	FilterUnits     string `yaml:"filter-units"`
+	MinPopularity   int    `yaml:"min-popularity"`
+}
+
+// frequencies are the values of -freq, the frequencies Fred II aggregates observations to
+var frequencies = map[string]bool{"w": true, "bw": true, "m": true, "q": true, "sa": true, "a": true}
+
+// aggregations are the values of -agg, how Fred II aggregates observations to the -freq frequency
+var aggregations = map[string]bool{"avg": true, "sum": true, "eop": true}
+
+// unitsTransforms are the values of -units, the transformations Fred II applies to the values, with what each
+// makes of them
+var unitsTransforms = map[string]string{
+	"lin": "levels",
+	"chg": "change",
+	"ch1": "change from a year ago",
+	"pch": "percent change",
+	"pc1": "percent change from a year ago",
+	"pca": "compounded annual rate of change",
+	"cch": "continuously compounded rate of change",
+	"cca": "continuously compounded annual rate of change",
+	"log": "natural log",
+}
+
+// defaultInsertRetries is the default number of times a failed insert is retried
+const defaultInsertRetries = 3
+
+// defaultLoadSpec returns the settings of a load that sets nothing but the defaults.
+func defaultLoadSpec() loadSpec {
+	return loadSpec{Batch: defaultBatch, TZ: "UTC", Dupes: "error", BadDates: "skip", Nulls: "skip",
+		InsertRetries: defaultInsertRetries}
+}
+
+// check returns an error if a required setting is missing or a setting is out of range.
+func (ls *loadSpec) check() error {
+	switch {
+	case ls.Series == "" && ls.Formula == "" && !ls.fromCatalog():
+		return fmt.Errorf("-series, -formula, -release, -category or -search is required")
+	case ls.Release < 0 || ls.Category < 0:
+		return fmt.Errorf("-release and -category must be positive IDs")
+	case ls.fromCatalog() && (ls.Series != "" || ls.catalogSources() > 1):
+		return fmt.Errorf("only one of -series, -release, -category and -search can be used")
+	case ls.Recursive && ls.Category == 0:
+		return fmt.Errorf("-recursive requires -category")
+	case (ls.FilterFrequency != "" || ls.FilterUnits != "" || ls.MinPopularity != 0) && !ls.fromCatalog():
+		return fmt.Errorf("-filter-frequency, -filter-units and -min-popularity require -release, -category or -search")
+	case ls.shared() && (ls.Formula != "" || ls.DetectInt || ls.SkipUnchanged):
+		return fmt.Errorf("a list of series, a release, a category or a search can't be used with -formula, " +
+			"-detect-int or -skip-unchanged")
+	case ls.Table == "" && ls.Latest == "":
+		return fmt.Errorf("-table or -latest is required")
+	case ls.Batch < 0 || ls.Last < 0 || ls.InsertRetries < 0 || ls.PageWorkers < 0 || ls.Snapshots < 0 ||
+		ls.BackupDays < 0:
+		return fmt.Errorf("-batch, -last, -insert-retries, -page-workers, -snapshot and -backup-days can't be negative")
+	case ls.Date32 && ls.DateType != "":
+		return fmt.Errorf("-date32 can't be used with -date-type")
+	case ls.Meta && (ls.MetaTable != "" || ls.Table == ""):
+		return fmt.Errorf("-meta requires -table and can't be used with -meta-table")
+	case ls.Dictionary != "" && ls.metaTable() == "":
+		return fmt.Errorf("-dictionary requires -meta-table or -meta")
+	case ls.SkipUnchanged && ls.Registry == "":
+		return fmt.Errorf("-skip-unchanged requires -registry")
+	case ls.Fanout != "" && ls.Latest != "":
+		return fmt.Errorf("-fanout can't be used with -latest")
+	case (ls.Snapshots > 0 || ls.BackupDays > 0) && (ls.Fanout != "" || ls.Latest != ""):
+		return fmt.Errorf("-snapshot and -backup-days can't be used with -fanout or -latest")
+	case ls.Snapshots > 0 && ls.BackupDays > 0:
+		return fmt.Errorf("-snapshot and -backup-days can't be used together")
+	case ls.Spool != "" && ls.Latest != "":
+		return fmt.Errorf("-spool can't be used with -latest")
+	case ls.Distributed && ls.Cluster == "":
+		return fmt.Errorf("-distributed requires -cluster")
+	case ls.Cluster != "" && (ls.Rollup != "" || ls.Fanout != "" || ls.Buffer || ls.Snapshots > 0 ||
+		ls.BackupDays > 0 || ls.Latest != ""):
+		return fmt.Errorf("-cluster can't be used with -rollup, -fanout, -buffer, -snapshot, -backup-days or -latest")
+	}
+	realtime := ls.RealtimeStart != "" || ls.RealtimeEnd != "" || ls.Vintages
+	switch {
+	case ls.Vintages && (ls.RealtimeStart != "" || ls.RealtimeEnd != ""):
+		return fmt.Errorf("-vintages can't be used with -realtime-start or -realtime-end")
+	case realtime && (ls.Formula != "" || ls.Latest != "" || ls.Rollup != "" || strings.EqualFold(ls.Dupes, "latest")):
+		return fmt.Errorf("vintages can't be loaded with -formula, -latest, -rollup or -dupes latest")
+	case realtime && (ls.ZScore != "" || ls.PctRank || ls.Outlier != "" || ls.mode() == "append"):
+		return fmt.Errorf("vintages can't be loaded with -zscore, -pct-rank, -outlier or -mode append")
+	}
+	mode := ls.mode()
+	switch {
+	case ls.Refresh && strings.EqualFold(ls.Mode, "create"):
+		return fmt.Errorf("-refresh can't be used with -mode create")
+	case mode != "" && !loadModes[mode]:
+		return fmt.Errorf("-mode must be create, append or replace, not %s", ls.Mode)
+	case mode != "" && mode != "replace" && ls.Latest != "":
+		return fmt.Errorf("-mode %s can't be used with -latest", mode)
+	case mode == "append" && (ls.Fanout != "" || ls.ZScore != "" || ls.PctRank || ls.Outlier != ""):
+		return fmt.Errorf("-mode append can't be used with -fanout, -zscore, -pct-rank or -outlier")
+	}
+	switch {
+	case ls.Freq != "" && !frequencies[strings.ToLower(ls.Freq)]:
+		return fmt.Errorf("-freq must be w, bw, m, q, sa or a, not %s", ls.Freq)
+	case ls.Agg != "" && (ls.Freq == "" || !aggregations[strings.ToLower(ls.Agg)]):
+		return fmt.Errorf("-agg must be avg, sum or eop, and requires -freq")
+	case ls.Units != "" && unitsTransforms[strings.ToLower(ls.Units)] == "":
+		return fmt.Errorf("-units must be lin, chg, ch1, pch, pc1, pca, cch, cca or log, not %s", ls.Units)
+	}
+	switch strings.ToLower(ls.Dupes) {
+	case "", "error", "latest", "all":
+	default:
+		return fmt.Errorf("-dupes must be error, latest or all, not %s", ls.Dupes)
+	}
+	switch nulls := strings.ToLower(ls.Nulls); {
+	case nulls != "" && nulls != "skip" && ls.Latest != "":
+		return fmt.Errorf("-nulls %s can't be used with -latest", nulls)
+	case nulls == "null" && (ls.Rollup != "" || ls.ZScore != "" || ls.PctRank || ls.Outlier != ""):
+		return fmt.Errorf("-nulls null can't be used with -rollup, -zscore, -pct-rank or -outlier")
+	}
+	return nil
+}
+
+// mode returns the -mode of the load, which -refresh makes append.
+func (ls *loadSpec) mode() string {
+	if ls.Refresh {
+		return "append"
+	}
+	return strings.ToLower(ls.Mode)
+}
+
+// metaTable returns the table the series' Fred II metadata is recorded in: -meta-table, or <table>_meta with -meta.
+// It's blank if the metadata isn't recorded.
+func (ls *loadSpec) metaTable() string {
+	if ls.Meta && ls.Table != "" {
+		return ls.Table + "_meta"
+	}
+	return ls.MetaTable
+}
+
+// seriesID returns id as the series ID is stored in a table: Fred II IDs aren't case-sensitive, and the loads and
+// the commands all use upper case, so a series given as gdp is found as GDP.
+func seriesID(id string) string {
+	return strings.ToUpper(strings.TrimSpace(id))
+}
+
+// seriesList returns the series IDs of -series, which may be a comma-separated list.
+func (ls *loadSpec) seriesList() []string {
+	var ids []string
+	for _, id := range strings.Split(ls.Series, ",") {
+		if id = seriesID(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// shared returns true if the load puts several series in the table: a list of them or those of a release or
+// category.
+func (ls *loadSpec) shared() bool {
+	return len(ls.seriesList()) > 1 || ls.fromCatalog()
+}
+
+// tableConfig returns the table config of the load and the location of its dates.
+func (ls *loadSpec) tableConfig() (*tableConfig, *time.Location, error) {
+	tc := newTableConfig()
+	if ls.Preset != "" {
+		if e := tc.applyPreset(ls.Preset); e != nil {
+			return nil, nil, e
+		}
+	}
+	// column settings given explicitly override the preset
+	if ls.DateType != "" {
+		if e := tc.setDateType(ls.DateType); e != nil {
+			return nil, nil, e
+		}
+	}
+	if ls.Date32 {
+		tc.dateType = "Date32"
+	}
+	for _, c := range []struct{ setting, col *string }{
+		{&ls.ColSeries, &tc.seriesCol}, {&ls.ColDate, &tc.dateCol}, {&ls.ColValue, &tc.valueCol}} {
+		if *c.setting != "" {
+			*c.col = *c.setting
+		}
+	}
+	tz := ls.TZ
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, e := time.LoadLocation(tz)
+	if e != nil {
+		return nil, nil, fmt.Errorf("bad -tz: %w", e)
+	}
+	tc.setTimeZone(loc.String())
+	tc.detectInt = ls.DetectInt
+	tc.realtime = ls.RealtimeStart != "" || ls.RealtimeEnd != "" || ls.Vintages
+	if ls.Nulls != "" {
+		tc.nulls = strings.ToLower(ls.Nulls)
+	}
+	tc.units = strings.ToLower(ls.Units)
+	// a list of series share the table
+	if ls.shared() {
+		tc.bySeries = true
+	}
+	tc.periodEnd = strings.ToLower(ls.PeriodEnd)
+	tc.buffer = ls.Buffer
+	tc.dateIndex, tc.seriesIndex = ls.DateIndex, ls.SeriesIndex
+	tc.fanout = parseFanout(ls.Fanout)
+	tc.snapshots, tc.backupDays = ls.Snapshots, ls.BackupDays
+	tc.cluster, tc.distributed = ls.Cluster, ls.Distributed
+	// the projection refers to the columns by their final names
+	if e := tc.parseProjection(ls.Projection); e != nil {
+		return nil, nil, e
+	}
+	if ls.ZScore != "" {
+		window, e := parseZScore(ls.ZScore)
+		if e != nil {
+			return nil, nil, e
+		}
+		tc.enrichments = append(tc.enrichments, zscoreEnrichment(window))
+	}
+	if ls.PctRank {
+		tc.enrichments = append(tc.enrichments, pctRankEnrichment())
+	}
+	if ls.Outlier != "" {
+		k, window, e := parseOutlier(ls.Outlier)
+		if e != nil {
+			return nil, nil, e
+		}
+		tc.enrichments = append(tc.enrichments, outlierEnrichment(k, window))
+	}
+	if ls.RollupEngine != "" {
+		tc.rollupEngine = strings.ToLower(ls.RollupEngine)
+	}
+	if tc.rollups, e = parseRollups(ls.Rollup); e != nil {
+		return nil, nil, e
+	}
+	return tc, loc, tc.check()
+}
+
+// shapeSettings are the settings of a load that decide the columns of its table and the rows written to it
+var shapeSettings = []string{"preset", "col-series", "col-date", "col-value", "date-type", "date32", "tz",
+	"period-end", "nulls", "zscore", "pct-rank", "outlier", "buffer", "cluster", "distributed", "units",
+	"realtime-start", "realtime-end", "vintages"}
+
+// shape returns the shape settings of the load that aren't blank, as YAML.  The registry records them, so refresh
+// writes the rows the table was created for whatever its own flags say.
+func (ls *loadSpec) shape() (string, error) {
+	raw, e := yaml.Marshal(ls)
+	if e != nil {
+		return "", e
+	}
+	var all map[string]interface{}
+	if e := yaml.Unmarshal(raw, &all); e != nil {
+		return "", e
+	}
+	shape := make(map[string]interface{})
+	for _, name := range shapeSettings {
+		if v, ok := all[name]; ok && v != nil && !reflect.ValueOf(v).IsZero() {
+			shape[name] = v
+		}
+	}
+	if len(shape) == 0 {
+		return "", nil
+	}
+	raw, e = yaml.Marshal(shape)
+	return string(raw), e
+}
+
+// shapeConfig returns the table config, and the location of the dates, of a load with the shape settings shape.
+func shapeConfig(shape string) (*tableConfig, *time.Location, error) {
+	var ls loadSpec
+	if e := yaml.Unmarshal([]byte(shape), &ls); e != nil {
+		return nil, nil, fmt.Errorf("bad table shape in registry: %w", e)
+	}
+	return ls.tableConfig()
+}
+
+// job returns the job the load runs.
+func (ls *loadSpec) job() (*job, error) {
+	if e := ls.check(); e != nil {
+		return nil, e
+	}
+	tc, loc, e := ls.tableConfig()
+	if e != nil {
+		return nil, e
+	}
+	batch := ls.Batch
+	if batch == 0 {
+		batch = defaultBatch
+	}
+	dupes := strings.ToLower(ls.Dupes)
+	if dupes == "" {
+		dupes = "error"
+	}
+	j := &job{seriesId: seriesID(ls.Series), table: ls.Table, batchSize: batch, tc: tc, dupes: dupes,
+		retries: ls.InsertRetries, spool: ls.Spool, fileDir: ls.FileDir,
+		opts: &fred.Options{Last: ls.Last, Location: loc, PageWorkers: ls.PageWorkers,
+			Frequency: strings.ToLower(ls.Freq), Aggregation: strings.ToLower(ls.Agg), Units: tc.units}}
+	switch j.badDates = strings.ToLower(ls.BadDates); j.badDates {
+	case "":
+		j.badDates = "skip"
+	case "skip", "error":
+	default:
+		if j.sentinel, e = time.ParseInLocation(fred.DateFormat, ls.BadDates, loc); e != nil {
+			return nil, fmt.Errorf("-bad-dates must be skip, error or a date (YYYY-MM-DD), not %s", ls.BadDates)
+		}
+		j.badDates = "sentinel"
+	}
+	if j.shape, e = ls.shape(); e != nil {
+		return nil, e
+	}
+	if j.fileFmt, e = parseFileFormat(ls.FileFormat); e != nil {
+		return nil, e
+	}
+	j.warns = newWarnings(ls.Strict)
+	// bad dates go to the dead-letter table only if they're skipped.  In strict mode, nothing is skipped: a value
+	// that can't be parsed fails the request and a date that can't be parsed fails the load.
+	j.opts.KeepBadDates = j.badDates != "skip" || ls.Strict
+	if !ls.Strict {
+		j.opts.Reject = func(seriesId string, d fred.Datum, err error) {
+			category := "unparseable value"
+			if _, e := time.Parse(fred.DateFormat, d.Date); e != nil {
+				category = "unparseable date"
+			}
+			_ = j.warns.note(category, "")
+			j.rejects.add(seriesId, d.Date, d.Value, err.Error())
+		}
+	}
+	for _, d := range []struct {
+		name, setting string
+		date          *time.Time
+	}{
+		{"-start", ls.Start, &j.opts.Start},
+		{"-end", ls.End, &j.opts.End},
+		{"-realtime-start", ls.RealtimeStart, &j.opts.RealtimeStart},
+		{"-realtime-end", ls.RealtimeEnd, &j.opts.RealtimeEnd},
+	} {
+		if d.setting == "" {
+			continue
+		}
+		if *d.date, e = time.Parse(fred.DateFormat, d.setting); e != nil {
+			return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD), not %s", d.name, d.setting)
+		}
+	}
+	if !j.opts.End.IsZero() && j.opts.End.Before(j.opts.Start) {
+		return nil, fmt.Errorf("-end %s is before -start %s", ls.End, ls.Start)
+	}
+	if ls.StrictJSON {
+		j.opts.Drift = func(seriesId string, problem string) error {
+			if e := j.warns.note("response drift", "Fred II response for series %s: %s", seriesId,
+				problem); e != nil {
+				return e
+			}
+			fmt.Printf("warning: Fred II response for series %s: %s\n", seriesId, problem)
+			return nil
+		}
+	}
+	if ls.Transform != "" {
+		for _, spec := range strings.Split(ls.Transform, ",") {
+			t, e := fred.NewTransform(strings.TrimSpace(spec))
+			if e != nil {
+				return nil, e
+			}
+			j.opts.Transforms = append(j.opts.Transforms, t)
+		}
+	}
+	if ls.Sink != "" {
+		for _, spec := range strings.Split(ls.Sink, ",") {
+			sk, e := runSink(spec)
+			if e != nil {
+				return nil, e
+			}
+			j.sinks = append(j.sinks, sk)
+		}
+	}
+	// a formula derives the series from others and names it
+	if ls.Formula != "" {
+		if j.formula, e = fred.ParseFormula(ls.Formula); e != nil {
+			return nil, e
+		}
+		j.seriesId = j.formula.Name
+	}
+	// in latest mode the latest-readings table takes the place of the series table
+	if ls.Latest != "" {
+		j.table = ls.Latest
+	}
+	return j, nil
+}
+
+// databaseDDL returns the statements that create the databases of the tables the load of j writes, if they don't
+// already exist.
+func (ls *loadSpec) databaseDDL(j *job) []string {
+	var ddl []string
+	seen := make(map[string]bool)
+	tables := append([]string{j.table, ls.Archive, ls.Registry, ls.LockTable, ls.metaTable(), ls.DeadLetter,
+		ls.Dictionary}, j.tc.fanout...)
+	for _, table := range tables {
+		if db, _ := splitTable(table); db != "" && !seen[db] {
+			seen[db] = true
+			ddl = append(ddl, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", db))
+		}
+	}
+	return ddl
+}
+
+// ddl returns the DDL for all the tables the load of j creates.
+func (ls *loadSpec) ddl(j *job, acct *account) []string {
+	var ddl []string
+	if ls.CreateDB {
+		ddl = ls.databaseDDL(j)
+	}
+	tables := tableDDL(j.seriesId, j.table, j.tc)
+	if ls.Latest != "" {
+		tables = latestDDL(j.table, j.tc)
+	}
+	ddl = append(ddl, tables...)
+	if ls.Archive != "" {
+		ddl = append(ddl, archiveDDL(ls.Archive)...)
+	}
+	if ls.Registry != "" {
+		ddl = append(ddl, registryDDL(ls.Registry)...)
+	}
+	if ls.LockTable != "" {
+		ddl = append(ddl, lockDDL(ls.LockTable)...)
+	}
+	if ls.metaTable() != "" {
+		ddl = append(ddl, metaDDL(ls.metaTable(), j.tc)...)
+	}
+	if ls.DeadLetter != "" {
+		ddl = append(ddl, deadLetterDDL(ls.DeadLetter)...)
+	}
+	if ls.Dictionary != "" {
+		// the DDL is printed, so the password isn't
+		password := acct.Password
+		if password != "" {
+			password = "REDACTED"
+		}
+		ddl = append(ddl, dictionaryDDL(ls.Dictionary, ls.metaTable(), acct.User, password, j.tc)...)
+	}
+	if acct.UsageTable != "" {
+		ddl = append(ddl, apiUsageDDL(acct.UsageTable)...)
+	}
+	return ddl
+}
+
+// runLoad runs the load of j, set up by ls, along with the archiving, registry, metadata and dictionary updates
+// ls asks for.
+func runLoad(ls *loadSpec, j *job, acct *account, con *chutils.Connect) (err error) {
+	start := time.Now()
+	j.emit(event{Event: "started"})
+	var rows int
+	defer func() {
+		if err != nil {
+			j.emit(event{Event: "failed", Seconds: time.Since(start).Seconds(), Error: err.Error()})
+			return
+		}
+		j.emit(event{Event: "finished", Rows: rows, Seconds: time.Since(start).Seconds()})
+	}()
+	// the databases are created before anything is fetched, so a missing one doesn't fail the load partway
+	if ls.CreateDB {
+		if e := execDDL(ls.databaseDDL(j), con); e != nil {
+			return e
+		}
+	}
+	// the requests are counted whether or not the load succeeds, since they count against the key's quota either way
+	if acct.UsageTable != "" {
+		if e := execDDL(apiUsageDDL(acct.UsageTable), con); e != nil {
+			return e
+		}
+		// other loads running at the same time count their own requests
+		defer func() {
+			if e := recordAPIUsage(acct.UsageTable, acct.API, j.usage.requests, acct.PerDay, con); e != nil {
+				fmt.Println(e)
+			}
+		}()
+	}
+	if ls.Archive != "" {
+		if e := execDDL(archiveDDL(ls.Archive), con); e != nil {
+			return e
+		}
+		j.opts.Archive = archiver(ls.Archive, con)
+	}
+	if ls.Registry != "" {
+		if e := execDDL(registryDDL(ls.Registry), con); e != nil {
+			return e
+		}
+	}
+	// the series endpoint is far cheaper than the observations
+	if ls.SkipUnchanged {
+		same, e := unchanged(ls.Registry, j, acct.API, con)
+		if e != nil {
+			return e
+		}
+		if same {
+			fmt.Printf("series %s is unchanged since its last load into %s, skipped\n", j.seriesId, j.table)
+			j.emit(event{Event: "skipped"})
+			j.skipped = true
+			return nil
+		}
+	}
+	if ls.metaTable() != "" {
+		if e := execDDL(metaDDL(ls.metaTable(), j.tc), con); e != nil {
+			return e
+		}
+	}
+	// rejected observations are recorded whether or not the load succeeds
+	if ls.DeadLetter != "" {
+		if e := execDDL(deadLetterDDL(ls.DeadLetter), con); e != nil {
+			return e
+		}
+		j.rejects = &deadLetter{}
+		defer func() {
+			if e := j.rejects.flush(ls.DeadLetter, j.table, con); e != nil {
+				fmt.Println(e)
+			}
+		}()
+	}
+	if ls.Dictionary != "" {
+		if e := execDDL(dictionaryDDL(ls.Dictionary, ls.metaTable(), acct.User, acct.Password, j.tc), con); e != nil {
+			return e
+		}
+	}
+
+	// the lock keeps other runs from writing the table at the same time
+	if ls.LockTable != "" && !j.locked {
+		if e := execDDL(lockDDL(ls.LockTable), con); e != nil {
+			return e
+		}
+		lock, e := acquireLock(ls.LockTable, j.table, con)
+		if e != nil {
+			return e
+		}
+		defer func() {
+			if e := lock.release(); e != nil {
+				fmt.Println(e)
+			}
+		}()
+	}
+
+	if e := prepareMode(ls.mode(), j, con); e != nil {
+		return e
+	}
+	// every vintage is current during the period from the first vintage on
+	if ls.Vintages {
+		vintages, e := fred.GetVintageDates(j.seriesId, acct.API)
+		if e != nil {
+			return e
+		}
+		if len(vintages) == 0 {
+			return fmt.Errorf("series %s has no vintages", j.seriesId)
+		}
+		j.opts.RealtimeStart, j.opts.RealtimeEnd = vintages[0], fred.RealtimeForever
+		fmt.Printf("series %s has %d vintages, from %s\n", j.seriesId, len(vintages),
+			vintages[0].Format(fred.DateFormat))
+	}
+	load := loadSeries
+	if ls.Latest != "" {
+		if e := execDDL(latestDDL(j.table, j.tc), con); e != nil {
+			return e
+		}
+		load = loadLatest
+	}
+	if e := j.setFrequency(acct.API); e != nil {
+		return e
+	}
+	m := startMeter(j)
+	stats, e := load(j, acct.API, con)
+	j.usage = m.stop(j)
+	if e != nil {
+		return e
+	}
+	rows, j.stats = stats.rows, stats
+	j.usage.report(j.seriesId)
+	if e := warnGaps(j, stats); e != nil {
+		return e
+	}
+	j.warns.summary(j.seriesId)
+	if ls.Registry != "" {
+		if e := registerLoad(ls.Registry, j, stats, con); e != nil {
+			return e
+		}
+	}
+	// Fred II has no metadata for derived series
+	if ls.metaTable() != "" && j.formula == nil {
+		if e := loadMeta(j.seriesId, acct.API, ls.metaTable(), con); e != nil {
+			return e
+		}
+	}
+	if ls.Dictionary != "" {
+		if e := reloadDictionary(ls.Dictionary, con); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// setFrequency sets the frequency of the job's observations if the table has period-end dates, which depend on it.
+// It's the frequency Fred II aggregates the series to, if any, otherwise that of the series.
+func (j *job) setFrequency(apiKey string) error {
+	if j.tc.periodEnd == "" {
+		return nil
+	}
+	if j.opts != nil && j.opts.Frequency != "" {
+		j.frequency = strings.ToUpper(j.opts.Frequency)
+		return nil
+	}
+	// a derived series has the frequency of the series it comes from
+	freqSeries := j.seriesId
+	if j.formula != nil {
+		freqSeries = j.formula.Series[0]
+	}
+	info, e := fred.GetInfo(freqSeries, apiKey)
+	if e != nil {
+		return e
+	}
+	j.frequency = info.FrequencyShort
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/invertedv/fred2ch/fred"
+	"testing"
+)
+
+func TestShape(t *testing.T) {
+	ls := defaultLoadSpec()
+	ls.Series, ls.Table, ls.Registry, ls.Batch = "GDP", "t", "reg", 500
+	ls.Date32, ls.PeriodEnd, ls.ZScore, ls.ColValue = true, "add", "full", "v"
+	shape, e := ls.shape()
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := "col-value: v\ndate32: true\nnulls: skip\nperiod-end: add\ntz: UTC\nzscore: full\n"
+	if shape != want {
+		t.Fatalf("shape is\n%swant\n%s", shape, want)
+	}
+	tc, loc, e := shapeConfig(shape)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if tc.dateType != "Date32" || tc.periodEnd != "add" || tc.valueCol != "v" || tc.seriesCol != "seriesId" ||
+		len(tc.enrichments) != 1 || loc.String() != "UTC" {
+		t.Errorf("shape %q gave table config %+v in %s", shape, tc, loc)
+	}
+	empty := loadSpec{Series: "GDP", Table: "t"}
+	if shape, e := empty.shape(); e != nil || shape != "" {
+		t.Errorf("a load setting no shape has shape %q, error %v", shape, e)
+	}
+	if _, _, e := shapeConfig("period-end: middle\n"); e == nil {
+		t.Error("a bad shape wasn't an error")
+	}
+}
+
+func TestPaceRate(t *testing.T) {
+	defer fred.SetPacer(nil)
+	rate := 30
+	for _, tt := range []struct {
+		name string
+		rate *int
+		want int
+	}{
+		{name: "api-per-minute", want: 60},
+		{name: "rate overrides", rate: &rate, want: 30},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			acct := &account{PerMinute: 60, Rate: tt.rate}
+			p, e := acct.pace()
+			if e != nil {
+				t.Fatal(e)
+			}
+			if p.PerMinute != tt.want {
+				t.Errorf("%d requests per minute, want %d", p.PerMinute, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"os"
+	"time"
+)
+
+// lockSpec is the spec of the lock table.  Runs take, refresh and release the lock on a table by inserting rows, so
+// the lock works across machines without mutations: a run holds the lock on a table if it has the oldest unreleased
+// request for it among those refreshed within lockExpiry.  The times are the server's, so the clocks of the
+// machines don't matter.
+var lockSpec = &tableSpec{
+	columns: []column{
+		{name: "table", chType: "String", comment: "table being written"},
+		{name: "owner", chType: "String", comment: "run writing the table: host, process ID and start time"},
+		{name: "time", chType: "DateTime64(3)", comment: "time of the request, refresh or release"},
+		{name: "held", chType: "UInt8", comment: "1 for a request for the lock or a refresh, 0 for a release"},
+	},
+	engine:  "MergeTree()",
+	orderBy: "table, time",
+}
+
+// lockExpiry is how long a lock lasts after its last refresh, if the run holding it dies without releasing it
+const lockExpiry = 10 * time.Minute
+
+// lockRefresh is how often a run refreshes the locks it holds
+const lockRefresh = 2 * time.Minute
+
+// lockDDL returns the statement that creates the lock table, if it doesn't already exist.
+func lockDDL(lockTable string) []string {
+	return []string{lockSpec.createSQL(lockTable, true)}
+}
+
+// tableLock is a lock on a table held by this run
+type tableLock struct {
+	lockTable string
+	table     string
+	owner     string
+	con       *chutils.Connect
+
+	stop chan struct{} // closed to stop the refreshes
+	done chan struct{} // closed once they've stopped
+}
+
+// acquireLock takes the lock on table, recorded in lockTable, and refreshes it every lockRefresh until it's
+// released.  It fails if another run holds the lock.
+func acquireLock(lockTable string, table string, con *chutils.Connect) (*tableLock, error) {
+	host, _ := os.Hostname()
+	l := &tableLock{lockTable: lockTable, table: table, con: con,
+		owner: fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())}
+	if e := l.record(1); e != nil {
+		return nil, e
+	}
+	qry := fmt.Sprintf(`SELECT owner FROM (
+  SELECT owner, min(time) AS since, max(time) AS refreshed, argMax(held, time) AS held
+  FROM %s
+  WHERE table = ?
+  GROUP BY owner)
+WHERE held = 1 AND refreshed > now64(3) - INTERVAL ? SECOND
+ORDER BY since, owner
+LIMIT 1`, lockTable)
+	var holder string
+	if e := con.QueryRow(qry, table, int(lockExpiry.Seconds())).Scan(&holder); e != nil {
+		return nil, e
+	}
+	if holder != l.owner {
+		if e := l.release(); e != nil {
+			return nil, e
+		}
+		return nil, &kindError{kind: ErrLocked, err: fmt.Errorf("table %s is being written by another run (%s)", table,
+			holder)}
+	}
+	l.stop, l.done = make(chan struct{}), make(chan struct{})
+	go l.refresh(lockRefresh, func() error { return l.record(1) })
+	return l, nil
+}
+
+// refresh calls beat every interval until l.stop is closed, so the lock of a long load doesn't expire.  A failed
+// refresh is reported; the next may succeed before the lock expires.
+func (l *tableLock) refresh(interval time.Duration, beat func() error) {
+	defer close(l.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-t.C:
+			if e := beat(); e != nil {
+				fmt.Printf("warning: can't refresh the lock on table %s: %v\n", l.table, e)
+			}
+		}
+	}
+}
+
+// release stops the refreshes and gives up the lock.
+func (l *tableLock) release() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+	return l.record(0)
+}
+
+// record adds a row for the lock to the lock table, at the server's time.
+func (l *tableLock) record(held uint8) error {
+	_, e := l.con.Exec(fmt.Sprintf("INSERT INTO %s VALUES (?, ?, now64(3), ?)", l.lockTable), l.table, l.owner, held)
+	return e
+}
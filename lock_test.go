@@ -0,0 +1,27 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLockRefresh(t *testing.T) {
+	l := &tableLock{table: "t", stop: make(chan struct{}), done: make(chan struct{})}
+	var beats int32
+	go l.refresh(time.Millisecond, func() error {
+		atomic.AddInt32(&beats, 1)
+		return nil
+	})
+	time.Sleep(50 * time.Millisecond)
+	close(l.stop)
+	<-l.done
+	n := atomic.LoadInt32(&beats)
+	if n < 2 {
+		t.Errorf("%d refreshes, want several", n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if after := atomic.LoadInt32(&beats); after != n {
+		t.Errorf("%d refreshes after the lock was released", after-n)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"strings"
+	"time"
+)
+
+// metaSpec returns the spec of the metadata table.  It has one row per series: ReplacingMergeTree keeps the row with
+// the newest updated time.
+func metaSpec(tc *tableConfig) *tableSpec {
+	return &tableSpec{
+		columns: []column{
+			{name: tc.seriesCol, chType: "String", comment: "Fred II series ID"},
+			{name: "title", chType: "String", comment: "series title"},
+			{name: "units", chType: "String", comment: "units of the series"},
+			{name: "frequency", chType: "String", comment: "frequency of the series"},
+			{name: "seasonalAdjustment", chType: "String", comment: "seasonal adjustment of the series"},
+			{name: "lastUpdated", chType: "DateTime", comment: "when Fred II last updated the series"},
+			{name: "observationStart", chType: "String", comment: "first date available"},
+			{name: "observationEnd", chType: "String", comment: "last date available"},
+			{name: "notes", chType: "String", comment: "Fred II notes on the series"},
+			{name: "updated", chType: "DateTime", comment: "time of the refresh"},
+		},
+		engine:  "ReplacingMergeTree(updated)",
+		orderBy: tc.seriesCol,
+	}
+}
+
+// metaDDL returns the statement that creates the metadata table, if it doesn't already exist.
+func metaDDL(table string, tc *tableConfig) []string {
+	return []string{metaSpec(tc).createSQL(table, true)}
+}
+
+// loadMeta pulls the metadata of seriesId from Fred II and records it in the metadata table.
+func loadMeta(seriesId string, apiKey string, table string, con *chutils.Connect) error {
+	info, e := fred.GetInfo(seriesId, apiKey)
+	if e != nil {
+		return e
+	}
+	updated, e := info.Updated()
+	if e != nil {
+		return e
+	}
+	qry := fmt.Sprintf("INSERT INTO %s VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", table)
+	_, e = con.Exec(qry, seriesId, info.Title, info.Units, info.Frequency, info.SeasonalAdjustment, updated,
+		info.ObservationStart, info.ObservationEnd, info.Notes, time.Now())
+	return e
+}
+
+// dictionaryDDL returns the statement that creates a dictionary over the metadata table, keyed by series ID, so
+// queries can use dictGet instead of joining.  user and password are the credentials the dictionary reads with.
+// The dictionary reads the table with FINAL, so it gets the latest row of each series.
+func dictionaryDDL(dict string, metaTable string, user string, password string, tc *tableConfig) []string {
+	cols := make([]string, 0)
+	for _, c := range metaSpec(tc).columns {
+		cols = append(cols, fmt.Sprintf("    %s %s", c.name, c.chType))
+	}
+	source := "QUERY " + quote(fmt.Sprintf("SELECT * FROM %s FINAL", metaTable))
+	if user != "" {
+		source += " USER " + quote(user)
+	}
+	if password != "" {
+		source += " PASSWORD " + quote(password)
+	}
+	return []string{fmt.Sprintf(`CREATE DICTIONARY IF NOT EXISTS %s (
+%s
+)
+PRIMARY KEY %s
+SOURCE(CLICKHOUSE(%s))
+LAYOUT(COMPLEX_KEY_HASHED())
+LIFETIME(MIN 300 MAX 3600)`, dict, strings.Join(cols, ",\n"), tc.seriesCol, source)}
+}
+
+// reloadDictionary makes the dictionary pick up the latest metadata immediately.
+func reloadDictionary(dict string, con *chutils.Connect) error {
+	_, e := con.Exec(fmt.Sprintf("SYSTEM RELOAD DICTIONARY %s", dict))
+	return e
+}
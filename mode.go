@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/chsink"
+	"github.com/invertedv/fred2ch/fred"
+	"strings"
+	"time"
+)
+
+// loadModes are the values of -mode, what a load does with an existing table:
+//   - replace: drops it, or keeps it as a snapshot or backup.  This is the default.
+//   - create: fails with chsink.ErrTableExists
+//   - append: adds the observations after the last date of the series in the table, which must have the columns
+//     the load writes.  Only those observations are requested from Fred II.
+var loadModes = map[string]bool{"replace": true, "create": true, "append": true}
+
+// tableExists returns true if table, which may be qualified by its database, exists.
+func tableExists(table string, con *chutils.Connect) (bool, error) {
+	db, name := splitTable(table)
+	var exists uint64
+	qry := "SELECT count() FROM system.tables WHERE database = if(? = '', currentDatabase(), ?) AND name = ?"
+	if e := con.QueryRow(qry, db, db, name).Scan(&exists); e != nil {
+		return false, e
+	}
+	return exists > 0, nil
+}
+
+// prepareMode readies j to load into its table, if it already exists, as mode asks.  A table created earlier in
+// the run, which j keeps, isn't an existing table to the create mode.
+func prepareMode(mode string, j *job, con *chutils.Connect) error {
+	if mode == "" || mode == "replace" || (mode == "create" && j.keep) {
+		return nil
+	}
+	exists, e := tableExists(j.table, con)
+	if e != nil || !exists {
+		return e
+	}
+	if mode == "create" {
+		return fmt.Errorf("table %s: %w (see -mode)", j.table, chsink.ErrTableExists)
+	}
+	if e := seriesSpec(j.seriesId, j.tc).matches(j.table, con); e != nil {
+		return e
+	}
+	last, e := lastDate(j.seriesId, j.table, j.tc, con)
+	if e != nil {
+		return e
+	}
+	j.keep = true
+	if !last.IsZero() {
+		j.after = last.Format(fred.DateFormat)
+	}
+	return nil
+}
+
+// matches returns an error matching chsink.ErrSchemaMismatch if table lacks a column of the spec or has one with
+// another type.
+func (ts *tableSpec) matches(table string, con *chutils.Connect) error {
+	db, name := splitTable(table)
+	qry := "SELECT name, type FROM system.columns WHERE database = if(? = '', currentDatabase(), ?) AND table = ?"
+	rows, e := con.Query(qry, db, db, name)
+	if e != nil {
+		return e
+	}
+	defer func() { _ = rows.Close() }()
+	types := make(map[string]string)
+	for rows.Next() {
+		var col, chType string
+		if e := rows.Scan(&col, &chType); e != nil {
+			return e
+		}
+		types[col] = chType
+	}
+	if e := rows.Err(); e != nil {
+		return e
+	}
+	for _, c := range ts.columns {
+		chType, ok := types[c.name]
+		switch {
+		case !ok:
+			return fmt.Errorf("table %s has no column %s: %w", table, c.name, chsink.ErrSchemaMismatch)
+		// ClickHouse may space the parameters of a type differently
+		case strings.ReplaceAll(chType, " ", "") != strings.ReplaceAll(c.chType, " ", ""):
+			return fmt.Errorf("column %s of table %s is %s, not %s: %w", c.name, table, chType, c.chType,
+				chsink.ErrSchemaMismatch)
+		}
+	}
+	return nil
+}
+
+// lastDate returns the last date of seriesId in table, the zero time if the table has none of its rows.
+func lastDate(seriesId string, table string, tc *tableConfig, con *chutils.Connect) (time.Time, error) {
+	qry := fmt.Sprintf("SELECT count(), max(%s) FROM %s WHERE %s = ?", tc.dateCol, table, tc.seriesCol)
+	var rows uint64
+	var last time.Time
+	if e := con.QueryRow(qry, seriesId).Scan(&rows, &last); e != nil {
+		return time.Time{}, e
+	}
+	if rows == 0 {
+		return time.Time{}, nil
+	}
+	return last, nil
+}
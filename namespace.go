@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// namespaceRE matches the names allowed for a namespace, which must be usable in table and database names
+var namespaceRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// namespaced returns table within the namespace ns.  A table given with its database goes in the database ns_db,
+// otherwise it's named ns_table.  A blank ns or table is returned as is.
+func namespaced(ns string, table string) string {
+	if ns == "" || table == "" {
+		return table
+	}
+	if db, name := splitTable(table); db != "" {
+		return fmt.Sprintf("%s_%s.%s", ns, db, name)
+	}
+	return ns + "_" + table
+}
+
+// inNamespace puts each of tables, which may be a comma-separated list, within the namespace ns.
+func inNamespace(ns string, tables ...*string) error {
+	if ns == "" {
+		return nil
+	}
+	if !namespaceRE.MatchString(ns) {
+		return fmt.Errorf("-namespace must be letters, digits and underscores, starting with a letter, not %s", ns)
+	}
+	for _, t := range tables {
+		if *t == "" {
+			continue
+		}
+		names := strings.Split(*t, ",")
+		for ind, name := range names {
+			names[ind] = namespaced(ns, strings.TrimSpace(name))
+		}
+		*t = strings.Join(names, ",")
+	}
+	return nil
+}
+
+// inNamespace puts the tables the load creates, and the registry it records them in, within the load's namespace.
+// It's called once, when the settings have been read.
+func (ls *loadSpec) inNamespace() error {
+	return inNamespace(ls.Namespace, &ls.Table, &ls.Archive, &ls.Registry, &ls.LockTable, &ls.Latest, &ls.MetaTable,
+		&ls.DeadLetter, &ls.Dictionary, &ls.Fanout)
+}
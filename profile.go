@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling starts the profiling requested on the command line:
+//   - addr: if not empty, serves net/http/pprof at this address (e.g. localhost:6060) for the life of the run
+//   - cpuFile: if not empty, writes a CPU profile to this file
+//   - memFile: if not empty, writes a heap profile to this file when the run finishes
+//
+// The returned function stops the CPU profile and writes the heap profile.  It must be called before exiting.
+func startProfiling(addr string, cpuFile string, memFile string) (stop func(), err error) {
+	if addr != "" {
+		go func() {
+			if e := http.ListenAndServe(addr, nil); e != nil {
+				log.Println(e)
+			}
+		}()
+	}
+	var cpu *os.File
+	if cpuFile != "" {
+		if cpu, err = os.Create(cpuFile); err != nil {
+			return nil, err
+		}
+		if err = pprof.StartCPUProfile(cpu); err != nil {
+			_ = cpu.Close()
+			return nil, err
+		}
+	}
+	stop = func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if e := cpu.Close(); e != nil {
+				fmt.Println(e)
+			}
+		}
+		if memFile != "" {
+			if e := writeHeapProfile(memFile); e != nil {
+				fmt.Println(e)
+			}
+		}
+	}
+	return stop, nil
+}
+
+// writeHeapProfile writes the current heap profile to file.
+func writeHeapProfile(file string) error {
+	f, e := os.Create(file)
+	if e != nil {
+		return e
+	}
+	// get up-to-date statistics
+	runtime.GC()
+	if e := pprof.WriteHeapProfile(f); e != nil {
+		_ = f.Close()
+		return e
+	}
+	return f.Close()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// profilesFile is the file of profiles read if -profiles isn't given, in the home directory
+const profilesFile = ".fred2ch.yaml"
+
+// addFlags defines the flags of the ClickHouse and Fred II settings of acct in fs.  Each flag has the name of
+// the setting in a jobs file.
+func (acct *account) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&acct.Host, "host", "127.0.0.1", "string")
+	fs.StringVar(&acct.User, "user", "", "string")
+	fs.StringVar(&acct.Password, "password", "", "string")
+	fs.StringVar(&acct.API, "api", "", "string")
+	fs.StringVar(&acct.InsertSettings, "insert-settings", "", "string")
+	fs.StringVar(&acct.Compression, "compression", "lz4", "string")
+	fs.StringVar(&acct.SSH, "ssh", "", "string")
+	fs.StringVar(&acct.WaitForDB, "wait-for-db", "", "string")
+	fs.BoolVar(&acct.Secure, "secure", false, "bool")
+	fs.StringVar(&acct.CACert, "ca-cert", "", "string")
+	fs.BoolVar(&acct.InsecureSkipVerify, "insecure-skip-verify", false, "bool")
+	fs.StringVar(&acct.TLSCert, "tls-cert", "", "string")
+	fs.StringVar(&acct.TLSKey, "tls-key", "", "string")
+	fs.StringVar(&acct.Secrets, "secrets", "", "string")
+}
+
+// readProfile returns the account of the profile name in the profiles block of file, a YAML file such as a jobs
+// file.  If file is blank, it's ~/.fred2ch.yaml.
+func readProfile(file string, name string) (*account, error) {
+	if file == "" {
+		home, e := os.UserHomeDir()
+		if e != nil {
+			return nil, e
+		}
+		file = filepath.Join(home, profilesFile)
+	}
+	raw, e := os.ReadFile(file)
+	if e != nil {
+		return nil, e
+	}
+	var profiles struct {
+		Profiles map[string]*account `yaml:"profiles"`
+	}
+	if e := yaml.Unmarshal(raw, &profiles); e != nil {
+		return nil, fmt.Errorf("profiles file %s: %w", file, e)
+	}
+	p, ok := profiles.Profiles[name]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("profiles file %s has no profile %s", file, name)
+	}
+	return p, nil
+}
+
+// applyProfile sets the settings of acct that weren't given as flags, according to set, to those of the profile
+// p that aren't blank.  So flags take precedence over the profile, which takes precedence over the defaults.
+func (acct *account) applyProfile(p *account, set map[string]bool) {
+	dst, src := reflect.ValueOf(acct).Elem(), reflect.ValueOf(p).Elem()
+	for ind := 0; ind < dst.NumField(); ind++ {
+		name, _, _ := strings.Cut(dst.Type().Field(ind).Tag.Get("yaml"), ",")
+		if set[name] || src.Field(ind).IsZero() {
+			continue
+		}
+		dst.Field(ind).Set(src.Field(ind))
+	}
+}
+
+// applyEnv sets the settings of acct that weren't given as flags, according to set, to those of the environment
+// variables FRED_API_KEY, CH_HOST, CH_USER and CH_PASSWORD that aren't blank.  It's applied before a profile and
+// secret, so they take precedence over the environment, which takes precedence over the defaults.
+func (acct *account) applyEnv(set map[string]bool) {
+	env := &account{API: os.Getenv("FRED_API_KEY"), Host: os.Getenv("CH_HOST"), User: os.Getenv("CH_USER"),
+		Password: os.Getenv("CH_PASSWORD")}
+	acct.applyProfile(env, set)
+}
+
+// flagsSet returns the names of the flags of fs given on the command line.
+func flagsSet(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"time"
+)
+
+// recessionSpec is the spec of the recessions table, which has a row for each recession
+var recessionSpec = &tableSpec{
+	columns: []column{
+		{name: "seriesId", chType: "String", comment: "Fred II recession indicator the dates come from"},
+		{name: "start", chType: "Date32", comment: "first day of the recession"},
+		{name: "end", chType: "Date32", comment: "last day of the recession, or of the latest data if ongoing"},
+		{name: "ongoing", chType: "UInt8", comment: "1 if the recession hasn't ended as of the latest data"},
+	},
+	engine:  "MergeTree()",
+	orderBy: "start",
+}
+
+// minDate32 is the earliest date a Date32 column holds
+var minDate32 = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// recession is an interval during which the indicator is 1
+type recession struct {
+	start, end time.Time
+	ongoing    bool
+}
+
+// recessionsCmd loads a 0/1 recession indicator into a table of recession intervals.
+func recessionsCmd(args []string) error {
+	fs := flag.NewFlagSet("recessions", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	seriesPtr := fs.String("series", "USREC", "string")
+	tablePtr := fs.String("table", "", "string")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	if cf.API == "" || *tablePtr == "" {
+		return fmt.Errorf("recessions requires -api and -table")
+	}
+	obs, e := fred.GetObservations(*seriesPtr, cf.API, nil)
+	if e != nil {
+		return diagnose(e, cf.Host)
+	}
+	recs, e := recessions(obs)
+	if e != nil {
+		return e
+	}
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+	if e := loadRecessions(recs, *seriesPtr, *tablePtr, con); e != nil {
+		return diagnose(e, cf.Host)
+	}
+	fmt.Printf("%d recessions loaded into %s\n", len(recs), *tablePtr)
+	return nil
+}
+
+// recessions converts the observations of a 0/1 indicator, in date order, to the intervals where it is 1.
+// Each interval ends on the last day of the period of its last 1.
+func recessions(obs []fred.Observation) ([]recession, error) {
+	spacing := fred.NewSpacing()
+	for _, o := range obs {
+		spacing.Add(o.Date)
+	}
+	freq := spacing.Frequency()
+	var recs []recession
+	var cur *recession
+	for _, o := range obs {
+		if o.Missing {
+			continue
+		}
+		if o.Value == 0 {
+			if cur != nil {
+				recs = append(recs, *cur)
+				cur = nil
+			}
+			continue
+		}
+		end, e := fred.PeriodEnd(o.Date, freq)
+		if e != nil {
+			return nil, e
+		}
+		if cur == nil {
+			cur = &recession{start: o.Date}
+		}
+		cur.end = end
+	}
+	if cur != nil {
+		cur.ongoing = true
+		recs = append(recs, *cur)
+	}
+	return recs, nil
+}
+
+// loadRecessions replaces table with the recessions.  Recessions ending before a Date32 can hold are skipped.
+func loadRecessions(recs []recession, seriesId string, table string, con *chutils.Connect) error {
+	ddl := []string{fmt.Sprintf("DROP TABLE IF EXISTS %s", table), recessionSpec.createSQL(table, false)}
+	if e := execDDL(ddl, con); e != nil {
+		return e
+	}
+	qry := recessionSpec.insertSQL(table)
+	for _, r := range recs {
+		if r.end.Before(minDate32) {
+			continue
+		}
+		if r.start.Before(minDate32) {
+			r.start = minDate32
+		}
+		ongoing := uint8(0)
+		if r.ongoing {
+			ongoing = 1
+		}
+		if _, e := con.Exec(qry, seriesId, r.start, r.end, ongoing); e != nil {
+			return e
+		}
+	}
+	return nil
+}
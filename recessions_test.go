@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/invertedv/fred2ch/fred"
+	"testing"
+	"time"
+)
+
+func TestRecessions(t *testing.T) {
+	date := func(s string) time.Time {
+		d, e := time.Parse(fred.DateFormat, s)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return d
+	}
+	type want struct {
+		start, end string
+		ongoing    bool
+	}
+	for _, tt := range []struct {
+		name   string
+		dates  []string
+		values []float64
+		recs   []want
+		err    bool
+	}{
+		{name: "none", dates: []string{"2020-01-01", "2020-02-01", "2020-03-01"}, values: []float64{0, 0, 0}},
+		{name: "monthly", dates: []string{"2020-01-01", "2020-02-01", "2020-03-01", "2020-04-01", "2020-05-01",
+			"2020-06-01", "2020-07-01", "2020-08-01"}, values: []float64{0, 1, 1, 0, 0, 1, 0, 0},
+			recs: []want{{"2020-02-01", "2020-03-31", false}, {"2020-06-01", "2020-06-30", false}}},
+		{name: "ongoing", dates: []string{"2020-01-01", "2020-02-01", "2020-03-01", "2020-04-01"},
+			values: []float64{0, 0, 1, 1}, recs: []want{{"2020-03-01", "2020-04-30", true}}},
+		{name: "quarterly", dates: []string{"2019-10-01", "2020-01-01", "2020-04-01", "2020-07-01"},
+			values: []float64{1, 1, 0, 0}, recs: []want{{"2019-10-01", "2020-03-31", false}}},
+		{name: "daily", dates: []string{"2020-03-01", "2020-03-02", "2020-03-03", "2020-03-04"},
+			values: []float64{0, 1, 1, 0}, recs: []want{{"2020-03-02", "2020-03-03", false}}},
+		{name: "unknown frequency", dates: []string{"2020-01-01"}, values: []float64{1}, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var obs []fred.Observation
+			for ind, d := range tt.dates {
+				obs = append(obs, fred.Observation{Date: date(d), Value: tt.values[ind]})
+			}
+			recs, e := recessions(obs)
+			if tt.err {
+				if e == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if e != nil {
+				t.Fatal(e)
+			}
+			if len(recs) != len(tt.recs) {
+				t.Fatalf("%d recessions, want %d", len(recs), len(tt.recs))
+			}
+			for ind, r := range recs {
+				w := tt.recs[ind]
+				if r.start.Format(fred.DateFormat) != w.start || r.end.Format(fred.DateFormat) != w.end ||
+					r.ongoing != w.ongoing {
+					t.Errorf("recession %d is %s to %s (ongoing %v), want %s to %s (ongoing %v)", ind,
+						r.start.Format(fred.DateFormat), r.end.Format(fred.DateFormat), r.ongoing, w.start, w.end,
+						w.ongoing)
+				}
+			}
+		})
+	}
+}
+
+func TestRecessionsSkipsMissing(t *testing.T) {
+	var obs []fred.Observation
+	for ind, v := range []float64{0, 1, 0, 1, 0} {
+		obs = append(obs, fred.Observation{Date: time.Date(2020, time.Month(ind+1), 1, 0, 0, 0, 0, time.UTC),
+			Value: v, Missing: ind == 2})
+	}
+	recs, e := recessions(obs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// the missing month doesn't end the recession
+	if len(recs) != 1 || recs[0].end.Format(fred.DateFormat) != "2020-04-30" {
+		t.Errorf("recessions %v, want one from 2020-02-01 to 2020-04-30", recs)
+	}
+}
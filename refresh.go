@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"net/url"
+)
+
+// refreshCmd reloads the series in the registry that Fred II has updated since their latest load.
+func refreshCmd(args []string) error {
+	fs := flag.NewFlagSet("refresh", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	tf := addTableFlags(fs)
+	registryPtr := fs.String("registry", "", "string")
+	tablePtr := fs.String("table", "", "string")
+	batchPtr := fs.Int("batch", defaultBatch, "int")
+	lockTablePtr := fs.String("lock-table", "", "string")
+	namespacePtr := fs.String("namespace", "", "string")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := inNamespace(*namespacePtr, registryPtr, tablePtr, lockTablePtr); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	if cf.API == "" || *registryPtr == "" {
+		return fmt.Errorf("refresh requires -api and -registry")
+	}
+	tc, e := tf.config()
+	if e != nil {
+		return e
+	}
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+	if *lockTablePtr != "" {
+		if e := execDDL(lockDDL(*lockTablePtr), con); e != nil {
+			return diagnose(e, cf.Host)
+		}
+	}
+	// registries older than the shape column get it
+	if e := execDDL(registryDDL(*registryPtr), con); e != nil {
+		return diagnose(e, cf.Host)
+	}
+	listings, e := loadedSeries(*registryPtr, *tablePtr, con)
+	if e != nil {
+		return diagnose(e, cf.Host)
+	}
+	reloaded := 0
+	for _, l := range listings {
+		j, e := registeredJob(l, *batchPtr, tc)
+		if e != nil {
+			return e
+		}
+		stale, e := isStale(l, j, cf.API)
+		if e != nil {
+			return diagnose(e, cf.Host)
+		}
+		if !stale {
+			continue
+		}
+		fmt.Printf("reloading series %s into %s\n", l.seriesId, l.table)
+		if e := reload(j, cf.API, *registryPtr, *lockTablePtr, con); e != nil {
+			return diagnose(e, cf.Host)
+		}
+		reloaded++
+	}
+	fmt.Printf("%d of %d series reloaded\n", reloaded, len(listings))
+	return nil
+}
+
+// registeredJob returns the job that repeats the load recorded in l.  The table is kept, since it may hold other
+// series, and the rows of the series in it are replaced.  They are written in the shape recorded in l; tc, from the
+// flags, is the shape of loads recorded before the registry had it.
+func registeredJob(l *listing, batchSize int, tc *tableConfig) (*job, error) {
+	q, e := url.ParseQuery(l.query)
+	if e != nil {
+		return nil, e
+	}
+	opts, e := fred.ParseQuery(q)
+	if e != nil {
+		return nil, e
+	}
+	if l.shape != "" {
+		if tc, opts.Location, e = shapeConfig(l.shape); e != nil {
+			return nil, e
+		}
+	}
+	j := &job{seriesId: l.seriesId, table: l.table, batchSize: batchSize, tc: tc, opts: opts, keep: true,
+		replace: true, shape: l.shape}
+	if l.provenance != "" {
+		if j.formula, e = fred.ParseFormula(l.provenance); e != nil {
+			return nil, e
+		}
+	}
+	return j, nil
+}
+
+// isStale returns true if Fred II has updated the series of l, or any series it is derived from, since l was
+// loaded.
+func isStale(l *listing, j *job, apiKey string) (bool, error) {
+	ids := []string{j.seriesId}
+	if j.formula != nil {
+		ids = j.formula.Series
+	}
+	for _, id := range ids {
+		info, e := fred.GetInfo(id, apiKey)
+		if e != nil {
+			return false, e
+		}
+		updated, e := info.Updated()
+		if e != nil {
+			return false, e
+		}
+		if updated.After(l.loaded) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reload repeats the load of the job and records it in the registry.  Latest-readings tables, which are
+// ReplacingMergeTrees, get the latest reading rather than the whole series.  If lockTable isn't blank, the table
+// is locked while it's reloaded.
+func reload(j *job, apiKey string, registry string, lockTable string, con *chutils.Connect) error {
+	if lockTable != "" {
+		lock, e := acquireLock(lockTable, j.table, con)
+		if e != nil {
+			return e
+		}
+		defer func() {
+			if e := lock.release(); e != nil {
+				fmt.Println(e)
+			}
+		}()
+	}
+	engine, e := tableEngine(j.table, con)
+	if e != nil {
+		return e
+	}
+	load := loadSeries
+	if engine == "ReplacingMergeTree" {
+		load = loadLatest
+	}
+	if e := j.setFrequency(apiKey); e != nil {
+		return e
+	}
+	m := startMeter(j)
+	stats, e := load(j, apiKey, con)
+	j.usage = m.stop(j)
+	if e != nil {
+		return e
+	}
+	if e := warnGaps(j, stats); e != nil {
+		return e
+	}
+	return registerLoad(registry, j, stats, con)
+}
+
+// tableEngine returns the engine of table, which may be qualified by its database.
+func tableEngine(table string, con *chutils.Connect) (string, error) {
+	db, name := splitTable(table)
+	qry := "SELECT engine FROM system.tables WHERE database = if(? = '', currentDatabase(), ?) AND name = ?"
+	row := con.QueryRow(qry, db, db, name)
+	var engine string
+	if e := row.Scan(&engine); e != nil {
+		return "", fmt.Errorf("table %s: %w", table, e)
+	}
+	return engine, nil
+}
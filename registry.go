@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/chsink"
+	"time"
+)
+
+// registrySpec is the spec of the registry table.  The registry has a row for every load, including the Fred II
+// query parameters used, so loads of the same series with different transformations can be told apart.
+var registrySpec = &tableSpec{
+	columns: []column{
+		{name: "table", chType: "String", comment: "destination table"},
+		{name: "seriesId", chType: "String", comment: "Fred II series ID"},
+		{name: "loaded", chType: "DateTime", comment: "time of the load"},
+		{name: "rows", chType: "UInt64", comment: "rows loaded"},
+		{name: "minDate", chType: "Date", comment: "first date loaded"},
+		{name: "maxDate", chType: "Date", comment: "last date loaded"},
+		{name: "units", chType: "String", comment: "units transformation requested, blank for Fred II default"},
+		{name: "frequency", chType: "String", comment: "frequency requested, blank for Fred II default"},
+		{name: "aggregation", chType: "String", comment: "aggregation method requested, blank for Fred II default"},
+		{name: "realtimeStart", chType: "String",
+			comment: "start of real-time period requested, blank for Fred II default"},
+		{name: "realtimeEnd", chType: "String",
+			comment: "end of real-time period requested, blank for Fred II default"},
+		{name: "query", chType: "String", comment: "full query sent to Fred II, without the API key"},
+		{name: "detectedFrequency", chType: "String", comment: "frequency detected from the dates, blank if unknown"},
+		{name: "provenance", chType: "String", comment: "formula deriving the series, blank if loaded from Fred II"},
+		{name: "apiRequests", chType: "UInt64", comment: "Fred II requests made by the load"},
+		{name: "downloaded", chType: "UInt64", comment: "bytes of Fred II responses"},
+		{name: "peakHeap", chType: "UInt64", comment: "most bytes of heap in use during the load"},
+		{name: "written", chType: "UInt64", comment: "bytes of rows sent to ClickHouse"},
+		{name: "shape", chType: "String", comment: "settings shaping the table and its rows, as YAML"},
+	},
+	engine:  "MergeTree()",
+	orderBy: "table, seriesId, loaded",
+}
+
+// registryAdded is the number of registry columns added after the first release, which existing registries
+// may lack
+const registryAdded = 7
+
+// registryDDL returns the statements that create the registry table, if it doesn't already exist, and add any
+// columns an older registry lacks.
+func registryDDL(registry string) []string {
+	return append([]string{registrySpec.createSQL(registry, true)},
+		registrySpec.addColumnsSQL(registry, registryAdded)...)
+}
+
+// unchanged returns true if the registry records a load of the job's series into its table with the same query,
+// and Fred II hasn't updated the series, or any series it is derived from, since.
+func unchanged(registry string, j *job, apiKey string, con *chutils.Connect) (bool, error) {
+	listings, e := loadedSeries(registry, j.table, con)
+	if e != nil {
+		return false, e
+	}
+	provenance := ""
+	if j.formula != nil {
+		provenance = j.formula.String()
+	}
+	for _, l := range listings {
+		if l.seriesId != j.seriesId {
+			continue
+		}
+		if l.query != j.opts.Query(j.seriesId).Encode() || l.provenance != provenance {
+			return false, nil
+		}
+		stale, e := isStale(l, j, apiKey)
+		return !stale, e
+	}
+	return false, nil
+}
+
+// registerLoad records the load of the job in the registry.
+func registerLoad(registry string, j *job, stats *loadStats, con *chutils.Connect) error {
+	q := j.opts.Query(j.seriesId)
+	provenance := ""
+	if j.formula != nil {
+		provenance = j.formula.String()
+	}
+	_, e := con.Exec(registrySpec.insertSQL(registry), j.table, j.seriesId, time.Now(), uint64(stats.rows),
+		stats.minDate, stats.maxDate, q.Get("units"), q.Get("frequency"), q.Get("aggregation_method"),
+		q.Get("realtime_start"), q.Get("realtime_end"), q.Encode(), stats.frequency, provenance,
+		uint64(j.usage.requests), uint64(j.usage.downloaded), j.usage.peakHeap, uint64(j.usage.written),
+		j.shape)
+	return chsink.Classify(e)
+}
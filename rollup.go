@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rollupPeriods maps each -rollup period to the function that truncates a date to the start of the period
+var rollupPeriods = map[string]string{
+	"monthly":   "toStartOfMonth",
+	"quarterly": "toStartOfQuarter",
+	"annual":    "toStartOfYear",
+}
+
+// rollupEngines are the engines of the aggregate tables selected with -rollup-engine
+var rollupEngines = map[string]bool{"aggregating": true, "summing": true}
+
+// parseRollups splits the comma-separated -rollup list, checking each period is supported.
+func parseRollups(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var periods []string
+	for _, period := range strings.Split(list, ",") {
+		period = strings.ToLower(strings.TrimSpace(period))
+		if _, ok := rollupPeriods[period]; !ok {
+			return nil, fmt.Errorf("unknown rollup period %s, must be monthly, quarterly or annual", period)
+		}
+		periods = append(periods, period)
+	}
+	return periods, nil
+}
+
+// rollupTable returns the name of the aggregate table for period.
+func rollupTable(table string, period string) string {
+	return fmt.Sprintf("%s_%s", table, period)
+}
+
+// rollupView returns the name of the materialized view that feeds the aggregate table for period.
+func rollupView(table string, period string) string {
+	return rollupTable(table, period) + "_mv"
+}
+
+// rollupSpec returns the spec of the aggregate table for period.  An AggregatingMergeTree table's value columns
+// hold aggregate states, so queries use the -Merge combinators, e.g. avgMerge(avg).  The state of last is keyed by
+// the series table's dates, of its date type, while the period is a Date whatever the date type.  A
+// SummingMergeTree table's value columns hold plain values which merges combine, so queries just aggregate them
+// again, e.g. sum(sum).
+func rollupSpec(period string, tc *tableConfig) *tableSpec {
+	if tc.rollupEngine == "summing" {
+		return summingSpec(period, tc)
+	}
+	state := func(fn string) string {
+		return fmt.Sprintf("AggregateFunction(%s, %s)", fn, tc.valueType)
+	}
+	return &tableSpec{
+		columns: []column{
+			{name: tc.seriesCol, chType: "String", comment: "Fred II series ID"},
+			{name: tc.dateCol, chType: "Date", comment: fmt.Sprintf("start of %s period", period)},
+			{name: "avg", chType: state("avg"), comment: "average value over the period"},
+			{name: "min", chType: state("min"), comment: "minimum value over the period"},
+			{name: "max", chType: state("max"), comment: "maximum value over the period"},
+			{name: "sum", chType: state("sum"), comment: "sum of the values over the period"},
+			{name: "last", chType: fmt.Sprintf("AggregateFunction(argMax, %s, %s)", tc.valueType, tc.dateType),
+				comment: "last value in the period"},
+			{name: "count", chType: "AggregateFunction(count)", comment: "number of observations in the period"},
+		},
+		engine:  "AggregatingMergeTree()",
+		orderBy: fmt.Sprintf("%s, %s", tc.seriesCol, tc.dateCol),
+	}
+}
+
+// summingSpec returns the spec of the SummingMergeTree aggregate table for period.  sum and count are summed
+// when parts merge, min and max are kept as SimpleAggregateFunction columns so merges take their min and max.
+func summingSpec(period string, tc *tableConfig) *tableSpec {
+	simple := func(fn string) string {
+		return fmt.Sprintf("SimpleAggregateFunction(%s, %s)", fn, tc.valueType)
+	}
+	return &tableSpec{
+		columns: []column{
+			{name: tc.seriesCol, chType: "String", comment: "Fred II series ID"},
+			{name: tc.dateCol, chType: "Date", comment: fmt.Sprintf("start of %s period", period)},
+			{name: "sum", chType: "Float64", comment: "sum of the values over the period"},
+			{name: "count", chType: "UInt64", comment: "number of observations in the period"},
+			{name: "min", chType: simple("min"), comment: "minimum value over the period"},
+			{name: "max", chType: simple("max"), comment: "maximum value over the period"},
+		},
+		engine:  "SummingMergeTree((sum, count))",
+		orderBy: fmt.Sprintf("%s, %s", tc.seriesCol, tc.dateCol),
+	}
+}
+
+// rollupViewSQL returns the statement that creates the materialized view feeding the aggregate table for period from
+// the series table.  The subquery renames the date column so the period alias doesn't shadow it.
+func rollupViewSQL(table string, period string, tc *tableConfig) string {
+	if tc.rollupEngine == "summing" {
+		return fmt.Sprintf(`CREATE MATERIALIZED VIEW %[1]s TO %[2]s AS
+SELECT
+    %[3]s,
+    %[4]s(obsDate) AS %[5]s,
+    sum(%[6]s) AS sum,
+    count() AS count,
+    min(%[6]s) AS min,
+    max(%[6]s) AS max
+FROM (SELECT %[3]s, %[5]s AS obsDate, %[6]s FROM %[7]s)
+GROUP BY %[3]s, %[5]s`, rollupView(table, period), rollupTable(table, period), tc.seriesCol,
+			rollupPeriods[period], tc.dateCol, tc.valueCol, table)
+	}
+	return fmt.Sprintf(`CREATE MATERIALIZED VIEW %[1]s TO %[2]s AS
+SELECT
+    %[3]s,
+    %[4]s(obsDate) AS %[5]s,
+    avgState(%[6]s) AS avg,
+    minState(%[6]s) AS min,
+    maxState(%[6]s) AS max,
+    sumState(%[6]s) AS sum,
+    argMaxState(%[6]s, obsDate) AS last,
+    countState() AS count
+FROM (SELECT %[3]s, %[5]s AS obsDate, %[6]s FROM %[7]s)
+GROUP BY %[3]s, %[5]s`, rollupView(table, period), rollupTable(table, period), tc.seriesCol, rollupPeriods[period],
+		tc.dateCol, tc.valueCol, table)
+}
+
+// rollupDrops returns the statements that drop the rollups of table.  They must run before the table is dropped.
+func rollupDrops(table string, tc *tableConfig) []string {
+	var ddl []string
+	for _, period := range tc.rollups {
+		ddl = append(ddl, fmt.Sprintf("DROP TABLE IF EXISTS %s", rollupView(table, period)),
+			fmt.Sprintf("DROP TABLE IF EXISTS %s", rollupTable(table, period)))
+	}
+	return ddl
+}
+
+// rollupCreates returns the statements that create the rollups of table.  They must run after the table is created.
+func rollupCreates(table string, tc *tableConfig) []string {
+	var ddl []string
+	for _, period := range tc.rollups {
+		ddl = append(ddl, rollupSpec(period, tc).createSQL(rollupTable(table, period), false),
+			rollupViewSQL(table, period, tc))
+	}
+	return ddl
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"gopkg.in/yaml.v3"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// jobsFile is a jobs file: the access shared by its jobs, the variables referred to in the file, the settings
+// shared by the jobs and the jobs
+type jobsFile struct {
+	account  `yaml:",inline"`
+	Vars     map[string]string `yaml:"vars"`
+	Defaults loadSpec          `yaml:"defaults"`
+	Jobs     []*jobSpec        `yaml:"jobs"`
+	Events   string            `yaml:"events"` // where lifecycle events go, blank to discard them
+
+	Profiles map[string]*account `yaml:"profiles"` // accounts that can be chosen with -profile
+
+	events *eventSink // opened Events
+}
+
+// jobSpec is a job of a jobs file: a load with a name and, optionally, a schedule
+type jobSpec struct {
+	Name     string `yaml:"name"`     // name used in messages, the table if blank
+	Schedule string `yaml:"schedule"` // interval between runs, as a Go duration (e.g. 24h), blank to run once
+	loadSpec `yaml:",inline"`
+
+	every time.Duration // parsed Schedule
+}
+
+// key identifies the job across reloads of the jobs file.
+func (js *jobSpec) key() string {
+	return strings.Join([]string{js.label(), seriesID(js.Series), js.Formula}, "\x00")
+}
+
+// label returns the name of the job used in messages.
+func (js *jobSpec) label() string {
+	if js.Name != "" {
+		return js.Name
+	}
+	if js.Latest != "" {
+		return js.Latest
+	}
+	return js.Table
+}
+
+// readJobs reads and checks the jobs file.  vars sets variables of the file, overriding its vars block.  If profile
+// isn't blank, the settings of that profile of the file override those at the top of the file.
+func readJobs(file string, vars map[string]string, profile string) (*jobsFile, error) {
+	raw, e := os.ReadFile(file)
+	if e != nil {
+		return nil, e
+	}
+	text, e := expandJobs(string(raw), vars)
+	if e != nil {
+		return nil, fmt.Errorf("jobs file %s: %w", file, e)
+	}
+	// settings not given in the file take the defaults the flags have
+	jf := &jobsFile{Defaults: defaultLoadSpec()}
+	jf.PerMinute, jf.MaxRetries = defaultPerMinute, defaultMaxRetries
+	// the environment supplies the key and credentials the file leaves out
+	jf.applyEnv(nil)
+	// a misspelled setting is an error, not silently ignored
+	dec := yaml.NewDecoder(strings.NewReader(text))
+	dec.KnownFields(true)
+	if e := dec.Decode(jf); e != nil {
+		return nil, fmt.Errorf("jobs file %s: %w", file, e)
+	}
+	// decode the jobs again, each over the defaults, so a job's settings override them
+	var nodes struct {
+		Jobs []yaml.Node `yaml:"jobs"`
+	}
+	if e := yaml.Unmarshal([]byte(text), &nodes); e != nil {
+		return nil, fmt.Errorf("jobs file %s: %w", file, e)
+	}
+	for ind := range nodes.Jobs {
+		js := &jobSpec{loadSpec: jf.Defaults}
+		if e := nodes.Jobs[ind].Decode(js); e != nil {
+			return nil, fmt.Errorf("jobs file %s: %w", file, e)
+		}
+		jf.Jobs[ind] = js
+	}
+	if profile != "" {
+		p, ok := jf.Profiles[profile]
+		if !ok || p == nil {
+			return nil, fmt.Errorf("jobs file %s has no profile %s", file, profile)
+		}
+		jf.applyProfile(p, nil)
+	}
+	if e := jf.applySecrets(nil); e != nil {
+		return nil, fmt.Errorf("jobs file %s: %w", file, e)
+	}
+	if jf.Host == "" {
+		jf.Host = "127.0.0.1"
+	}
+	if jf.API == "" {
+		return nil, fmt.Errorf("jobs file %s has no api key", file)
+	}
+	if len(jf.Jobs) == 0 {
+		return nil, fmt.Errorf("jobs file %s has no jobs", file)
+	}
+	for ind, js := range jf.Jobs {
+		if e := js.inNamespace(); e != nil {
+			return nil, fmt.Errorf("job %d (%s): %w", ind+1, js.label(), e)
+		}
+		// check the job now, rather than when it comes to run
+		if _, e := js.job(); e != nil {
+			return nil, fmt.Errorf("job %d (%s): %w", ind+1, js.label(), e)
+		}
+		if js.shared() {
+			return nil, fmt.Errorf("job %d (%s): a job loads one series, not a list, release or category", ind+1,
+				js.label())
+		}
+		if js.Schedule == "" {
+			continue
+		}
+		if js.every, e = time.ParseDuration(js.Schedule); e != nil || js.every <= 0 {
+			return nil, fmt.Errorf("job %d (%s): bad schedule %q", ind+1, js.label(), js.Schedule)
+		}
+	}
+	return jf, nil
+}
+
+// runSettings are the settings of a run of a jobs file
+type runSettings struct {
+	jobs      string            // the jobs file
+	vars      map[string]string // variables of the file, overriding its vars block
+	profile   string            // profile of the file whose settings are used, none if blank
+	once      bool              // if true, every job runs once, whatever its schedule
+	debugHTTP bool              // if true, Fred II requests and responses are logged to stderr
+	color     bool              // if true, the summary tables are colored
+	breaker   *fred.Breaker     // the job runs go through it, so once it trips the rest pause or fail untried
+}
+
+// runCmd runs the jobs of a jobs file.  Jobs without a schedule run once, the others repeatedly.
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	vars := varFlag{}
+	rs := runSettings{vars: vars}
+	fs.StringVar(&rs.jobs, "jobs", "", "string")
+	fs.BoolVar(&rs.once, "once", false, "bool")
+	fs.BoolVar(&rs.debugHTTP, "debug-http", false, "bool")
+	fs.BoolVar(&rs.color, "color", false, "bool")
+	fs.StringVar(&rs.profile, "profile", "", "string")
+	fs.Var(vars, "var", "string")
+	breakerPtr := fs.Int("breaker", 0, "int")
+	cooldownPtr := fs.String("breaker-cooldown", "", "string")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if rs.jobs == "" {
+		return fmt.Errorf("run requires -jobs")
+	}
+	var e error
+	if rs.breaker, e = newBreaker(*breakerPtr, *cooldownPtr); e != nil {
+		return e
+	}
+	return runJobs(&rs)
+}
+
+// runJobs runs the jobs of the jobs file of rs.  Jobs without a schedule run once, the others repeatedly unless
+// rs.once is set.
+func runJobs(rs *runSettings) error {
+	jf, e := readJobs(rs.jobs, rs.vars, rs.profile)
+	if e != nil {
+		return e
+	}
+	con, e := connect(&jf.account)
+	if e != nil {
+		return diagnose(e, jf.Host)
+	}
+	defer closeConnect(con)
+	if jf.events, e = openEvents(jf.Events); e != nil {
+		return e
+	}
+	defer jf.events.close()
+	if rs.debugHTTP {
+		fred.SetDebug(os.Stderr)
+	}
+	if e := jf.fredTLS(); e != nil {
+		return e
+	}
+	pacer, e := jf.pace()
+	if e != nil {
+		return e
+	}
+
+	// due is when each job next runs, the zero time once it's finished
+	due := make([]time.Time, len(jf.Jobs))
+	now := time.Now()
+	for ind := range due {
+		due[ind] = now
+	}
+	// SIGHUP reloads the jobs file between jobs
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	failed, runs := 0, 0
+	for {
+		flushSpools(jf, con)
+		var next time.Time
+		var outcomes []outcome
+		for ind, js := range jf.Jobs {
+			if due[ind].IsZero() {
+				continue
+			}
+			if due[ind].After(time.Now()) {
+				if next.IsZero() || due[ind].Before(next) {
+					next = due[ind]
+				}
+				continue
+			}
+			start := time.Now()
+			var j *job
+			e := rs.breaker.Do(func() (e error) {
+				j, e = runJob(js, jf, con)
+				return e
+			})
+			if e != nil {
+				fmt.Printf("job %s failed: %v\n", js.label(), diagnose(e, jf.Host))
+				failed++
+			} else {
+				fmt.Printf("job %s finished in %s\n", js.label(), time.Since(start).Round(time.Second))
+			}
+			outcomes = append(outcomes, newOutcome(js.label(), seriesID(js.Series), j, time.Since(start), e))
+			runs++
+			if pacer != nil {
+				reportPace(pacer, runs, pending(due, ind))
+			}
+			due[ind] = time.Time{}
+			if js.every > 0 && !rs.once {
+				due[ind] = start.Add(js.every)
+				if next.IsZero() || due[ind].Before(next) {
+					next = due[ind]
+				}
+			}
+		}
+		// a summary of each round of jobs
+		if len(outcomes) > 0 {
+			printSummary(outcomes, rs.color)
+		}
+		// a tripped breaker that doesn't pause stops the run, rather than failing every job as it comes due
+		if rs.breaker.Open() && rs.breaker.Cooldown == 0 {
+			return fmt.Errorf("%d job runs failed, the last %d in a row (see -breaker)", failed, rs.breaker.Threshold)
+		}
+		if next.IsZero() {
+			break
+		}
+		select {
+		case <-time.After(time.Until(next)):
+		case <-hup:
+			reloaded, e := reloadJobs(jf, rs.jobs, rs.vars, rs.profile)
+			if e != nil {
+				fmt.Printf("jobs file %s not reloaded, keeping the jobs running: %v\n", rs.jobs, e)
+				continue
+			}
+			jf, due = reloaded, reloadedDue(jf, reloaded, due)
+			fmt.Printf("jobs file %s reloaded: %d jobs\n", rs.jobs, len(jf.Jobs))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d job runs failed", failed)
+	}
+	return nil
+}
+
+// reloadJobs reads the jobs file again, checking it as it's read at the start, for the jobs that replace those of
+// jf.  The ClickHouse connection, API key and budgets and the events of jf are kept, since the connection and pacer
+// are already in use.
+func reloadJobs(jf *jobsFile, file string, vars map[string]string, profile string) (*jobsFile, error) {
+	reloaded, e := readJobs(file, vars, profile)
+	if e != nil {
+		return nil, e
+	}
+	reloaded.account, reloaded.events = jf.account, jf.events
+	return reloaded, nil
+}
+
+// reloadedDue returns when each job of reloaded next runs: as before for a job jf had too, at once for a new one.
+func reloadedDue(jf *jobsFile, reloaded *jobsFile, due []time.Time) []time.Time {
+	was := make(map[string]time.Time)
+	for ind, js := range jf.Jobs {
+		was[js.key()] = due[ind]
+	}
+	now := time.Now()
+	next := make([]time.Time, len(reloaded.Jobs))
+	for ind, js := range reloaded.Jobs {
+		d, ok := was[js.key()]
+		switch {
+		case !ok:
+			d = now
+		// a finished job that now has a schedule runs again
+		case d.IsZero() && js.every > 0:
+			d = now
+		}
+		next[ind] = d
+	}
+	return next
+}
+
+// pending returns the number of jobs after the one at ind that are due now.
+func pending(due []time.Time, ind int) int {
+	n := 0
+	now := time.Now()
+	for _, d := range due[ind+1:] {
+		if !d.IsZero() && !d.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// reportPace prints the Fred II requests made so far and, if jobs are waiting to run, when they are projected to
+// be done at the average requests per job run and the pace the budgets allow.
+func reportPace(pacer *fred.Pacer, runs int, remaining int) {
+	calls := pacer.Calls()
+	if remaining == 0 {
+		fmt.Printf("%d Fred II requests made\n", calls)
+		return
+	}
+	done := pacer.Projected(remaining * calls / runs)
+	fmt.Printf("%d Fred II requests made, %d jobs to go, projected to finish at %s\n", calls, remaining,
+		done.Format("2006-01-02 15:04:05"))
+}
+
+// flushSpools flushes the spool directories of the jobs of jf, so rows spooled while ClickHouse was unavailable
+// are loaded once it's back.  A failure is printed rather than returned: the spool is tried again next round.
+func flushSpools(jf *jobsFile, con *chutils.Connect) {
+	flushed := make(map[string]bool)
+	for _, js := range jf.Jobs {
+		if js.Spool == "" || flushed[js.Spool] {
+			continue
+		}
+		flushed[js.Spool] = true
+		if e := flushSpool(js.Spool, con); e != nil {
+			fmt.Printf("spool %s not flushed: %v\n", js.Spool, diagnose(e, jf.Host))
+		}
+	}
+}
+
+// runJob runs a single job of the jobs file.  It returns the job, which is nil if it couldn't be set up.
+func runJob(js *jobSpec, jf *jobsFile, con *chutils.Connect) (*job, error) {
+	j, e := js.job()
+	if e != nil {
+		return nil, e
+	}
+	j.events = jf.events
+	return j, runLoad(&js.loadSpec, j, &jf.account, con)
+}
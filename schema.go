@@ -0,0 +1,482 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/chsink"
+	"github.com/invertedv/fred2ch/fred"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// periodEndCol is the name of the period-end date column
+const periodEndCol = "periodEnd"
+
+// realtimeStartCol and realtimeEndCol are the names of the columns holding the real-time period of each value
+const (
+	realtimeStartCol = "realtime_start"
+	realtimeEndCol   = "realtime_end"
+)
+
+// maxCHDate is the last date the ClickHouse Date type can hold.  Values still current, whose real-time period ends
+// on fred.RealtimeForever, end on it instead.
+var maxCHDate = time.Date(2149, 6, 6, 0, 0, 0, 0, time.UTC)
+
+// identifier matches legal unquoted ClickHouse identifiers
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tableConfig holds the options that shape the series table
+type tableConfig struct {
+	seriesCol string   // name of the series ID column
+	dateCol   string   // name of the date column
+	valueCol  string   // name of the value column
+	dateType  string   // ClickHouse type of the date column
+	valueType string   // ClickHouse type of the value column
+	bySeries  bool     // if true, the table is ordered by series then date, rather than just date
+	periodEnd string   // "add" for a period-end date column, "replace" to store period-end dates in dateCol
+	detectInt bool     // if true, valueType becomes an integer type when all the values are integers
+	rollups   []string // periods to maintain aggregates for
+	buffer    bool     // if true, inserts go through a Buffer table in front of the table
+
+	rollupEngine string // engine of the aggregate tables: aggregating or summing
+	dateIndex    bool   // if true, the table has a minmax skip index on the date column
+	seriesIndex  bool   // if true, the table has a bloom_filter skip index on the series column
+
+	projection []string // columns ordering a projection of the table, none if empty
+	fanout     []string // tables fed from the table, which is then a Null-engine landing table, by views
+	snapshots  int      // if positive, the table is renamed rather than dropped, and this many such snapshots kept
+	backupDays int      // if positive, the table is renamed rather than dropped, and kept this many days
+
+	cluster     string // cluster the table is created on, none if blank
+	distributed bool   // if true, the table is a Distributed table over a local table on each shard of cluster
+
+	enrichments []enrichment // extra columns computed from the whole series
+
+	realtime bool // if true, the table has the real-time period of each value, so can hold several vintages
+
+	nulls string // what the observations Fred II has no value for become: skip (not loaded), null or zero
+	units string // Fred II units transformation of the values, blank for none
+}
+
+// holds returns true if the whole series must be held in memory before it's inserted.
+func (tc *tableConfig) holds() bool {
+	return tc.detectInt || len(tc.enrichments) > 0
+}
+
+// newTableConfig returns the default table config.
+func newTableConfig() *tableConfig {
+	return &tableConfig{seriesCol: "seriesId", dateCol: "date", valueCol: "value", dateType: "Date",
+		valueType: "Float32", rollupEngine: "aggregating", nulls: "skip"}
+}
+
+// presets are named table configs selected with -preset
+var presets = map[string]func(tc *tableConfig){
+	// grafana matches what Grafana's ClickHouse datasource expects of a time series
+	"grafana": func(tc *tableConfig) {
+		tc.seriesCol, tc.dateCol, tc.valueCol = "metric", "time", "value"
+		tc.dateType = "DateTime('UTC')"
+		tc.bySeries = true
+	},
+}
+
+// applyPreset applies the named preset to tc.
+func (tc *tableConfig) applyPreset(name string) error {
+	preset, ok := presets[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown preset %s", name)
+	}
+	preset(tc)
+	return nil
+}
+
+// dateTypes matches the supported types of the date column
+var dateTypes = regexp.MustCompile(`^(Date|Date32|DateTime(\('[^']+'\))?|DateTime64\(\d(, *'[^']+')?\))$`)
+
+// setDateType sets the type of the date column.  DateTime64 without a precision gets millisecond precision.
+func (tc *tableConfig) setDateType(dateType string) error {
+	if dateType == "DateTime64" {
+		dateType = "DateTime64(3)"
+	}
+	if !dateTypes.MatchString(dateType) {
+		return fmt.Errorf("unsupported date column type %s", dateType)
+	}
+	tc.dateType = dateType
+	return nil
+}
+
+// dateTimeZone matches DateTime and DateTime64 types without a time zone
+var dateTimeZone = regexp.MustCompile(`^(DateTime|DateTime64\(\d)\)?$`)
+
+// setTimeZone gives a DateTime or DateTime64 date column without a time zone the time zone tz, so the dates, which
+// are midnight in tz, are stored as that instant.  Date columns have no time zone.
+func (tc *tableConfig) setTimeZone(tz string) {
+	m := dateTimeZone.FindStringSubmatch(tc.dateType)
+	if m == nil {
+		return
+	}
+	if m[1] == "DateTime" {
+		tc.dateType = fmt.Sprintf("DateTime('%s')", tz)
+		return
+	}
+	tc.dateType = fmt.Sprintf("%s, '%s')", m[1], tz)
+}
+
+// minYear returns the first year the date column can hold: 1900 for Date32 and DateTime64, 1970 for Date and
+// DateTime.  Observations before it aren't loaded.
+func (tc *tableConfig) minYear() int {
+	if tc.dateType == "Date32" || strings.HasPrefix(tc.dateType, "DateTime64") {
+		return minDate32.Year()
+	}
+	return 1970
+}
+
+// formatDate formats t for insertion into the date column.
+func (tc *tableConfig) formatDate(t time.Time) string {
+	if strings.HasPrefix(tc.dateType, "DateTime") {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return t.Format(fred.DateFormat)
+}
+
+// realtimeDate formats the end of a real-time period for a Date column, which can't hold dates before 1970 or
+// after maxCHDate.
+func realtimeDate(t time.Time) string {
+	switch {
+	case t.After(maxCHDate):
+		t = maxCHDate
+	case t.Year() < 1970:
+		t = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t.Format(fred.DateFormat)
+}
+
+// nullModes are the values of -nulls
+var nullModes = map[string]bool{"skip": true, "null": true, "zero": true}
+
+// valueColumnType returns the ClickHouse type of the value column, which is Nullable if missing values are
+// loaded as NULL.
+func (tc *tableConfig) valueColumnType() string {
+	if tc.nulls == "null" {
+		return fmt.Sprintf("Nullable(%s)", tc.valueType)
+	}
+	return tc.valueType
+}
+
+// withValueType returns a copy of the config with the value column type set to valueType.
+func (tc *tableConfig) withValueType(valueType string) *tableConfig {
+	cp := *tc
+	cp.valueType = valueType
+	return &cp
+}
+
+// check returns an error if the config can't produce a valid table.
+func (tc *tableConfig) check() error {
+	names := map[string]bool{}
+	switch tc.periodEnd {
+	case "", "add", "replace":
+	default:
+		return fmt.Errorf("-period-end must be add or replace, not %s", tc.periodEnd)
+	}
+	if !rollupEngines[tc.rollupEngine] {
+		return fmt.Errorf("-rollup-engine must be aggregating or summing, not %s", tc.rollupEngine)
+	}
+	if !nullModes[tc.nulls] {
+		return fmt.Errorf("-nulls must be skip, null or zero, not %s", tc.nulls)
+	}
+	// the periods of the rollups start on Dates, which can't hold the dates before 1970 a wider date column can
+	if len(tc.rollups) > 0 && tc.minYear() < 1970 {
+		return fmt.Errorf("-rollup can't be used with a %s date column", tc.dateType)
+	}
+	names[periodEndCol] = tc.periodEnd == "add"
+	names[realtimeStartCol], names[realtimeEndCol] = tc.realtime, tc.realtime
+	for _, en := range tc.enrichments {
+		names[en.col.name] = true
+	}
+	for _, name := range []string{tc.seriesCol, tc.dateCol, tc.valueCol} {
+		if !identifier.MatchString(name) {
+			return fmt.Errorf("illegal column name %q", name)
+		}
+		if names[name] {
+			return fmt.Errorf("column name %s is used twice", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// column is a column of a table we create
+type column struct {
+	name    string // column name
+	chType  string // ClickHouse type
+	comment string // column comment
+	codec   string // compression codec, blank for the default
+}
+
+// skipIndex is a data-skipping index of a table we create
+type skipIndex struct {
+	name        string // index name
+	expr        string // indexed expression
+	indexType   string // index type, with parameters
+	granularity int    // granules per index block
+}
+
+// projection is a projection of a table we create, holding all its columns in another order
+type projection struct {
+	name    string // projection name
+	orderBy string // ORDER BY expression
+}
+
+// tableSpec describes a table we create
+type tableSpec struct {
+	columns     []column
+	indexes     []skipIndex
+	projections []projection
+	engine      string // table engine, with parameters
+	orderBy     string // ORDER BY expression
+	cluster     string // cluster the table is created on, none if blank
+}
+
+// seriesSpec returns the spec of the table holding the observations of seriesId.
+func seriesSpec(seriesId string, tc *tableConfig) *tableSpec {
+	orderBy := tc.dateCol
+	if tc.bySeries {
+		orderBy = fmt.Sprintf("%s, %s", tc.seriesCol, tc.dateCol)
+	}
+	if tc.realtime {
+		orderBy += ", " + realtimeStartCol
+	}
+	dateComment := "date of metric value"
+	if tc.periodEnd == "replace" {
+		dateComment = "end of the period of metric value"
+	}
+	valueComment := fmt.Sprintf("metric value for series %s", seriesId)
+	if tc.units != "" {
+		valueComment += fmt.Sprintf(", as %s (Fred II units %s)", unitsTransforms[tc.units], tc.units)
+	}
+	spec := &tableSpec{
+		columns: []column{
+			{name: tc.seriesCol, chType: "String", comment: "Fred II series ID"},
+			{name: tc.dateCol, chType: tc.dateType, comment: dateComment},
+			{name: tc.valueCol, chType: tc.valueColumnType(), comment: valueComment},
+		},
+		engine:  "MergeTree()",
+		orderBy: orderBy,
+	}
+	if tc.periodEnd == "add" {
+		spec.columns = append(spec.columns, column{name: periodEndCol, chType: tc.dateType,
+			comment: "end of the period of metric value"})
+	}
+	if tc.realtime {
+		spec.columns = append(spec.columns,
+			column{name: realtimeStartCol, chType: "Date", comment: "first day the value was current"},
+			column{name: realtimeEndCol, chType: "Date", comment: "last day the value was current"})
+	}
+	for _, en := range tc.enrichments {
+		spec.columns = append(spec.columns, en.col)
+	}
+	if tc.dateIndex {
+		spec.indexes = append(spec.indexes, skipIndex{name: "dateIdx", expr: tc.dateCol, indexType: "minmax",
+			granularity: 4})
+	}
+	if tc.seriesIndex {
+		spec.indexes = append(spec.indexes, skipIndex{name: "seriesIdx", expr: tc.seriesCol,
+			indexType: "bloom_filter(0.01)", granularity: 4})
+	}
+	if len(tc.projection) > 0 {
+		spec.projections = append(spec.projections, projection{name: "by_" + strings.Join(tc.projection, "_"),
+			orderBy: strings.Join(tc.projection, ", ")})
+	}
+	return spec
+}
+
+// parseProjection splits the comma-separated -projection column list, checking each is a column of the table.
+func (tc *tableConfig) parseProjection(list string) error {
+	tc.projection = nil
+	if list == "" {
+		return nil
+	}
+	for _, col := range strings.Split(list, ",") {
+		col = strings.TrimSpace(col)
+		if col != tc.seriesCol && col != tc.dateCol && col != tc.valueCol {
+			return fmt.Errorf("-projection column %s must be %s, %s or %s", col, tc.seriesCol, tc.dateCol, tc.valueCol)
+		}
+		tc.projection = append(tc.projection, col)
+	}
+	return nil
+}
+
+// cell is a value of a row: text is the value, which is a string or date if quoted is set, or NULL if null is set
+type cell struct {
+	text   string
+	quoted bool
+	null   bool
+}
+
+// cells returns the values of the row for observation o of seriesId, in the column order of seriesSpec.  frequency
+// is the Fred II frequency code of the series, which is needed for period-end dates.  extra holds the values of the
+// enrichment columns.  An observation Fred II has no value for gets NULL or 0, as tc.nulls says.
+func (tc *tableConfig) cells(seriesId string, o fred.Observation, frequency string, extra []float64) ([]cell, error) {
+	var periodEnd time.Time
+	if tc.periodEnd != "" {
+		var e error
+		if periodEnd, e = fred.PeriodEnd(o.Date, frequency); e != nil {
+			return nil, e
+		}
+	}
+	date := o.Date
+	if tc.periodEnd == "replace" {
+		date = periodEnd
+	}
+	// the value is always a finite number, so it's formatted as a plain decimal
+	value := cell{text: strconv.FormatFloat(o.Value, 'f', -1, 64)}
+	switch {
+	case o.Missing && tc.nulls == "null":
+		value = cell{null: true}
+	case o.Missing:
+		value = cell{text: "0"}
+	case math.IsNaN(o.Value) || math.IsInf(o.Value, 0):
+		return nil, fmt.Errorf("series %s has value %v for %s, which isn't a finite number", seriesId, o.Value,
+			o.Date.Format(fred.DateFormat))
+	}
+	cells := []cell{{text: seriesId, quoted: true}, {text: tc.formatDate(date), quoted: true}, value}
+	if tc.periodEnd == "add" {
+		cells = append(cells, cell{text: tc.formatDate(periodEnd), quoted: true})
+	}
+	if tc.realtime {
+		cells = append(cells, cell{text: realtimeDate(o.RealtimeStart), quoted: true},
+			cell{text: realtimeDate(o.RealtimeEnd), quoted: true})
+	}
+	for _, v := range extra {
+		cells = append(cells, cell{text: formatExtra(v)})
+	}
+	return cells, nil
+}
+
+// row returns the VALUES row for observation o of seriesId, as cells describes it.
+func (tc *tableConfig) row(seriesId string, o fred.Observation, frequency string, extra []float64) (string, error) {
+	cells, e := tc.cells(seriesId, o, frequency, extra)
+	if e != nil {
+		return "", e
+	}
+	values := make([]string, len(cells))
+	for ind, c := range cells {
+		switch {
+		case c.null:
+			values[ind] = "NULL"
+		case c.quoted:
+			values[ind] = quote(c.text)
+		default:
+			values[ind] = c.text
+		}
+	}
+	return strings.Join(values, ","), nil
+}
+
+// createSQL returns the CREATE TABLE statement for table.  If ifNotExists, an existing table is left in place.
+func (ts *tableSpec) createSQL(table string, ifNotExists bool) string {
+	cols := make([]string, 0, len(ts.columns))
+	for _, c := range ts.columns {
+		col := fmt.Sprintf("    %s %s", c.name, c.chType)
+		if c.comment != "" {
+			col += fmt.Sprintf(" COMMENT '%s'", strings.ReplaceAll(c.comment, "'", "\\'"))
+		}
+		if c.codec != "" {
+			col += fmt.Sprintf(" CODEC(%s)", c.codec)
+		}
+		cols = append(cols, col)
+	}
+	for _, idx := range ts.indexes {
+		cols = append(cols, fmt.Sprintf("    INDEX %s %s TYPE %s GRANULARITY %d", idx.name, idx.expr, idx.indexType,
+			idx.granularity))
+	}
+	for _, p := range ts.projections {
+		cols = append(cols, fmt.Sprintf("    PROJECTION %s (SELECT * ORDER BY (%s))", p.name, p.orderBy))
+	}
+	create := "CREATE TABLE"
+	if ifNotExists {
+		create += " IF NOT EXISTS"
+	}
+	if ts.cluster != "" {
+		table += fmt.Sprintf(" ON CLUSTER %s", ts.cluster)
+	}
+	qry := fmt.Sprintf("%s %s (\n%s\n) ENGINE = %s", create, table, strings.Join(cols, ",\n"), ts.engine)
+	if ts.orderBy != "" {
+		qry += fmt.Sprintf("\nORDER BY (%s)", ts.orderBy)
+	}
+	return qry
+}
+
+// addColumnsSQL returns the statements that add the last n columns of the spec to table, if it lacks them.
+// They migrate tables created before the columns existed.
+func (ts *tableSpec) addColumnsSQL(table string, n int) []string {
+	var ddl []string
+	for _, c := range ts.columns[len(ts.columns)-n:] {
+		ddl = append(ddl, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, c.name, c.chType))
+	}
+	return ddl
+}
+
+// insertSQL returns an INSERT statement for table with a placeholder for each column of the spec.  The columns are
+// named so the statement works for tables that have been migrated.
+func (ts *tableSpec) insertSQL(table string) string {
+	names := make([]string, 0, len(ts.columns))
+	for _, c := range ts.columns {
+		names = append(names, c.name)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(names, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "))
+}
+
+// tableDDL returns the statements that create the table for seriesId, dropping any existing table.
+// Rollups of the table are dropped and recreated along with it.  So are its Buffer table, if it has one, and the
+// views feeding its fan-out targets, if it's a landing table.
+func tableDDL(seriesId string, table string, tc *tableConfig) []string {
+	if tc.cluster != "" {
+		return clusterDDL(seriesId, table, tc)
+	}
+	var ddl []string
+	if tc.buffer {
+		ddl = append(ddl, bufferDrop(table))
+	}
+	ddl = append(ddl, fanoutDrops(tc)...)
+	ddl = append(ddl, rollupDrops(table, tc)...)
+	spec := seriesSpec(seriesId, tc)
+	if len(tc.fanout) > 0 {
+		spec = spec.landing()
+	}
+	ddl = append(ddl, fmt.Sprintf("DROP TABLE IF EXISTS %s", table), spec.createSQL(table, false))
+	ddl = append(ddl, rollupCreates(table, tc)...)
+	ddl = append(ddl, fanoutCreates(seriesId, table, tc)...)
+	if tc.buffer {
+		ddl = append(ddl, bufferDDL(table, false)...)
+	}
+	return ddl
+}
+
+// execDDL runs the DDL statements in order.
+func execDDL(ddl []string, con *chutils.Connect) error {
+	for _, qry := range ddl {
+		if _, e := con.Exec(qry); e != nil {
+			return chsink.Classify(e)
+		}
+	}
+	return nil
+}
+
+// splitTable returns the database of table, blank if it isn't qualified by one, and its name.
+func splitTable(table string) (string, string) {
+	if ind := strings.Index(table, "."); ind >= 0 {
+		return table[:ind], table[ind+1:]
+	}
+	return "", table
+}
+
+// printDDL prints the DDL statements, each terminated by a semicolon.
+func printDDL(ddl []string) {
+	for _, qry := range ddl {
+		fmt.Printf("%s;\n\n", qry)
+	}
+}
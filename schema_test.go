@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/invertedv/fred2ch/fred"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRow(t *testing.T) {
+	date := time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name      string
+		seriesId  string
+		value     float64
+		periodEnd string
+		dateType  string
+		extra     []float64
+		want      string
+		err       bool
+	}{
+		{name: "plain", seriesId: "GDP", value: 1.25, want: "'GDP','2020-04-01',1.25"},
+		{name: "quoted series", seriesId: `O'X\Y`, value: 1, want: `'O\'X\\Y','2020-04-01',1`},
+		{name: "no exponent", seriesId: "GDP", value: 1e21, want: "'GDP','2020-04-01',1000000000000000000000"},
+		{name: "DateTime", seriesId: "GDP", value: 2, dateType: "DateTime('UTC')",
+			want: "'GDP','2020-04-01 00:00:00',2"},
+		{name: "period end added", seriesId: "GDP", value: 2, periodEnd: "add",
+			want: "'GDP','2020-04-01',2,'2020-06-30'"},
+		{name: "period end replacing", seriesId: "GDP", value: 2, periodEnd: "replace",
+			want: "'GDP','2020-06-30',2"},
+		{name: "enrichments", seriesId: "GDP", value: 2, extra: []float64{0.5, math.NaN()},
+			want: "'GDP','2020-04-01',2,0.5,nan"},
+		{name: "NaN", seriesId: "GDP", value: math.NaN(), err: true},
+		{name: "Inf", seriesId: "GDP", value: math.Inf(1), err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTableConfig()
+			tc.periodEnd = tt.periodEnd
+			if tt.dateType != "" {
+				tc.dateType = tt.dateType
+			}
+			got, e := tc.row(tt.seriesId, fred.Observation{Date: date, Value: tt.value}, "Q", tt.extra)
+			if (e != nil) != tt.err {
+				t.Fatalf("error %v, want an error: %v", e, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("row %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
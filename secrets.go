@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// fromStdin is the value of a secret flag that means the secret is read from stdin
+const fromStdin = "-"
+
+// stdin reads the secrets given as fromStdin, in the order they're read
+var stdin = bufio.NewReader(os.Stdin)
+
+// secretFlag is a flag holding a secret, such as a password
+type secretFlag struct {
+	name  string  // what the secret is, used to prompt for it
+	value *string // value of the flag
+}
+
+// readSecrets replaces each secret that is fromStdin with one read from stdin, in order.  If stdin is a terminal,
+// the secret is prompted for and isn't echoed, otherwise it's the next line of stdin.  So secrets needn't appear
+// in shell history or process listings.
+func readSecrets(secrets ...secretFlag) error {
+	for _, s := range secrets {
+		if *s.value != fromStdin {
+			continue
+		}
+		v, e := readSecret(s.name)
+		if e != nil {
+			return fmt.Errorf("reading %s: %w", s.name, e)
+		}
+		*s.value = v
+	}
+	return nil
+}
+
+// readSecret reads a secret from stdin, prompting for it with echo off if stdin is a terminal.
+func readSecret(name string) (string, error) {
+	if fi, e := os.Stdin.Stat(); e == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprintf(os.Stderr, "%s: ", name)
+		if e := stty("-echo"); e != nil {
+			return "", fmt.Errorf("can't turn off echo: %w", e)
+		}
+		defer func() {
+			_ = stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, e := stdin.ReadString('\n')
+	if e != nil && (e != io.EOF || line == "") {
+		return "", e
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// stty sets the terminal on stdin.
+func stty(setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
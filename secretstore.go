@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// secretsTimeout is how long fetching a secret may take
+const secretsTimeout = 30 * time.Second
+
+// applySecrets sets the settings of acct that weren't given as flags, according to set, to those held in the
+// secret acct.Secrets names, if it names one.  So flags take precedence over the secret, which takes precedence over
+// a profile or the top of a jobs file.
+func (acct *account) applySecrets(set map[string]bool) error {
+	if acct.Secrets == "" {
+		return nil
+	}
+	raw, e := fetchSecret(acct.Secrets)
+	if e != nil {
+		return fmt.Errorf("-secrets %s: %w", acct.Secrets, e)
+	}
+	p := &account{}
+	// the secret is a JSON object, which is YAML too
+	if e := yaml.Unmarshal(raw, p); e != nil {
+		return fmt.Errorf("-secrets %s: %w", acct.Secrets, e)
+	}
+	p.Secrets = ""
+	acct.applyProfile(p, set)
+	return nil
+}
+
+// fetchSecret returns the secret at uri: vault://path for the path of a HashiCorp Vault secret, or aws-sm://id
+// for an AWS Secrets Manager secret.  The secret is a JSON object of settings named as in a jobs file, e.g.
+// {"api": "...", "user": "...", "password": "..."}.
+func fetchSecret(uri string) ([]byte, error) {
+	scheme, path, ok := strings.Cut(uri, "://")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("must be vault://path or aws-sm://id")
+	}
+	switch scheme {
+	case "vault":
+		return vaultSecret(path)
+	case "aws-sm":
+		return awsSecret(path)
+	}
+	return nil, fmt.Errorf("unknown secrets manager %s, must be vault or aws-sm", scheme)
+}
+
+// vaultSecret reads the secret at path from the Vault server at $VAULT_ADDR with the token $VAULT_TOKEN, and
+// $VAULT_NAMESPACE if set, as the vault command does.  It returns the data of the secret, from a KV version 1 or 2
+// secrets engine.
+func vaultSecret(path string) ([]byte, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+	req, e := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if e != nil {
+		return nil, e
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, e := (&http.Client{Timeout: secretsTimeout}).Do(req)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, e := io.ReadAll(resp.Body)
+	if e != nil {
+		return nil, e
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if e := json.Unmarshal(body, &secret); e != nil {
+		return nil, e
+	}
+	// KV version 2 nests the secret in data, beside its metadata
+	if inner, ok := secret.Data["data"]; ok {
+		if _, ok := secret.Data["metadata"]; ok {
+			return inner, nil
+		}
+	}
+	return json.Marshal(secret.Data)
+}
+
+// awsSecret reads the string of the AWS Secrets Manager secret id with the aws command, so the credentials are
+// found as for any other use of it: environment, profile, SSO or instance role.
+func awsSecret(id string) ([]byte, error) {
+	cmd := exec.Command("aws", "secretsmanager", "get-secret-value", "--secret-id", id, "--query", "SecretString",
+		"--output", "text")
+	cmd.Stderr = os.Stderr
+	out, e := cmd.Output()
+	if e != nil {
+		return nil, fmt.Errorf("aws: %w", e)
+	}
+	return out, nil
+}
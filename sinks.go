@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/invertedv/fred2ch/fred"
+	"strings"
+	"sync"
+)
+
+// sharedSink is a sink of the run.  It's made the first time a load names it and every load naming it after that
+// writes to it, one call at a time.  A sharedSink is safe for concurrent use.
+type sharedSink struct {
+	mu   sync.Mutex
+	sink fred.Sink
+}
+
+var (
+	runSinksMu sync.Mutex
+	runSinks   = map[string]*sharedSink{}
+)
+
+// runSink returns the sink of the run given as spec, name or name:arg, making it if it's the first time.
+func runSink(spec string) (fred.Sink, error) {
+	spec = strings.TrimSpace(spec)
+	runSinksMu.Lock()
+	defer runSinksMu.Unlock()
+	if sk, ok := runSinks[spec]; ok {
+		return sk, nil
+	}
+	sk, e := fred.NewSink(spec)
+	if e != nil {
+		return nil, e
+	}
+	runSinks[spec] = &sharedSink{sink: sk}
+	return runSinks[spec], nil
+}
+
+// CreateSchema readies the sink for the series.
+func (s *sharedSink) CreateSchema(seriesId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink.CreateSchema(seriesId)
+}
+
+// WriteBatch writes the observations of batch that have values, the only ones a Sink is given.
+func (s *sharedSink) WriteBatch(seriesId string, batch []fred.Observation) error {
+	valued := make([]fred.Observation, 0, len(batch))
+	for _, o := range batch {
+		if !o.Missing {
+			valued = append(valued, o)
+		}
+	}
+	if len(valued) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink.WriteBatch(seriesId, valued)
+}
+
+// Finalize ends the series in the sink with the outcome of its load.
+func (s *sharedSink) Finalize(seriesId string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink.Finalize(seriesId, err)
+}
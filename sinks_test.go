@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/invertedv/fred2ch/fred"
+	"testing"
+)
+
+// recordSink is a sink that keeps the values written to it
+type recordSink struct {
+	values []float64
+}
+
+func (r *recordSink) CreateSchema(seriesId string) error { return nil }
+
+func (r *recordSink) WriteBatch(seriesId string, batch []fred.Observation) error {
+	for _, o := range batch {
+		r.values = append(r.values, o.Value)
+	}
+	return nil
+}
+
+func (r *recordSink) Finalize(seriesId string, err error) error { return nil }
+
+func TestRunSink(t *testing.T) {
+	made := 0
+	rec := &recordSink{}
+	fred.RegisterSink("record", func(arg string) (fred.Sink, error) {
+		made++
+		return rec, nil
+	})
+	first, e := runSink("record")
+	if e != nil {
+		t.Fatal(e)
+	}
+	second, e := runSink(" record ")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if first != second || made != 1 {
+		t.Fatalf("the sink was made %d times for two loads", made)
+	}
+	batch := []fred.Observation{{Value: 1}, {Missing: true}, {Value: 3}}
+	if e := first.WriteBatch("GDP", batch); e != nil {
+		t.Fatal(e)
+	}
+	if e := second.WriteBatch("GDP", []fred.Observation{{Missing: true}}); e != nil {
+		t.Fatal(e)
+	}
+	if len(rec.values) != 2 || rec.values[0] != 1 || rec.values[1] != 3 {
+		t.Errorf("sink was written %v, want [1 3]", rec.values)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"regexp"
+	"time"
+)
+
+// snapshotFormat is the format of the date that ends the name of a snapshot
+const snapshotFormat = "20060102"
+
+// backupFormat is the format of the time that ends the name of a backup
+const backupFormat = "20060102150405"
+
+// snapshot renames table, if it exists, to table_YYYYMMDD for today's date, replacing a snapshot taken earlier
+// the same day, then drops all but the newest tc.snapshots snapshots of table.
+func snapshot(table string, tc *tableConfig, con *chutils.Connect) error {
+	if e := renameAway(table, fmt.Sprintf("%s_%s", table, time.Now().Format(snapshotFormat)), tc, con); e != nil {
+		return e
+	}
+	// the date suffix sorts the snapshots newest first
+	snaps, e := similarTables(table, `_\d{8}`, con)
+	if e != nil {
+		return e
+	}
+	for ind := tc.snapshots; ind < len(snaps); ind++ {
+		if e := dropOld(snaps[ind], "snapshot", con); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// backup renames table, if it exists, to table_backup_on_YYYYMMDDhhmmss for the current time, then drops the
+// backups of table more than tc.backupDays days old.
+func backup(table string, tc *tableConfig, con *chutils.Connect) error {
+	now := time.Now()
+	if e := renameAway(table, fmt.Sprintf("%s_backup_on_%s", table, now.Format(backupFormat)), tc, con); e != nil {
+		return e
+	}
+	backups, e := similarTables(table, `_backup_on_\d{14}`, con)
+	if e != nil {
+		return e
+	}
+	cutoff := now.AddDate(0, 0, -tc.backupDays)
+	for _, b := range backups {
+		taken, e := time.ParseInLocation(backupFormat, b[len(b)-len(backupFormat):], time.Local)
+		if e != nil || !taken.Before(cutoff) {
+			continue
+		}
+		if e := dropOld(b, "backup", con); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// renameAway renames table, if it exists, to to, replacing any table to.
+func renameAway(table string, to string, tc *tableConfig, con *chutils.Connect) error {
+	exists, e := tableExists(table, con)
+	if e != nil || !exists {
+		return e
+	}
+	var ddl []string
+	// the buffer flushes to the table when it's dropped, so it must go before the table is renamed
+	if tc.buffer {
+		ddl = append(ddl, bufferDrop(table))
+	}
+	ddl = append(ddl, fmt.Sprintf("DROP TABLE IF EXISTS %s", to), fmt.Sprintf("RENAME TABLE %s TO %s", table, to))
+	return execDDL(ddl, con)
+}
+
+// similarTables returns the tables in the database of table named table's name followed by a match of the regexp
+// suffix, in descending order of name and qualified by the database as table is.
+func similarTables(table string, suffix string, con *chutils.Connect) ([]string, error) {
+	db, name := splitTable(table)
+	qry := "SELECT name FROM system.tables WHERE database = if(? = '', currentDatabase(), ?) AND match(name, ?) " +
+		"ORDER BY name DESC"
+	rows, e := con.Query(qry, db, db, "^"+regexp.QuoteMeta(name)+suffix+"$")
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = rows.Close() }()
+	var tables []string
+	for rows.Next() {
+		var t string
+		if e := rows.Scan(&t); e != nil {
+			return nil, e
+		}
+		if db != "" {
+			t = db + "." + t
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// dropOld drops table, an old snapshot or backup as kind says.
+func dropOld(table string, kind string, con *chutils.Connect) error {
+	if e := execDDL([]string{fmt.Sprintf("DROP TABLE %s", table)}, con); e != nil {
+		return e
+	}
+	fmt.Printf("dropped %s %s\n", kind, table)
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/invertedv/chutils"
+	s "github.com/invertedv/chutils/sql"
+	"github.com/invertedv/fred2ch/chsink"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// spoolSuffix ends the name of a spool file that is complete, and so can be flushed
+const spoolSuffix = ".spool"
+
+// spoolHeader is the first line of a spool file.  The rows follow, one per line, as they'd be inserted.
+type spoolHeader struct {
+	SeriesId string    `json:"seriesId"`
+	Table    string    `json:"table"`
+	Target   string    `json:"target"` // table the rows are inserted into, which may be the Buffer table
+	DDL      []string  `json:"ddl"`    // statements creating the table, if the load hadn't created it yet
+	Spooled  time.Time `json:"spooled"`
+}
+
+// spool is a file holding the rows of a load that ClickHouse was unavailable to take, so that a later run can
+// insert them without fetching the series again.
+type spool struct {
+	file *os.File
+	w    *bufio.Writer
+	rows int
+}
+
+// openSpool starts a spool file in the job's spool directory for the rest of the job's rows.  If created is
+// false, the table hasn't been created, so flushing the spool creates it.
+func openSpool(j *job, created bool) (*spool, error) {
+	if e := os.MkdirAll(j.spool, 0700); e != nil {
+		return nil, e
+	}
+	now := time.Now()
+	// the time leads the name so the spools are flushed in the order they were written
+	name := fmt.Sprintf("%s_%s_%s_*.tmp", now.Format(backupFormat), j.table, j.seriesId)
+	f, e := os.CreateTemp(j.spool, name)
+	if e != nil {
+		return nil, e
+	}
+	h := spoolHeader{SeriesId: j.seriesId, Table: j.table, Target: j.tc.insertTarget(j.table), Spooled: now}
+	if !created {
+		h.DDL = tableDDL(j.seriesId, j.table, j.tc)
+	}
+	sp := &spool{file: f, w: bufio.NewWriter(f)}
+	if e := json.NewEncoder(sp.w).Encode(h); e != nil {
+		_ = sp.discard()
+		return nil, e
+	}
+	return sp, nil
+}
+
+// add writes the rows of a batch to the spool.  extra holds the enrichment column values of each observation,
+// and is nil if there are none.
+func (sp *spool) add(batch []fred.Observation, extra [][]float64, j *job) error {
+	for ind, o := range batch {
+		var ex []float64
+		if extra != nil {
+			ex = extra[ind]
+		}
+		line, e := j.tc.row(j.seriesId, o, j.frequency, ex)
+		if e != nil {
+			return e
+		}
+		if _, e := sp.w.WriteString(line + "\n"); e != nil {
+			return e
+		}
+	}
+	sp.rows += len(batch)
+	return nil
+}
+
+// close completes the spool file, making it one the next run flushes.  It returns the name of the file.
+func (sp *spool) close() (string, error) {
+	if e := sp.w.Flush(); e != nil {
+		_ = sp.discard()
+		return "", e
+	}
+	if e := sp.file.Sync(); e != nil {
+		_ = sp.discard()
+		return "", e
+	}
+	if e := sp.file.Close(); e != nil {
+		return "", e
+	}
+	name := strings.TrimSuffix(sp.file.Name(), ".tmp") + spoolSuffix
+	return name, os.Rename(sp.file.Name(), name)
+}
+
+// discard closes and removes the spool file.
+func (sp *spool) discard() error {
+	_ = sp.file.Close()
+	return os.Remove(sp.file.Name())
+}
+
+// flushSpool inserts the rows of each spool file in dir, oldest first, removing the files as they're flushed.
+func flushSpool(dir string, con *chutils.Connect) error {
+	files, e := filepath.Glob(filepath.Join(dir, "*"+spoolSuffix))
+	if e != nil {
+		return e
+	}
+	for _, file := range files {
+		if e := flushFile(file, con); e != nil {
+			return fmt.Errorf("spool %s: %w", file, e)
+		}
+	}
+	return nil
+}
+
+// flushFile inserts the rows of the spool file, in a single insert, and removes the file.
+func flushFile(file string, con *chutils.Connect) error {
+	f, e := os.Open(file)
+	if e != nil {
+		return e
+	}
+	defer func() { _ = f.Close() }()
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		return fmt.Errorf("no header: %v", sc.Err())
+	}
+	h := spoolHeader{}
+	if e := json.Unmarshal(sc.Bytes(), &h); e != nil {
+		return e
+	}
+	if e := execDDL(h.DDL, con); e != nil {
+		return e
+	}
+	wtr := s.NewWriter(h.Target, con)
+	defer func() {
+		if e := wtr.Close(); e != nil {
+			fmt.Println(e)
+		}
+	}()
+	rows := 0
+	for sc.Scan() {
+		if _, e := wtr.Write([]byte(sc.Text())); e != nil {
+			return e
+		}
+		rows++
+	}
+	if e := sc.Err(); e != nil {
+		return e
+	}
+	if rows > 0 {
+		if e := wtr.Insert(); e != nil {
+			return chsink.Classify(e)
+		}
+	}
+	fmt.Printf("flushed %d rows of series %s spooled %s into %s\n", rows, h.SeriesId,
+		h.Spooled.Format("2006-01-02 15:04:05"), h.Table)
+	return os.Remove(file)
+}
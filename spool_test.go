@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpool(t *testing.T) {
+	for _, created := range []bool{false, true} {
+		j := &job{seriesId: "GDP", table: "econ.gdp", tc: newTableConfig(), spool: t.TempDir()}
+		sp, e := openSpool(j, created)
+		if e != nil {
+			t.Fatal(e)
+		}
+		batch := []fred.Observation{{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Value: 1.5},
+			{Date: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), Value: 2}}
+		if e := sp.add(batch, nil, j); e != nil {
+			t.Fatal(e)
+		}
+		if sp.rows != 2 {
+			t.Errorf("%d rows spooled, want 2", sp.rows)
+		}
+		// a spool isn't flushed until it's complete
+		if files, _ := filepath.Glob(filepath.Join(j.spool, "*"+spoolSuffix)); len(files) != 0 {
+			t.Errorf("incomplete spool files %v", files)
+		}
+		name, e := sp.close()
+		if e != nil {
+			t.Fatal(e)
+		}
+		if files, _ := filepath.Glob(filepath.Join(j.spool, "*")); len(files) != 1 || files[0] != name ||
+			!strings.HasSuffix(name, spoolSuffix) {
+			t.Fatalf("spool files %v, want just %s", files, name)
+		}
+		f, e := os.Open(name)
+		if e != nil {
+			t.Fatal(e)
+		}
+		sc := bufio.NewScanner(f)
+		var lines []string
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		_ = f.Close()
+		if len(lines) != 3 {
+			t.Fatalf("spool has %d lines, want a header and 2 rows", len(lines))
+		}
+		h := spoolHeader{}
+		if e := json.Unmarshal([]byte(lines[0]), &h); e != nil {
+			t.Fatal(e)
+		}
+		if h.SeriesId != "GDP" || h.Table != "econ.gdp" || h.Target != "econ.gdp" || (len(h.DDL) > 0) == created {
+			t.Errorf("header %+v for a table created: %v", h, created)
+		}
+		if lines[1] != "'GDP','2020-01-01',1.5" || lines[2] != "'GDP','2020-04-01',2" {
+			t.Errorf("rows %q", lines[1:])
+		}
+	}
+}
+
+func TestSpoolDiscard(t *testing.T) {
+	j := &job{seriesId: "GDP", table: "gdp", tc: newTableConfig(), spool: t.TempDir()}
+	sp, e := openSpool(j, true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := sp.discard(); e != nil {
+		t.Fatal(e)
+	}
+	if files, _ := filepath.Glob(filepath.Join(j.spool, "*")); len(files) != 0 {
+		t.Errorf("discarded spool left %v", files)
+	}
+}
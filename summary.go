@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/fred2ch/fred"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// outcome is how a load went: a line of the summary of a run
+type outcome struct {
+	label    string        // name of the job
+	seriesId string        // series loaded
+	stats    *loadStats    // what the load put in the table, nil if it failed or was skipped
+	elapsed  time.Duration // time the load took
+	status   string        // ok, skipped or failed
+}
+
+// newOutcome returns the outcome of the load of j, labelled label, which took elapsed and returned err.  j may be
+// nil if the load couldn't be set up, in which case seriesId is the series it was for.
+func newOutcome(label string, seriesId string, j *job, elapsed time.Duration, err error) outcome {
+	o := outcome{label: label, seriesId: seriesId, elapsed: elapsed, status: "ok"}
+	if j != nil {
+		o.seriesId = j.seriesId
+	}
+	switch {
+	case err != nil:
+		o.status = "failed"
+	case j.skipped:
+		o.status = "skipped"
+	default:
+		o.stats = j.stats
+	}
+	return o
+}
+
+// statusColors are the ANSI colors of the statuses in the summary
+var statusColors = map[string]string{"ok": "\x1b[32m", "skipped": "\x1b[33m", "failed": "\x1b[31m"}
+
+// printSummary prints the outcomes as an aligned table, with the statuses in color if color is true.
+func printSummary(outcomes []outcome, color bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSERIES\tROWS\tFROM\tTO\tTIME\tSTATUS")
+	for _, o := range outcomes {
+		rows, from, to := "-", "-", "-"
+		if o.stats != nil {
+			rows = fmt.Sprint(o.stats.rows)
+			if o.stats.rows > 0 {
+				from, to = o.stats.minDate.Format(fred.DateFormat), o.stats.maxDate.Format(fred.DateFormat)
+			}
+		}
+		status := o.status
+		if color {
+			status = statusColors[o.status] + status + "\x1b[0m"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", o.label, o.seriesId, rows, from, to,
+			o.elapsed.Round(100*time.Millisecond), status)
+	}
+	if e := w.Flush(); e != nil {
+		fmt.Println(e)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// reference matches a reference to a variable in a jobs file: ${NAME} or ${NAME:-default}
+var reference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?}`)
+
+// expand replaces the references to variables in text.  A reference takes its value from vars, then the
+// environment, then its default.  A reference to a variable that isn't set and has no default is an error.
+func expand(text string, vars map[string]string) (string, error) {
+	var unset []string
+	out := reference.ReplaceAllStringFunc(text, func(ref string) string {
+		m := reference.FindStringSubmatch(ref)
+		if v, ok := vars[m[1]]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(m[1]); ok {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		unset = append(unset, m[1])
+		return ref
+	})
+	if len(unset) > 0 {
+		return "", fmt.Errorf("variables not set: %s", strings.Join(unset, ", "))
+	}
+	return out, nil
+}
+
+// expandJobs expands the references to variables in the jobs file text.  The variables are those of the vars
+// block of the file, whose values may themselves refer to the environment, overridden by set.
+func expandJobs(text string, set map[string]string) (string, error) {
+	var block struct {
+		Vars map[string]string `yaml:"vars"`
+	}
+	if e := yaml.Unmarshal([]byte(text), &block); e != nil {
+		return "", e
+	}
+	vars := make(map[string]string)
+	for name, v := range block.Vars {
+		ev, e := expand(v, nil)
+		if e != nil {
+			return "", fmt.Errorf("variable %s: %w", name, e)
+		}
+		vars[name] = ev
+	}
+	for name, v := range set {
+		vars[name] = v
+	}
+	return expand(text, vars)
+}
+
+// varFlag is a flag that sets variables given as name=value, and may be repeated
+type varFlag map[string]string
+
+func (vf varFlag) String() string {
+	return ""
+}
+
+func (vf varFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("-var must be name=value, not %s", s)
+	}
+	vf[name] = value
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	t.Setenv("FRED2CH_TEST_HOST", "envhost")
+	t.Setenv("FRED2CH_TEST_EMPTY", "")
+	vars := map[string]string{"TABLE": "econ.gdp", "FRED2CH_TEST_HOST": "varhost"}
+	for _, tt := range []struct {
+		text string
+		want string
+		err  bool
+	}{
+		{text: "table: ${TABLE}", want: "table: econ.gdp"},
+		{text: "host: ${FRED2CH_TEST_HOST}", want: "host: varhost"},
+		{text: "host: ${FRED2CH_TEST_UNSET:-localhost}", want: "host: localhost"},
+		{text: "host: ${FRED2CH_TEST_UNSET:-}", want: "host: "},
+		{text: "host: ${FRED2CH_TEST_EMPTY:-localhost}", want: "host: "},
+		{text: "${TABLE}_${TABLE}", want: "econ.gdp_econ.gdp"},
+		{text: "price: $5 {TABLE} $TABLE", want: "price: $5 {TABLE} $TABLE"},
+		{text: "${FRED2CH_TEST_UNSET} ${FRED2CH_TEST_ALSO_UNSET}", err: true},
+	} {
+		got, e := expand(tt.text, vars)
+		if (e != nil) != tt.err || got != tt.want {
+			t.Errorf("expand(%q) = %q, %v, want %q", tt.text, got, e, tt.want)
+		}
+	}
+}
+
+func TestExpandJobs(t *testing.T) {
+	t.Setenv("FRED2CH_TEST_DB", "econ")
+	text := `vars:
+  DB: ${FRED2CH_TEST_DB}
+  BATCH: "1000"
+jobs:
+  - series: GDP
+    table: ${DB}.gdp
+    batch: ${BATCH}
+`
+	got, e := expandJobs(text, map[string]string{"BATCH": "5000"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := `vars:
+  DB: econ
+  BATCH: "1000"
+jobs:
+  - series: GDP
+    table: econ.gdp
+    batch: 5000
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if _, e := expandJobs("vars:\n  DB: ${FRED2CH_TEST_UNSET}\n", nil); e == nil {
+		t.Error("a variable referring to an unset one isn't an error")
+	}
+}
+
+func TestVarFlag(t *testing.T) {
+	vf := varFlag{}
+	for _, s := range []string{"DB=econ", "EMPTY=", "EXPR=a=b"} {
+		if e := vf.Set(s); e != nil {
+			t.Errorf("Set(%q): %v", s, e)
+		}
+	}
+	if vf["DB"] != "econ" || vf["EMPTY"] != "" || vf["EXPR"] != "a=b" {
+		t.Errorf("vars %v", vf)
+	}
+	for _, s := range []string{"DB", "=econ"} {
+		if e := vf.Set(s); e == nil {
+			t.Errorf("Set(%q) isn't an error", s)
+		}
+	}
+}
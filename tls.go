@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/invertedv/fred2ch/fred"
+	"net"
+	"net/http"
+	"os"
+)
+
+// tlsConfig returns the TLS settings of acct: the certificates of its CACert trusted as well as the system's and,
+// if InsecureSkipVerify, server certificates not verified at all.  It is nil if acct sets neither.
+func (acct *account) tlsConfig() (*tls.Config, error) {
+	if acct.CACert == "" && !acct.InsecureSkipVerify {
+		return nil, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: acct.InsecureSkipVerify}
+	if acct.CACert == "" {
+		return cfg, nil
+	}
+	pem, e := os.ReadFile(acct.CACert)
+	if e != nil {
+		return nil, fmt.Errorf("-ca-cert: %w", e)
+	}
+	pool, e := x509.SystemCertPool()
+	if e != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("-ca-cert %s has no PEM certificates", acct.CACert)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+// chTLS returns the TLS settings of the ClickHouse connection of acct, nil if it isn't secure.  A client
+// certificate makes it secure.
+func (acct *account) chTLS() (*tls.Config, error) {
+	if (acct.TLSCert == "") != (acct.TLSKey == "") {
+		return nil, fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	if !acct.Secure && acct.TLSCert == "" {
+		return nil, nil
+	}
+	cfg, e := acct.tlsConfig()
+	if e != nil {
+		return nil, e
+	}
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if acct.TLSCert != "" {
+		cert, e := tls.LoadX509KeyPair(acct.TLSCert, acct.TLSKey)
+		if e != nil {
+			return nil, fmt.Errorf("-tls-cert, -tls-key: %w", e)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// serverTLS returns cfg set to verify the certificate of host, which may give a port.  The name must be set since
+// the connection may go to a tunnel rather than host.  A nil cfg is returned as is.
+func serverTLS(cfg *tls.Config, host string) *tls.Config {
+	if cfg == nil {
+		return nil
+	}
+	if name, _, e := net.SplitHostPort(host); e == nil {
+		host = name
+	}
+	cfg = cfg.Clone()
+	cfg.ServerName = host
+	return cfg
+}
+
+// fredTLS makes later Fred II requests use the TLS settings of acct, for proxies that present their own
+// certificates.  Without settings, requests use the system's.
+func (acct *account) fredTLS() error {
+	cfg, e := acct.tlsConfig()
+	if e != nil || cfg == nil {
+		return e
+	}
+	transport := fred.Transport()
+	transport.TLSClientConfig = cfg
+	fred.SetClient(&http.Client{Transport: transport})
+	return nil
+}
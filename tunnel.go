@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// tunnelTimeout is how long ssh has to open a tunnel
+const tunnelTimeout = 30 * time.Second
+
+// tunnel is an SSH tunnel: an ssh process forwarding a local port
+type tunnel struct {
+	cmd    *exec.Cmd
+	exited chan error // receives the result of the process once it exits
+}
+
+// tunnels are the tunnels opened, which closeTunnels closes
+var tunnels []*tunnel
+
+// chAddr returns the address of the ClickHouse native protocol on host, which is port 9000, or 9440 if secure,
+// unless host gives one.
+func chAddr(host string, secure bool) string {
+	if _, _, e := net.SplitHostPort(host); e == nil {
+		return host
+	}
+	if secure {
+		return net.JoinHostPort(host, "9440")
+	}
+	return net.JoinHostPort(host, "9000")
+}
+
+// openTunnel runs ssh to forward a local port through bastion, given as [user@]host, to ClickHouse at addr.  It
+// returns the local address once the tunnel is open.  ssh uses its own configuration and keys, so anything set up
+// for the bastion in ~/.ssh/config applies.
+func openTunnel(bastion string, addr string) (string, error) {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		return "", e
+	}
+	local := l.Addr().String()
+	if e := l.Close(); e != nil {
+		return "", e
+	}
+	t := &tunnel{
+		cmd: exec.Command("ssh", "-N", "-o", "ExitOnForwardFailure=yes", "-L",
+			fmt.Sprintf("%s:%s", local, addr), bastion),
+		exited: make(chan error, 1),
+	}
+	t.cmd.Stdin, t.cmd.Stderr = os.Stdin, os.Stderr
+	t.cmd.SysProcAttr = tunnelAttr()
+	if e := t.cmd.Start(); e != nil {
+		return "", fmt.Errorf("ssh: %w", e)
+	}
+	go func() { t.exited <- t.cmd.Wait() }()
+	deadline := time.Now().Add(tunnelTimeout)
+	for {
+		select {
+		case e := <-t.exited:
+			return "", fmt.Errorf("ssh tunnel through %s to %s failed: %v", bastion, addr, e)
+		default:
+		}
+		if conn, e := net.DialTimeout("tcp", local, time.Second); e == nil {
+			_ = conn.Close()
+			tunnels = append(tunnels, t)
+			return local, nil
+		}
+		if time.Now().After(deadline) {
+			_ = t.cmd.Process.Kill()
+			return "", fmt.Errorf("ssh tunnel through %s to %s didn't open within %s", bastion, addr, tunnelTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// closeTunnels stops the ssh processes of the tunnels.
+func closeTunnels() {
+	for _, t := range tunnels {
+		_ = t.cmd.Process.Kill()
+		<-t.exited
+	}
+	tunnels = nil
+}
@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// tunnelAttr returns the process attributes of ssh: it's killed if fred2ch dies without closing the tunnel, so a
+// crashed or killed run doesn't leave a forwarder behind.
+func tunnelAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// tunnelAttr returns the process attributes of ssh, which are the defaults: only Linux can have ssh killed when
+// fred2ch dies.
+func tunnelAttr() *syscall.SysProcAttr {
+	return nil
+}
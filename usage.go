@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/fred2ch/fred"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memorySample is how often a meter samples the heap
+const memorySample = 250 * time.Millisecond
+
+// usage is the resources a load used
+type usage struct {
+	requests   int64  // Fred II requests made for the observations
+	downloaded int64  // bytes of Fred II responses
+	peakHeap   uint64 // most heap in use, as sampled
+	written    int64  // bytes of rows sent to ClickHouse
+}
+
+// meter measures the resources a load uses, from when it's started until it's stopped
+type meter struct {
+	fetched *fred.Usage // Fred II requests of the load, counted by the requests themselves
+	done    chan struct{}
+	wg      sync.WaitGroup
+	peak    uint64
+}
+
+// startMeter starts measuring the resources the load of j uses.  The Fred II requests counted are those for the
+// observations, made with j's options, so loads running at the same time don't count each other's.
+func startMeter(j *job) *meter {
+	m := &meter{fetched: &fred.Usage{}, done: make(chan struct{})}
+	if j.opts != nil {
+		j.opts.Usage = m.fetched
+	}
+	m.sample()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(memorySample)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sample()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	return m
+}
+
+// sample updates the peak heap in use.
+func (m *meter) sample() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapInuse > m.peak {
+		m.peak = ms.HeapInuse
+	}
+}
+
+// stop stops measuring and returns the resources the load of j used.
+func (m *meter) stop(j *job) usage {
+	close(m.done)
+	m.wg.Wait()
+	m.sample()
+	return usage{requests: atomic.LoadInt64(&m.fetched.Requests), downloaded: atomic.LoadInt64(&m.fetched.Bytes),
+		peakHeap: m.peak, written: j.written}
+}
+
+// report prints the resources used by the load of seriesId.
+func (u usage) report(seriesId string) {
+	fmt.Printf("series %s used %d Fred II requests, %.1f MB downloaded, %.1f MB peak heap, "+
+		"%.1f MB sent to ClickHouse\n", seriesId, u.requests, float64(u.downloaded)/(1<<20),
+		float64(u.peakHeap)/(1<<20), float64(u.written)/(1<<20))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"math"
+	"sort"
+	"time"
+)
+
+// maxVerifyReports is the most discrepancies of each kind listed by verify
+const maxVerifyReports = 20
+
+// verifyCmd re-fetches a series and compares it with the rows loaded into a table, without changing anything.
+func verifyCmd(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	cf := addConnFlags(fs)
+	seriesPtr := fs.String("series", "", "string")
+	tablePtr := fs.String("table", "", "string")
+	tf := addTableFlags(fs)
+	date32Ptr := fs.Bool("date32", false, "bool")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	if e := cf.setup(); e != nil {
+		return e
+	}
+	if cf.API == "" || *seriesPtr == "" || *tablePtr == "" {
+		return fmt.Errorf("verify requires -api, -series and -table")
+	}
+	seriesId := seriesID(*seriesPtr)
+	tc, e := tf.config()
+	if e != nil {
+		return e
+	}
+	if *date32Ptr {
+		tc.dateType = "Date32"
+	}
+	obs, e := fred.GetObservations(seriesId, cf.API, nil)
+	if e != nil {
+		return diagnose(e, cf.Host)
+	}
+	con, e := cf.connect()
+	if e != nil {
+		return e
+	}
+	defer closeConnect(con)
+	loaded, e := loadedValues(seriesId, *tablePtr, tc, con)
+	if e != nil {
+		return diagnose(e, cf.Host)
+	}
+	found := 0
+	for _, kind := range verifySeries(obs, loaded, tc.minYear()) {
+		found += len(kind.dates)
+		for ind, line := range kind.dates {
+			if ind == maxVerifyReports {
+				fmt.Printf("%s: %d more\n", kind.name, len(kind.dates)-ind)
+				break
+			}
+			fmt.Printf("%s: %s\n", kind.name, line)
+		}
+	}
+	if found > 0 {
+		return fmt.Errorf("series %s: %d discrepancies between Fred II and %s", seriesId, found, *tablePtr)
+	}
+	fmt.Printf("series %s: %s matches Fred II (%d rows)\n", seriesId, *tablePtr, len(loaded))
+	return nil
+}
+
+// loadedValues returns the values of seriesId in table, keyed by date.  NULL values, loaded with -nulls null for
+// observations Fred II has no value for, are left out.
+func loadedValues(seriesId string, table string, tc *tableConfig, con *chutils.Connect) (map[string]float64, error) {
+	qry := fmt.Sprintf("SELECT %s, toFloat64(%s) FROM %s WHERE %s = ? AND %s IS NOT NULL", tc.dateCol, tc.valueCol,
+		table, tc.seriesCol, tc.valueCol)
+	rows, e := con.Query(qry, seriesId)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = rows.Close() }()
+	values := make(map[string]float64)
+	for rows.Next() {
+		var date time.Time
+		var v float64
+		if e := rows.Scan(&date, &v); e != nil {
+			return nil, e
+		}
+		values[date.Format(fred.DateFormat)] = v
+	}
+	return values, rows.Err()
+}
+
+// discrepancies are the dates of one kind of difference between Fred II and a table, each with a description
+type discrepancies struct {
+	name  string
+	dates []string
+}
+
+// verifySeries compares the observations from Fred II with the values loaded, keyed by date.  Observations that
+// a load skips (missing values and dates before minYear, the first the date column holds) aren't expected in the
+// table.
+func verifySeries(obs []fred.Observation, loaded map[string]float64, minYear int) []discrepancies {
+	missing := discrepancies{name: "missing from table"}
+	differ := discrepancies{name: "value differs"}
+	extra := discrepancies{name: "not in Fred II"}
+	seen := make(map[string]bool)
+	for _, o := range obs {
+		if o.Missing || o.Date.Year() < minYear {
+			continue
+		}
+		date := o.Date.Format(fred.DateFormat)
+		seen[date] = true
+		v, ok := loaded[date]
+		if !ok {
+			missing.dates = append(missing.dates, fmt.Sprintf("%s %v", date, o.Value))
+			continue
+		}
+		if !sameValue(o.Value, v) {
+			differ.dates = append(differ.dates, fmt.Sprintf("%s Fred II %v table %v", date, o.Value, v))
+		}
+	}
+	for date, v := range loaded {
+		if !seen[date] {
+			extra.dates = append(extra.dates, fmt.Sprintf("%s %v", date, v))
+		}
+	}
+	sort.Strings(extra.dates)
+	return []discrepancies{missing, differ, extra}
+}
+
+// sameValue returns true if the loaded value b matches the Fred II value a to the precision of a Float32 column.
+func sameValue(a float64, b float64) bool {
+	return a == b || math.Abs(a-b) <= 1e-6*math.Max(math.Abs(a), math.Abs(b))
+}
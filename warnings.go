@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// warnings counts the problems a load works around, by category, so they can be summarized when it's done.
+// In strict mode each problem is an error instead.  A nil *warnings ignores problems.
+// A warnings is safe for concurrent use.
+type warnings struct {
+	strict bool
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// newWarnings returns the warnings of a load, which is strict if strict is true.
+func newWarnings(strict bool) *warnings {
+	return &warnings{strict: strict, counts: make(map[string]int)}
+}
+
+// note records a problem of category.  In strict mode it returns the problem, described by format and args,
+// as an error.
+func (w *warnings) note(category string, format string, args ...interface{}) error {
+	if w == nil {
+		return nil
+	}
+	if w.strict {
+		return fmt.Errorf(format+" (-strict)", args...)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.counts[category]++
+	return nil
+}
+
+// summary prints the number of problems of each category the load of seriesId worked around, if there were any.
+func (w *warnings) summary(seriesId string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.counts) == 0 {
+		return
+	}
+	categories := make([]string, 0, len(w.counts))
+	for category := range w.counts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	counts := make([]string, len(categories))
+	for ind, category := range categories {
+		counts[ind] = fmt.Sprintf("%d %s", w.counts[category], category)
+	}
+	fmt.Printf("warnings for series %s: %s (-strict makes these errors)\n", seriesId, strings.Join(counts, ", "))
+}
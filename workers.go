@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/fred2ch/fred"
+	"sync"
+	"time"
+)
+
+// loadList loads the series ids into the table of the list's job j, workers of them at a time, and returns the
+// outcome of each, in the order of ids, and the number that failed.  The first series to load creates the table
+// and the rest add to it, so the series load one at a time until one succeeds.  After that the workers fetch and
+// parse their series at the same time, within the Fred II budgets of -api-per-minute and -api-per-day, and take
+// turns writing the table.  With -lock-table, the lock on the table is taken once for the whole list.  The loads go
+// through br, so once it trips the rest pause or fail without being tried.
+func loadList(ls *loadSpec, j *job, ids []string, workers int, br *fred.Breaker, acct *account,
+	con *chutils.Connect) ([]outcome, int, error) {
+	if ls.LockTable != "" {
+		if e := execDDL(lockDDL(ls.LockTable), con); e != nil {
+			return nil, 0, e
+		}
+		lock, e := acquireLock(ls.LockTable, j.table, con)
+		if e != nil {
+			return nil, 0, e
+		}
+		defer func() {
+			if e := lock.release(); e != nil {
+				fmt.Println(e)
+			}
+		}()
+	}
+	outcomes := make([]outcome, len(ids))
+	var mu sync.Mutex
+	failed := 0
+	inserts := &sync.Mutex{}
+	load := func(ind int, keep bool) bool {
+		start := time.Now()
+		sj, e := ls.job()
+		if e == nil {
+			sj.seriesId, sj.events, sj.keep, sj.inserts = ids[ind], j.events, keep, inserts
+			sj.locked = ls.LockTable != ""
+			sj.tc.bySeries = true
+			e = br.Do(func() error { return runLoad(ls, sj, acct, con) })
+		}
+		if e != nil {
+			fmt.Printf("series %s failed: %v\n", ids[ind], diagnose(e, acct.Host))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if e != nil {
+			failed++
+		}
+		outcomes[ind] = newOutcome(j.table, ids[ind], sj, time.Since(start), e)
+		return e == nil
+	}
+	next := 0
+	for created := false; next < len(ids) && !created; next++ {
+		created = load(next, false)
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ind := range work {
+				load(ind, true)
+			}
+		}()
+	}
+	for ; next < len(ids); next++ {
+		work <- next
+	}
+	close(work)
+	wg.Wait()
+	return outcomes, failed, nil
+}